@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const prestartComponentPodSetup = "pod-setup"
+
+var deployAdmissionToStartLatency = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystemDeploy,
+		Name:      "admission_to_start_latency_milliseconds",
+	},
+	[]string{
+		"deploy_name",
+		"namespace",
+		"cluster",
+	},
+)
+
+// podFirstContainer returns when the runtime started to create the first
+// container of the pod, init containers included, and when the process of
+// the first container started, in unix nanoseconds.
+func podFirstContainer(p *corev1.Pod) (int64, int64, bool) {
+	var create, start int64
+	mu.Lock()
+	defer mu.Unlock()
+	for _, statuses := range [][]corev1.ContainerStatus{p.Status.InitContainerStatuses, p.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if !strings.HasPrefix(status.ContainerID, containerNamePrefix) {
+				continue
+			}
+			name := strings.TrimPrefix(status.ContainerID, containerNamePrefix)
+			info, exists := podContainer(name)
+			if !exists {
+				continue
+			}
+			if create == 0 || info.Start < create {
+				create = info.Start
+			}
+			if start == 0 || info.End < start {
+				start = info.End
+			}
+		}
+	}
+	return create, start, start != 0
+}
+
+// exportAdmissionLatency sets the average time from the kubelet admitting the
+// pods of the deployment to their first container process starting, and the
+// part of it before the runtime is asked to create the first container. That
+// part is the whole pod setup, kubelet queuing, the sandbox, the network and
+// the image pulls, not the kubelet alone. The admission time is in seconds, so
+// the latency is accurate to a second.
+func exportAdmissionLatency(c *cluster, d *appsv1.Deployment, pods []*corev1.Pod) {
+	var (
+		queued, started float64
+		n               int
+	)
+	for _, p := range pods {
+		if p.Status.StartTime == nil {
+			continue
+		}
+		create, start, ok := podFirstContainer(p)
+		if !ok {
+			continue
+		}
+		admitted := p.Status.StartTime.Time.UnixNano()
+		queued += float64(create-admitted) / 1e6
+		started += float64(start-admitted) / 1e6
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	deployAdmissionToStartLatency.WithLabelValues(d.Name, d.Namespace, c.name).Set(started / float64(n))
+	deployPrestartLatency.WithLabelValues(d.Name, d.Namespace, c.name, prestartComponentPodSetup).Set(queued / float64(n))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	alertStartupLatencyHigh = "StartupLatencyHigh"
+	alertScaleLatencyHigh   = "ScaleLatencyHigh"
+
+	// alertResendInterval is how often a firing alert is posted again, so
+	// Alertmanager doesn't resolve it on its own
+	alertResendInterval = time.Minute
+	alertPostTimeout    = 10 * time.Second
+)
+
+type alertKey struct {
+	deployKey
+	alertname string
+}
+
+// amAlert is an alert of the v2 API of Alertmanager.
+type amAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      *time.Time        `json:"endsAt,omitempty"`
+}
+
+type firingAlert struct {
+	startsAt time.Time
+	sent     time.Time
+}
+
+// alerter posts alerts to Alertmanager when the startup or the scale latency
+// of deployments exceeds the thresholds, for sites which can't manage the
+// alert rules of Prometheus. Alerts are resolved once the latency is back
+// under the threshold or the deployment is gone.
+type alerter struct {
+	sync.Mutex
+	urls             []string
+	startupThreshold float64
+	scaleThreshold   float64
+	firing           map[alertKey]firingAlert
+	client           *http.Client
+}
+
+var alerts = alerter{
+	firing: map[alertKey]firingAlert{},
+	client: &http.Client{Timeout: alertPostTimeout},
+}
+
+// evaluate compares the last measurements of the deployments with the
+// thresholds and posts the alerts which start, are due to be resent or are
+// resolved.
+func (a *alerter) evaluate() {
+	if len(a.urls) == 0 {
+		return
+	}
+	violated := map[alertKey]float64{}
+	deployStatuses.Lock()
+	for k, status := range deployStatuses.deploys {
+		if a.startupThreshold > 0 && status.AvgLatencyMs > a.startupThreshold {
+			violated[alertKey{deployKey: k, alertname: alertStartupLatencyHigh}] = status.AvgLatencyMs
+		}
+		if latency, ok := scales.last(k); ok && a.scaleThreshold > 0 && latency > a.scaleThreshold {
+			violated[alertKey{deployKey: k, alertname: alertScaleLatencyHigh}] = latency
+		}
+	}
+	deployStatuses.Unlock()
+	now := clk.Now()
+	var posted []amAlert
+	a.Lock()
+	for k, latency := range violated {
+		f, exists := a.firing[k]
+		if !exists {
+			f.startsAt = now
+		}
+		if now.Sub(f.sent) < alertResendInterval {
+			continue
+		}
+		f.sent = now
+		a.firing[k] = f
+		posted = append(posted, a.alert(k, latency, f.startsAt, time.Time{}))
+	}
+	for k, f := range a.firing {
+		if _, exists := violated[k]; !exists {
+			delete(a.firing, k)
+			posted = append(posted, a.alert(k, 0, f.startsAt, now))
+		}
+	}
+	a.Unlock()
+	if len(posted) > 0 {
+		go a.post(posted)
+	}
+}
+
+func (a *alerter) alert(k alertKey, latency float64, startsAt, endsAt time.Time) amAlert {
+	threshold, what := a.startupThreshold, "average startup latency"
+	if k.alertname == alertScaleLatencyHigh {
+		threshold, what = a.scaleThreshold, "scale latency"
+	}
+	labels := map[string]string{
+		"alertname":   k.alertname,
+		"deploy_name": k.name,
+		"namespace":   k.namespace,
+		"severity":    "warning",
+	}
+	if k.cluster != "" {
+		labels["cluster"] = k.cluster
+	}
+	alert := amAlert{Labels: labels, StartsAt: startsAt}
+	alert.Annotations = map[string]string{
+		"summary": fmt.Sprintf("%s of deployment %s/%s exceeds %vms", strings.Title(what), k.namespace, k.name, threshold),
+	}
+	if endsAt.IsZero() {
+		alert.Annotations["description"] = fmt.Sprintf("The %s of deployment %s/%s is %.0fms.", what, k.namespace, k.name, latency)
+	} else {
+		alert.EndsAt = &endsAt
+	}
+	return alert
+}
+
+// post sends the alerts to all the Alertmanagers.
+func (a *alerter) post(alerts []amAlert) {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		logrus.WithError(err).Error("failed to encode alerts")
+		return
+	}
+	for _, url := range a.urls {
+		resp, err := a.client.Post(strings.TrimSuffix(url, "/")+"/api/v2/alerts", "application/json", bytes.NewReader(body))
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to post alerts to %s", url)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			logrus.Errorf("posting alerts to %s returned %d", url, resp.StatusCode)
+		}
+	}
+}
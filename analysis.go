@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Canary analysis can gate promotions on the startup latency in two ways.
+//
+// The Prometheus providers of Flagger and Argo Rollouts compare a query with a
+// threshold, e.g. for the canary deployment of Flagger
+//
+//	max(startup_exporter_pod_average_startup_latency_milliseconds{deploy_name="podinfo", namespace="test"})
+//
+// and for the canary of a rollout of Argo Rollouts
+//
+//	max(startup_exporter_rollout_average_startup_latency_milliseconds{rollout_name="guestbook", namespace="test", role="canary"})
+//
+// Without Prometheus, /api/v1/analysis is a webhook of Flagger, answered with
+// 200 if the deployment starts within maxLatencyMs of the metadata and 412
+// otherwise, and a web metric provider of Argo Rollouts, whose success
+// condition is result.passed or a bound on result.avgLatencyMs.
+
+// analysisResult is the startup latency of a deployment judged against a
+// threshold.
+type analysisResult struct {
+	Cluster        string    `json:"cluster,omitempty"`
+	Namespace      string    `json:"namespace"`
+	Name           string    `json:"name"`
+	AvgLatencyMs   float64   `json:"avgLatencyMs"`
+	Samples        int       `json:"samples"`
+	ScaleLatencyMs *float64  `json:"scaleLatencyMs,omitempty"`
+	MaxLatencyMs   *float64  `json:"maxLatencyMs,omitempty"`
+	Passed         bool      `json:"passed"`
+	Updated        time.Time `json:"updated"`
+}
+
+// flaggerWebhook is the payload Flagger sends to its webhooks.
+type flaggerWebhook struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Phase     string            `json:"phase"`
+	Metadata  map[string]string `json:"metadata"`
+}
+
+// analyze judges the last measurement of the deployment, it passes if the
+// average startup latency is within the max, or if there's no max.
+func analyze(k deployKey, max string) (*analysisResult, int, string) {
+	var maxLatency *float64
+	if max != "" {
+		v, err := strconv.ParseFloat(max, 64)
+		if err != nil || v < 0 {
+			return nil, http.StatusBadRequest, "invalid maxLatencyMs " + max
+		}
+		maxLatency = &v
+	}
+	deployStatuses.Lock()
+	status, exists := deployStatuses.deploys[k]
+	deployStatuses.Unlock()
+	if !exists {
+		return nil, http.StatusNotFound, "deployment isn't measured"
+	}
+	result := &analysisResult{
+		Cluster:      status.Cluster,
+		Namespace:    status.Namespace,
+		Name:         status.Name,
+		AvgLatencyMs: status.AvgLatencyMs,
+		Samples:      status.Samples,
+		MaxLatencyMs: maxLatency,
+		Passed:       maxLatency == nil || status.AvgLatencyMs <= *maxLatency,
+		Updated:      status.Updated,
+	}
+	if latency, ok := scales.last(k); ok {
+		result.ScaleLatencyMs = &latency
+	}
+	return result, http.StatusOK, ""
+}
+
+// handleAnalysis judges a deployment by the query with GET, for the web
+// metric provider of Argo Rollouts, and by a Flagger webhook payload with
+// POST.
+func handleAnalysis(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		k := deployKey{cluster: q.Get("cluster"), meta: meta{name: q.Get("name"), namespace: q.Get("namespace")}}
+		if k.name == "" || k.namespace == "" {
+			writeError(w, http.StatusBadRequest, "namespace and name must be provided")
+			return
+		}
+		result, status, msg := analyze(k, q.Get("maxLatencyMs"))
+		if result == nil {
+			writeError(w, status, msg)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		var hook flaggerWebhook
+		if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid webhook payload")
+			return
+		}
+		if hook.Name == "" || hook.Namespace == "" {
+			writeError(w, http.StatusBadRequest, "namespace and name must be provided")
+			return
+		}
+		k := deployKey{cluster: hook.Metadata["cluster"], meta: meta{name: hook.Name, namespace: hook.Namespace}}
+		result, status, msg := analyze(k, hook.Metadata["maxLatencyMs"])
+		if result == nil {
+			writeError(w, status, msg)
+			return
+		}
+		if !result.Passed {
+			writeJSON(w, http.StatusPreconditionFailed, result)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST are allowed")
+	}
+}
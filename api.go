@@ -3,6 +3,15 @@ package main
 const (
 	typeCheckpoint = "checkpoint"
 	typeDefault    = "default"
+	typeWasm       = "wasm"
+)
+
+// units of the timestamps in containerStartupInfo
+const (
+	unitSecond      = "s"
+	unitMillisecond = "ms"
+	unitMicrosecond = "us"
+	unitNanosecond  = "ns"
 )
 
 type containerStartupInfo struct {
@@ -11,4 +20,16 @@ type containerStartupInfo struct {
 	Start     int64  `json:"start"`
 	End       int64  `json:"end"`
 	Type      string `json:"type"`
+	Attempt   int    `json:"attempt"`
+	Unit      string `json:"unit,omitempty"`
+	// Extras is metadata provided by the shim
+	Extras map[string]string `json:"extras,omitempty"`
+	// Pod and PodNamespace are the pod the container belongs to according
+	// to its CRI annotations
+	Pod          string `json:"pod,omitempty"`
+	PodNamespace string `json:"podNamespace,omitempty"`
+	Image        string `json:"image,omitempty"`
+	// Snapshot tells whether the snapshot of the image existed before the
+	// container was created
+	Snapshot string `json:"snapshot,omitempty"`
 }
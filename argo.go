@@ -0,0 +1,181 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	kindRollout = "Rollout"
+	// rolloutPodHashLabel is set on the replica sets of a rollout and their
+	// pods to the hash of the pod template
+	rolloutPodHashLabel = "rollouts-pod-template-hash"
+
+	rolloutRoleStable = "stable"
+	rolloutRoleCanary = "canary"
+)
+
+var (
+	// argoRollouts enables measuring the rollouts of Argo Rollouts
+	argoRollouts bool
+
+	rolloutResource = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+	// rolloutScales measures the scale events of rollouts
+	rolloutScales = newScaleTracker(kindRollout)
+
+	rolloutAvgStartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemRollout,
+			Name:      "average_startup_latency_milliseconds",
+		},
+		[]string{
+			"rollout_name",
+			"namespace",
+			"cluster",
+			"role",
+		},
+	)
+)
+
+// argoRollout holds the fields of a rollout of Argo Rollouts the exporter
+// needs, so the Argo Rollouts API types aren't needed.
+type argoRollout struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		Replicas *int32                `json:"replicas,omitempty"`
+		Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		CurrentPodHash string `json:"currentPodHash,omitempty"`
+		// StableRS is the pod template hash of the stable replica set, the
+		// active one of a blue-green rollout
+		StableRS string `json:"stableRS,omitempty"`
+	} `json:"status"`
+}
+
+// watchRollouts makes the clusters watch rollouts, it's called before the
+// informers start.
+func watchRollouts(clusters []*cluster) {
+	for _, c := range clusters {
+		c.rolloutLister = c.dynamicFactory.ForResource(rolloutResource).Lister()
+	}
+}
+
+// updateRollouts measures the rollouts of the clusters.
+func updateRollouts(clusters []*cluster) {
+	var (
+		rollouts = map[*cluster][]*argoRollout{}
+		existing = map[deployKey]struct{}{}
+		listed   = true
+	)
+	for _, c := range clusters {
+		objs, err := c.rolloutLister.List(labels.Everything())
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to list rollouts in the cluster %s", c.name)
+			listed = false
+			continue
+		}
+		for _, obj := range objs {
+			u, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			r := &argoRollout{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, r); err != nil {
+				logrus.WithError(err).Errorf("invalid rollout %s(%s)", u.GetName(), u.GetNamespace())
+				continue
+			}
+			existing[deployKey{cluster: c.name, meta: meta{name: r.Name, namespace: r.Namespace}}] = struct{}{}
+			rollouts[c] = append(rollouts[c], r)
+		}
+	}
+	if listed {
+		rolloutScales.prune(existing)
+		smoother.prune(kindRollout, existing)
+	}
+	for _, c := range clusters {
+		for _, r := range rollouts[c] {
+			c.updateRollout(r)
+		}
+	}
+	rolloutScales.export()
+}
+
+func (c *cluster) updateRollout(r *argoRollout) {
+	if r.Spec.Selector == nil {
+		logrus.Errorf("rollout %s from %s has an empty selector", r.Name, r.Namespace)
+		return
+	}
+	selected, err := c.podLister.Pods(r.Namespace).List(makeSelector(*r.Spec.Selector))
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to list pods belongs to %s", r.Name)
+		return
+	}
+	// the pods are controlled by the replica sets of the rollout
+	var pods []*corev1.Pod
+	for _, p := range selected {
+		ref := metav1.GetControllerOf(p)
+		if ref == nil || ref.Kind != "ReplicaSet" {
+			continue
+		}
+		rs, err := c.rsLister.ReplicaSets(p.Namespace).Get(ref.Name)
+		if err != nil || !metav1.IsControlledBy(rs, r) {
+			continue
+		}
+		pods = append(pods, p)
+	}
+	key := scaleKey{
+		deployKey: deployKey{cluster: c.name, meta: meta{name: r.Name, namespace: r.Namespace}},
+		hash:      r.Status.CurrentPodHash,
+		replicas:  1,
+	}
+	if r.Spec.Replicas != nil {
+		key.replicas = *r.Spec.Replicas
+	}
+	rolloutScales.trackKey(c, key, r.CreationTimestamp.Time, pods)
+	updateWorkload(c, kindRollout, r, pods)
+	exportRolloutRoles(c, r, pods)
+}
+
+// exportRolloutRoles sets the average startup latency of the pods of the
+// stable replica set of the rollout and of the others, which are the canary
+// or the preview ones. A role is left out until all its pods are received.
+func exportRolloutRoles(c *cluster, r *argoRollout, pods []*corev1.Pod) {
+	var (
+		total    = map[string]float64{}
+		count    = map[string]int{}
+		complete = map[string]bool{rolloutRoleStable: true, rolloutRoleCanary: true}
+	)
+	for _, p := range pods {
+		if c.evictions.isReplacement(p) {
+			continue
+		}
+		role := rolloutRoleCanary
+		if r.Status.StableRS != "" && p.Labels[rolloutPodHashLabel] == r.Status.StableRS {
+			role = rolloutRoleStable
+		}
+		records, ok := podStartupRecords(p)
+		if !ok {
+			complete[role] = false
+			continue
+		}
+		for _, record := range records {
+			total[role] += record.milliseconds()
+			count[role]++
+		}
+	}
+	for role, n := range count {
+		if complete[role] {
+			rolloutAvgStartupLatency.WithLabelValues(r.Name, r.Namespace, c.name, role).Set(total[role] / float64(n))
+		}
+	}
+}
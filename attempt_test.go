@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestIngestAttemptsOutOfOrder(t *testing.T) {
+	defer resetRecords()
+	m := meta{name: "c", namespace: "k8s.io"}
+	for _, attempt := range []int{2, 0, 1, 2, 70} {
+		ingest(startupRecord{Name: m.name, Namespace: m.namespace, Type: typeDefault, Attempt: attempt, Start: 1, End: 2})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, attempt := range []int{0, 1, 2, 70} {
+		if !seenAttempts[m].has(attempt) {
+			t.Errorf("attempt %d wasn't accepted", attempt)
+		}
+	}
+	if seenAttempts[m].has(3) {
+		t.Error("attempt 3 was accepted without being sent")
+	}
+	if r, _ := allInfo.get(m); r.Attempt != 70 {
+		t.Errorf("aggregated attempt %d, want the latest one", r.Attempt)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// apiToken is the bearer token required by the APIs which change the
+// clusters, they are disabled if it's empty.
+var apiToken string
+
+// requireToken rejects the requests to h without the API token, the authz
+// policy takes its place if there's one.
+func requireToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authz != nil {
+			h(w, r)
+			return
+		}
+		if apiToken == "" {
+			writeError(w, http.StatusForbidden, "no API token is configured")
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "invalid API token")
+			return
+		}
+		h(w, r)
+	}
+}
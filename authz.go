@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// roleIngest may only send startup info
+	roleIngest = "ingest"
+	// roleRead may only read metrics and the APIs
+	roleRead = "read"
+	// roleAdmin may do anything, including resetting and scaling
+	roleAdmin = "admin"
+
+	serviceAccountPrefix = "system:serviceaccount:"
+	// tokenReviewTTL is how long the identity of a ServiceAccount token is
+	// cached
+	tokenReviewTTL = time.Minute
+)
+
+// authzIdentity maps an identity to a role, it's exactly one of a bearer
+// token, a ServiceAccount as namespace/name whose token is reviewed by the
+// cluster, or the common name of a verified client certificate.
+type authzIdentity struct {
+	Token          string `json:"token,omitempty"`
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	CommonName     string `json:"commonName,omitempty"`
+	Role           string `json:"role"`
+}
+
+// authzPolicy is the file of --authz-policy, e.g.
+//
+//	{
+//	  "identities": [
+//	    {"serviceAccount": "kube-system/startup-collector", "role": "ingest"},
+//	    {"commonName": "grafana", "role": "read"},
+//	    {"token": "s3cr3t", "role": "admin"}
+//	  ],
+//	  "anonymous": "read"
+//	}
+//
+// Requests without any known identity get the anonymous role, they are
+// rejected if it's empty. Reviewing ServiceAccount tokens needs the exporter
+// to be allowed to create tokenreviews.
+type authzPolicy struct {
+	Identities []authzIdentity `json:"identities"`
+	Anonymous  string          `json:"anonymous"`
+
+	reviewer kubernetes.Interface
+	mu       sync.Mutex
+	reviewed map[[sha256.Size]byte]reviewedToken
+}
+
+type reviewedToken struct {
+	serviceAccount string
+	expires        time.Time
+}
+
+// authz is the policy of the exporter, every route is allowed to everyone if
+// it's nil.
+var authz *authzPolicy
+
+func loadAuthzPolicy(path string) (*authzPolicy, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &authzPolicy{reviewed: map[[sha256.Size]byte]reviewedToken{}}
+	if err := json.Unmarshal(bs, p); err != nil {
+		return nil, err
+	}
+	if p.Anonymous != "" && !validRole(p.Anonymous) {
+		return nil, errors.Errorf("invalid anonymous role %q", p.Anonymous)
+	}
+	for i, id := range p.Identities {
+		set := 0
+		for _, v := range []string{id.Token, id.ServiceAccount, id.CommonName} {
+			if v != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, errors.Errorf("identity %d must have exactly one of token, serviceAccount and commonName", i)
+		}
+		if id.ServiceAccount != "" && strings.Count(id.ServiceAccount, "/") != 1 {
+			return nil, errors.Errorf("serviceAccount %q of identity %d isn't namespace/name", id.ServiceAccount, i)
+		}
+		if !validRole(id.Role) {
+			return nil, errors.Errorf("invalid role %q of identity %d", id.Role, i)
+		}
+	}
+	return p, nil
+}
+
+func validRole(role string) bool {
+	return role == roleIngest || role == roleRead || role == roleAdmin
+}
+
+// routeRole returns the role a request to the route needs. The probes need
+// none as the kubelet has no identity, sending startup info needs ingest,
+// reading needs read, the Flagger webhook of the analysis only reads, and
+// anything else changes the exporter or the clusters.
+func routeRole(route, method string) string {
+	switch {
+	case route == "/healthz" || route == "/readyz":
+		return ""
+	case (route == "/" || route == ingestGRPCRoute) && method == http.MethodPost:
+		return roleIngest
+	case method == http.MethodGet || method == http.MethodHead:
+		return roleRead
+	case route == "/api/v1/analysis" && method == http.MethodPost:
+		return roleRead
+	}
+	return roleAdmin
+}
+
+// allows reports whether the role may make a request which needs the
+// required role.
+func allows(role, required string) bool {
+	return role == roleAdmin || role == required
+}
+
+// role returns the role of the identity of the request, it's empty if the
+// request has no identity the policy knows and there's no anonymous role.
+func (p *authzPolicy) role(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		for _, id := range p.Identities {
+			if id.CommonName != "" && id.CommonName == cn {
+				return id.Role
+			}
+		}
+	}
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" {
+		for _, id := range p.Identities {
+			if id.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(id.Token)) == 1 {
+				return id.Role
+			}
+		}
+		if sa := p.serviceAccount(r.Context(), token); sa != "" {
+			for _, id := range p.Identities {
+				if id.ServiceAccount == sa {
+					return id.Role
+				}
+			}
+		}
+	}
+	return p.Anonymous
+}
+
+// serviceAccount reviews the token and returns the ServiceAccount it belongs
+// to as namespace/name, it's empty for any other token.
+func (p *authzPolicy) serviceAccount(ctx context.Context, token string) string {
+	if p.reviewer == nil {
+		return ""
+	}
+	key := sha256.Sum256([]byte(token))
+	now := clk.Now()
+	p.mu.Lock()
+	reviewed, exists := p.reviewed[key]
+	p.mu.Unlock()
+	if exists && now.Before(reviewed.expires) {
+		return reviewed.serviceAccount
+	}
+	review, err := p.reviewer.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		// a failed review isn't cached, so it's retried on the next request
+		logrus.WithError(err).Error("failed to review a token")
+		return ""
+	}
+	sa := ""
+	if username := review.Status.User.Username; review.Status.Authenticated && strings.HasPrefix(username, serviceAccountPrefix) {
+		sa = strings.Replace(strings.TrimPrefix(username, serviceAccountPrefix), ":", "/", 1)
+	}
+	p.mu.Lock()
+	for k, t := range p.reviewed {
+		if now.After(t.expires) {
+			delete(p.reviewed, k)
+		}
+	}
+	p.reviewed[key] = reviewedToken{serviceAccount: sa, expires: now.Add(tokenReviewTTL)}
+	p.mu.Unlock()
+	return sa
+}
+
+// authorize rejects the requests to the routes of the mux their identity
+// isn't allowed to call.
+func authorize(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authz == nil {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		_, route := mux.Handler(r)
+		required := routeRole(route, r.Method)
+		if required == "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		role := authz.role(r)
+		switch {
+		case role == "":
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "unknown identity")
+		case !allows(role, required):
+			logrus.Debugf("denied %s %s to role %s", r.Method, r.URL.Path, role)
+			writeError(w, http.StatusForbidden, "role "+role+" isn't allowed to "+required)
+		default:
+			mux.ServeHTTP(w, r)
+		}
+	})
+}
+
+// serverTLSConfig verifies the certificates of the clients against the CAs
+// of the file if they present one.
+func serverTLSConfig(clientCAFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if clientCAFile == "" {
+		return config, nil
+	}
+	bs, err := ioutil.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bs) {
+		return nil, errors.Errorf("no certificates in %s", clientCAFile)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	return config, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"time"
+)
+
+const defaultBatchMax = 100
+
+// batcher accumulates the collected startup info of containers and releases
+// it once per window, so a push carries many containers.
+type batcher struct {
+	// window is how long startup info is accumulated, 0 means it's pushed
+	// after every scan
+	window time.Duration
+	// max is the max number of containers in a push
+	max     int
+	pending map[batchKey]containerStartupInfo
+	last    time.Time
+}
+
+type batchKey struct {
+	name      string
+	namespace string
+	attempt   int
+}
+
+var batches = batcher{
+	max:     defaultBatchMax,
+	pending: map[batchKey]containerStartupInfo{},
+}
+
+// add adds the collected startup info, info collected again replaces the
+// pending one.
+func (b *batcher) add(info []containerStartupInfo) {
+	for _, i := range info {
+		b.pending[batchKey{name: i.Name, namespace: i.Namespace, attempt: i.Attempt}] = i
+	}
+}
+
+// flush returns the pending startup info split in batches if the window is
+// over.
+func (b *batcher) flush() [][]containerStartupInfo {
+	if clk.Since(b.last) < b.window || len(b.pending) == 0 {
+		return nil
+	}
+	b.last = clk.Now()
+	max := b.max
+	if max <= 0 {
+		max = len(b.pending)
+	}
+	var (
+		batches [][]containerStartupInfo
+		batch   []containerStartupInfo
+	)
+	for k, i := range b.pending {
+		batch = append(batch, i)
+		if len(batch) == max {
+			batches = append(batches, batch)
+			batch = nil
+		}
+		delete(b.pending, k)
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"github.com/YLonely/startup-exporter/pkg/clock"
+)
+
+// clk tells the time and waits for it, the exporter and the collector use
+// clk instead of the time package, so tests can control the time with a
+// clock.Fake.
+var clk clock.Clock = clock.Real{}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/YLonely/startup-exporter/pkg/clock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeClock replaces clk with a fake clock for the test.
+func fakeClock(t *testing.T) *clock.Fake {
+	c := clock.NewFake(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	old := clk
+	clk = c
+	t.Cleanup(func() { clk = old })
+	return c
+}
+
+func TestHistoryExpiry(t *testing.T) {
+	c := fakeClock(t)
+	h := historyStore{retention: time.Hour}
+	h.add(measurementLogLine{Time: c.Now()})
+	c.Advance(30 * time.Minute)
+	h.add(measurementLogLine{Time: c.Now()})
+	c.Advance(45 * time.Minute)
+	h.add(measurementLogLine{Time: c.Now()})
+	if len(h.lines) != 2 {
+		t.Errorf("retained %d lines, want the 2 within the retention", len(h.lines))
+	}
+}
+
+func TestMeasurementCooldown(t *testing.T) {
+	c := fakeClock(t)
+	cd := measurementCooldown{window: time.Minute, last: map[deployKey]publishedMeasurement{}}
+	k := deployKey{meta: meta{name: "d", namespace: "ns"}}
+	pods := []*corev1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{UID: "p"},
+		Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{ContainerID: "containerd://a"}}},
+	}}
+	republished := 0
+	cd.published(k, pods, func() { republished++ })
+	c.Advance(30 * time.Second)
+	if !cd.skip(k, pods) || republished != 1 {
+		t.Error("measured again within the window")
+	}
+	restarted := []*corev1.Pod{pods[0].DeepCopy()}
+	restarted[0].Status.ContainerStatuses[0].ContainerID = "containerd://b"
+	if cd.skip(k, restarted) {
+		t.Error("skipped changed pods within the window")
+	}
+	c.Advance(31 * time.Second)
+	if cd.skip(k, pods) {
+		t.Error("skipped after the window")
+	}
+}
+
+func TestQuotaRateWindow(t *testing.T) {
+	c := fakeClock(t)
+	q := namespaceQuota{rate: 2, accepted: map[string]int{}, retained: map[string]int{}, owners: map[meta]string{}}
+	n := 0
+	admit := func(namespace string) bool {
+		n++
+		return q.admit(meta{name: fmt.Sprint(n), namespace: namespace}, startupRecord{Namespace: namespace}, true)
+	}
+	if !admit("ns") || !admit("ns") {
+		t.Fatal("rejected records within the rate")
+	}
+	if admit("ns") {
+		t.Error("accepted a record over the rate")
+	}
+	if !admit("other") {
+		t.Error("rejected a record of another namespace")
+	}
+	c.Advance(59 * time.Second)
+	if admit("ns") {
+		t.Error("accepted a record over the rate within the window")
+	}
+	c.Advance(time.Second)
+	if !admit("ns") {
+		t.Error("rejected a record in a new window")
+	}
+}
+
+func TestQuotaByPodNamespace(t *testing.T) {
+	fakeClock(t)
+	q := namespaceQuota{retain: 2, accepted: map[string]int{}, retained: map[string]int{}, owners: map[meta]string{}}
+	admit := func(name, podNamespace string) bool {
+		m := meta{name: name, namespace: defaultContainerdK8sNamespace}
+		return q.admit(m, startupRecord{Name: name, Namespace: defaultContainerdK8sNamespace, PodNamespace: podNamespace}, true)
+	}
+	if !admit("a", "churn") || !admit("b", "churn") {
+		t.Fatal("rejected records within the retention")
+	}
+	if admit("c", "churn") {
+		t.Error("retained a container over the quota")
+	}
+	if !admit("d", "quiet") {
+		t.Error("a churning namespace used up the quota of another namespace under k8s.io")
+	}
+	q.release(meta{name: "a", namespace: defaultContainerdK8sNamespace})
+	if !admit("e", "churn") {
+		t.Error("a released container isn't given back to its namespace")
+	}
+}
+
+func TestScanThrottleUsesClock(t *testing.T) {
+	c := fakeClock(t)
+	l := scanLimits{rate: 10}
+	l.throttle()
+	done := make(chan struct{})
+	go func() {
+		l.throttle()
+		close(done)
+	}()
+	for c.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatal("scanned the next bundle before the interval")
+	default:
+	}
+	c.Advance(100 * time.Millisecond)
+	<-done
+}
+
+func TestCollectorNetworkExpires(t *testing.T) {
+	c := fakeClock(t)
+	defer collectorNetwork.Reset()
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set(networkModeHeader, networkModeHost)
+	r.Header.Set(nodeHeader, "node-1")
+	recordCollectorNetworkMode(r)
+	if v := testutil.ToFloat64(collectorNetwork.WithLabelValues("node-1", networkModeHost)); v != 1 {
+		t.Fatalf("got %v for the collector of node-1, want 1", v)
+	}
+	c.Advance(collectorNetworkTTL + time.Second)
+	collectors.prune()
+	if n := testutil.CollectAndCount(collectorNetwork); n != 0 {
+		t.Errorf("got %d series after the collector is gone, want 0", n)
+	}
+}
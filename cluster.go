@@ -0,0 +1,115 @@
+package main
+
+import (
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// cluster holds the informers of a Kubernetes cluster the exporter watches.
+type cluster struct {
+	// name is the kubeconfig context of the cluster, it's empty if the
+	// exporter watches a single cluster without choosing a context
+	name              string
+	client            kubernetes.Interface
+	factory           informers.SharedInformerFactory
+	deploymentLister  appslisters.DeploymentLister
+	podLister         corelisters.PodLister
+	rsLister          appslisters.ReplicaSetLister
+	statefulSetLister appslisters.StatefulSetLister
+	daemonSetLister   appslisters.DaemonSetLister
+	jobLister         batchlisters.JobLister
+	evictions         *evictionTracker
+	owners            *ownerCache
+	healing           *healingTracker
+	nodes             *nodeStates
+	volumes           *pvcTracker
+
+	// dynamicFactory watches the custom resources of other projects
+	dynamicClient          dynamic.Interface
+	dynamicFactory         dynamicinformer.DynamicSharedInformerFactory
+	deploymentConfigLister cache.GenericLister
+	rolloutLister          cache.GenericLister
+	cronJobLister          cache.GenericLister
+}
+
+// deployKey identifies a deployment across clusters.
+type deployKey struct {
+	cluster string
+	meta
+}
+
+func newCluster(name string, config *rest.Config) (*cluster, error) {
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	factory := informers.NewSharedInformerFactory(kubeClient, informerResyncPeriod)
+	if err := factory.Core().V1().Pods().Informer().AddIndexers(cache.Indexers{containerIDIndex: containerIDs}); err != nil {
+		return nil, err
+	}
+	owners := newOwnerCache(factory)
+	watchDeletions(name, factory)
+	return &cluster{
+		name:              name,
+		client:            kubeClient,
+		factory:           factory,
+		deploymentLister:  factory.Apps().V1().Deployments().Lister(),
+		podLister:         factory.Core().V1().Pods().Lister(),
+		rsLister:          factory.Apps().V1().ReplicaSets().Lister(),
+		statefulSetLister: factory.Apps().V1().StatefulSets().Lister(),
+		daemonSetLister:   factory.Apps().V1().DaemonSets().Lister(),
+		jobLister:         factory.Batch().V1().Jobs().Lister(),
+		dynamicClient:     dynamicClient,
+		dynamicFactory:    dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, informerResyncPeriod),
+		evictions:         newEvictionTracker(factory),
+		owners:            owners,
+		healing:           newHealingTracker(factory, owners),
+		nodes:             newNodeStates(factory),
+		volumes:           newPVCTracker(factory),
+	}, nil
+}
+
+// loadClusters creates a cluster for each kubeconfig context, or a single
+// cluster from the current context or the in-cluster config if no context is
+// given.
+func loadClusters(kubeconfig, master string, contexts []string) ([]*cluster, error) {
+	if len(contexts) == 0 {
+		config, err := clientcmd.BuildConfigFromFlags(master, kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		c, err := newCluster("", config)
+		if err != nil {
+			return nil, err
+		}
+		return []*cluster{c}, nil
+	}
+	var clusters []*cluster
+	for _, ctx := range contexts {
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
+			&clientcmd.ConfigOverrides{CurrentContext: ctx},
+		).ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		c, err := newCluster(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const defaultClusterWindow = 10 * time.Minute
+
+var (
+	clusterContainers = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemCluster,
+			Name:      "containers",
+		},
+		[]string{
+			"cluster",
+		},
+	)
+	clusterAvgStartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemCluster,
+			Name:      "average_startup_latency_milliseconds",
+		},
+		[]string{
+			"cluster",
+		},
+	)
+	clusterMaxStartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemCluster,
+			Name:      "max_startup_latency_milliseconds",
+		},
+		[]string{
+			"cluster",
+		},
+	)
+)
+
+type clusterSample struct {
+	container meta
+	received  time.Time
+	latency   float64
+}
+
+// clusterTracker aggregates the startup latency of the containers observed in
+// the pods of every cluster over a rolling window, so a cluster has a single
+// headline number. Unlike the namespace aggregates, containers of pods which
+// are gone are counted until they fall out of the window.
+type clusterTracker struct {
+	sync.Mutex
+	window  time.Duration
+	samples map[string][]clusterSample
+	// seen holds the containers of the samples of every cluster, so a
+	// container is counted once
+	seen map[string]map[meta]struct{}
+}
+
+var clusterWide = clusterTracker{
+	window:  defaultClusterWindow,
+	samples: map[string][]clusterSample{},
+	seen:    map[string]map[meta]struct{}{},
+}
+
+// observe adds the startup record of a container found in a pod of the
+// cluster.
+func (t *clusterTracker) observe(cluster string, r startupRecord) {
+	m := meta{name: r.Name, namespace: r.Namespace}
+	t.Lock()
+	defer t.Unlock()
+	seen, exists := t.seen[cluster]
+	if !exists {
+		seen = map[meta]struct{}{}
+		t.seen[cluster] = seen
+	}
+	if _, exists := seen[m]; exists {
+		return
+	}
+	seen[m] = struct{}{}
+	t.samples[cluster] = append(t.samples[cluster], clusterSample{container: m, received: r.Received, latency: r.milliseconds()})
+}
+
+// export drops the samples out of the window and sets the aggregates of the
+// clusters.
+func (t *clusterTracker) export() {
+	t.Lock()
+	defer t.Unlock()
+	clusterContainers.Reset()
+	clusterAvgStartupLatency.Reset()
+	clusterMaxStartupLatency.Reset()
+	now := clk.Now()
+	for cluster, samples := range t.samples {
+		var (
+			kept       []clusterSample
+			total, max float64
+		)
+		for _, s := range samples {
+			if now.Sub(s.received) > t.window {
+				delete(t.seen[cluster], s.container)
+				continue
+			}
+			kept = append(kept, s)
+			total += s.latency
+			if s.latency > max {
+				max = s.latency
+			}
+		}
+		if len(kept) == 0 {
+			delete(t.samples, cluster)
+			delete(t.seen, cluster)
+			continue
+		}
+		t.samples[cluster] = kept
+		clusterContainers.WithLabelValues(cluster).Set(float64(len(kept)))
+		clusterAvgStartupLatency.WithLabelValues(cluster).Set(total / float64(len(kept)))
+		clusterMaxStartupLatency.WithLabelValues(cluster).Set(max)
+	}
+}
+
+func (t *clusterTracker) reset() {
+	t.Lock()
+	defer t.Unlock()
+	t.samples = map[string][]clusterSample{}
+	t.seen = map[string]map[meta]struct{}{}
+}
@@ -2,16 +2,21 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"os/signal"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/YLonely/startup-exporter/pkg/client"
+	"github.com/YLonely/startup-exporter/pkg/shimhook"
+	"github.com/YLonely/startup-exporter/pkg/startup"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
@@ -20,25 +25,87 @@ import (
 const (
 	defaultContainerdRoot = "/run/containerd/io.containerd.runtime.v2.task"
 	waitPeriod            = 1 * time.Second
+	partialReadRetries    = 3
+	partialReadBackoff    = 10 * time.Millisecond
 )
 
+// errPartialStartupFile means the startup file is being written by the shim or
+// the container hasn't started yet, see package shimhook for the convention.
+var errPartialStartupFile = errors.New("partial startup file")
+
 var collectCmd = cli.Command{
 	Name:      "collect",
 	Usage:     "collect startup time of containers from containerd",
-	ArgsUsage: "EXPORTER_IP:PORT",
+	ArgsUsage: "[EXPORTER_IP:PORT]",
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "namespace,n",
 			Usage: "specifiy the namespace of containers should be collected",
 		},
+		cli.StringFlag{
+			Name:  "listen",
+			Usage: "address to serve the containers of the last scan on for the exporter to pull, the exporter address may be left out then",
+		},
+		cli.StringFlag{
+			Name:   "listen-token",
+			Usage:  "bearer token the exporter must pull the containers served on --listen with",
+			EnvVar: collectorTokenEnv,
+		},
+		cli.StringFlag{
+			Name:  "proxy",
+			Usage: "http, https or socks5 proxy URL to push through, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are used if not set",
+		},
+		cli.DurationFlag{
+			Name:  "batch-window",
+			Usage: "how long collected containers are accumulated before they are pushed, 0 pushes after every scan",
+		},
+		cli.IntFlag{
+			Name:  "batch-max",
+			Usage: "max number of containers in a push, 0 means no limit",
+			Value: defaultBatchMax,
+		},
+		cli.IntFlag{
+			Name:  "max-scan-rate",
+			Usage: "max number of container dirs scanned per second, 0 means no limit",
+		},
+		cli.Uint64Flag{
+			Name:  "max-open-files",
+			Usage: "max number of open file descriptors, 0 means no limit",
+		},
+		cli.DurationFlag{
+			Name:  "full-scan-interval",
+			Usage: "interval between scans which ignore the cached mtimes of dirs",
+			Value: defaultFullScanInterval,
+		},
+		cli.StringSliceFlag{
+			Name:  "root",
+			Usage: "task root of containerd to scan besides the default one and the one from its config, can be given more than once",
+		},
+		cli.StringFlag{
+			Name:  "containerd-config",
+			Usage: "config file of containerd to read a non-default state dir from, empty disables it",
+			Value: defaultContainerdConfig,
+		},
+		cli.Uint64Flag{
+			Name:  "memory-limit",
+			Usage: "skip scans while the heap is larger than this many MiB, 0 means no limit",
+		},
 	},
 	Action: func(context *cli.Context) error {
-		addr := context.Args().First()
-		if addr == "" {
+		// the address may refer to the downward API, e.g. ${HOST_IP}:9090
+		addr := os.ExpandEnv(context.Args().First())
+		listen := context.String("listen")
+		if addr == "" && listen == "" {
 			return errors.New("address of exporter must be provided")
 		}
-		if !strings.HasPrefix(addr, "http") {
-			addr = "http://" + addr
+		var err error
+		if addr != "" {
+			if addr, err = exporterURL(addr); err != nil {
+				return err
+			}
+		}
+		if pushClient, err = newPushClient(context.String("proxy")); err != nil {
+			return err
 		}
 		logrus.SetLevel(logrus.ErrorLevel)
 		if context.GlobalBool("debug") {
@@ -47,31 +114,57 @@ var collectCmd = cli.Command{
 		signalC := make(chan os.Signal, 1024)
 		signal.Notify(signalC, handledSignals...)
 		done := handleSignals(signalC)
-		err := os.Chdir(defaultContainerdRoot)
-		if err != nil {
-			return errors.Wrap(err, "failed to change the work dir")
+		roots := taskRoots(context.String("containerd-config"), context.StringSlice("root"))
+		logrus.Debugf("collector scans task roots %v", roots)
+		setContainerNameLength(context)
+		networkMode = collectorNetworkMode()
+		nodeName = collectorNode()
+		logrus.Debugf("collector runs in %s network", networkMode)
+		batches.window = context.Duration("batch-window")
+		batches.max = context.Int("batch-max")
+		limits.rate = context.Int("max-scan-rate")
+		limits.memory = context.Uint64("memory-limit") << 20
+		if n := context.Uint64("max-open-files"); n > 0 {
+			if err := setMaxOpenFiles(n); err != nil {
+				return errors.Wrap(err, "failed to limit open files")
+			}
 		}
-		ns := context.String("namespace")
-		ticker := time.NewTicker(waitPeriod)
+		scanCache.fullScanInterval = context.Duration("full-scan-interval")
+		if listen != "" {
+			if scannedToken = context.String("listen-token"); scannedToken == "" {
+				return errors.New("the token to serve the containers with must be provided")
+			}
+			mux := http.NewServeMux()
+			mux.HandleFunc(collectorRecordsPath, serveScanned)
+			go func() {
+				if err := http.ListenAndServe(listen, mux); err != nil {
+					logrus.WithError(err).Fatal("failed to serve the scanned containers")
+				}
+			}()
+		}
+		collector := rootCollector{roots: roots, namespace: context.String("namespace")}
+		ticker := clk.NewTicker(waitPeriod)
 		exit := false
 		for {
 			all := []containerStartupInfo{}
-			if ns == "" {
-				dirs, err := ioutil.ReadDir(".")
-				if err != nil {
-					return errors.Wrap(err, "failed to read the current dir")
-				}
-				for _, dir := range dirs {
-					all = append(all, collect(dir.Name())...)
-				}
+			scanCache.expire()
+			if limits.overMemory() {
+				logrus.Warn("skip the scan to stay in the memory limit")
 			} else {
-				all = append(all, collect(ns)...)
+				all = collector.collect()
 			}
-			if err := push(all, addr); err != nil {
-				logrus.WithError(err).Error("failed to push container startup info to the exporter")
+			images.classify(all)
+			setScanned(all)
+			if addr != "" {
+				batches.add(all)
+				for _, batch := range batches.flush() {
+					if err := push(batch, addr); err != nil {
+						logrus.WithError(err).Error("failed to push container startup info to the exporter")
+					}
+				}
 			}
 			select {
-			case <-ticker.C:
+			case <-ticker.C():
 			case <-done:
 				exit = true
 			}
@@ -83,71 +176,252 @@ var collectCmd = cli.Command{
 	},
 }
 
+// push sends the startup info of containers to the exporter in one request,
+// a single container is sent as an object and more as an array.
 func push(info []containerStartupInfo, addr string) error {
-	for _, i := range info {
-		bs, err := json.Marshal(i)
-		if err != nil {
-			return err
-		}
-		resp, err := http.Post(addr, "application/json", bytes.NewReader(bs))
-		if err != nil {
-			return errors.Wrap(err, "failed to post the info")
+	var v interface{} = info
+	if len(info) == 1 {
+		v = info[0]
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, addr, bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(networkModeHeader, networkMode)
+	req.Header.Set(versionHeader, version)
+	req.Header.Set(nodeHeader, nodeName)
+	id := newID()
+	req.Header.Set(requestIDHeader, id)
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to post the info of request %s", id)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("received status %s from server for request %s", resp.Status, id)
+	}
+	logrus.WithField("request_id", id).Debugf("pushed %d containers", len(info))
+	return nil
+}
+
+// rootCollector collects the containers of the namespace under the task
+// roots, or of all the namespaces if it's empty.
+type rootCollector struct {
+	roots     []string
+	namespace string
+}
+
+var _ startup.Collector = rootCollector{}
+
+func (c rootCollector) collect() []containerStartupInfo {
+	var info []containerStartupInfo
+	for _, root := range c.roots {
+		info = append(info, collectRoot(root, c.namespace)...)
+	}
+	return info
+}
+
+// Collect is collect for the code embedding the collector.
+func (c rootCollector) Collect(ctx context.Context) ([]client.StartupInfo, error) {
+	var info []client.StartupInfo
+	for _, i := range c.collect() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			return errors.Errorf("received status %s from server", resp.Status)
+		info = append(info, client.StartupInfo(i))
+	}
+	return info, nil
+}
+
+// collectRoot collects the containers of the namespace under the task root,
+// or of all the namespaces if it's empty. A root which doesn't exist is
+// skipped, e.g. the default one on a node with another state dir.
+func collectRoot(root, ns string) []containerStartupInfo {
+	if ns != "" {
+		return collect(root, ns)
+	}
+	dirs, err := ioutil.ReadDir(root)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.WithError(err).Errorf("failed to read the task root %s", root)
 		}
+		return nil
 	}
-	return nil
+	var info []containerStartupInfo
+	for _, dir := range dirs {
+		info = append(info, collect(root, dir.Name())...)
+	}
+	return info
 }
 
-func collect(namespace string) []containerStartupInfo {
+func collect(root, namespace string) []containerStartupInfo {
 	var info []containerStartupInfo
-	dirs, err := ioutil.ReadDir(namespace)
+	dir := path.Join(root, namespace)
+	fi, err := os.Stat(dir)
+	if err != nil {
+		if !os.IsNotExist(err) || root == defaultContainerdRoot {
+			logrus.WithError(err).Error()
+		}
+		return info
+	}
+	cache, cached := scanCache.namespaces[dir]
+	if cached && fi.ModTime().Equal(cache.mtime) {
+		// no bundle is created or removed, but the bundles may have new
+		// startup files, the complete ones are not even stat'ed until the
+		// next full scan, so a tick costs syscalls for the containers still
+		// starting only
+		for name, b := range cache.bundles {
+			if b.complete {
+				info = append(info, b.info...)
+				continue
+			}
+			if bfi, err := os.Stat(path.Join(dir, name)); err == nil {
+				b = cache.scan(root, namespace, name, bfi.ModTime())
+				cache.bundles[name] = b
+			}
+			info = append(info, b.info...)
+		}
+		return info
+	}
+	dirs, err := ioutil.ReadDir(dir)
 	if err != nil {
 		logrus.WithError(err).Error()
 		return info
 	}
+	newCache := &namespaceScan{
+		mtime:   fi.ModTime(),
+		bundles: map[string]*bundleScan{},
+	}
 	for _, dir := range dirs {
-		startupPath := path.Join(namespace, dir.Name(), "startup")
-		if _, err := os.Stat(startupPath); err != nil {
-			continue
-		}
-		bs, err := ioutil.ReadFile(startupPath)
+		b := cache.scan(root, namespace, dir.Name(), dir.ModTime())
+		newCache.bundles[dir.Name()] = b
+		info = append(info, b.info...)
+	}
+	scanCache.namespaces[dir] = newCache
+	return info
+}
+
+// scanBundle reads all startup records of a bundle, the bundle is complete
+// if it has records and none of its startup files is partial.
+func scanBundle(root, namespace, name string) *bundleScan {
+	var info []containerStartupInfo
+	limits.throttle()
+	bundle := path.Join(root, namespace, name)
+	t := typeDefault
+	if _, err := os.Stat(path.Join(bundle, "work", "restore.log")); err == nil {
+		t = typeCheckpoint
+	}
+	shim := wasmShim(bundle)
+	if shim != "" {
+		t = typeWasm
+	}
+	annotations := bundleAnnotations(bundle)
+	pod, podNamespace := criPod(annotations)
+	complete := true
+	files := startupFiles(bundle)
+	for attempt, startupPath := range files {
+		f, err := readStartupFile(startupPath)
 		if err != nil {
-			logrus.WithError(err).Errorf("failed to read content from %s", startupPath)
-			continue
-		}
-		content := strings.Trim(string(bs), " \t\n")
-		lines := strings.Split(content, "\n")
-		n := len(lines)
-		if n < 2 {
+			complete = false
+			if err != errPartialStartupFile {
+				logrus.WithFields(podFields(bundle, name)).WithError(err).Errorf("failed to read content from %s", startupPath)
+			}
 			continue
 		}
-		start, err := strconv.Atoi(lines[0])
-		if err != nil {
-			logrus.WithError(err).Errorf("invalid start time %q from container %s", lines[0], dir.Name())
+		info = append(info, containerStartupInfo{
+			Name:         name,
+			Namespace:    namespace,
+			Start:        f.start,
+			End:          f.end,
+			Type:         t,
+			Attempt:      attempt,
+			Unit:         unitMillisecond,
+			Extras:       wasmExtras(shim, composeExtras(annotations, f.extras)),
+			Pod:          pod,
+			PodNamespace: podNamespace,
+			Image:        criImage(annotations),
+		})
+	}
+	return &bundleScan{info: info, complete: complete && len(info) > 0, empty: len(files) == 0}
+}
+
+// startupFiles returns the startup files in the bundle keyed by the index of
+// the start attempt they record.
+func startupFiles(bundle string) map[int]string {
+	files := map[int]string{}
+	startupPath := path.Join(bundle, shimhook.StartupFileName)
+	if _, err := os.Stat(startupPath); err == nil {
+		files[0] = startupPath
+	}
+	matches, _ := filepath.Glob(path.Join(bundle, shimhook.StartupFileName+".*"))
+	for _, m := range matches {
+		attempt, err := strconv.Atoi(strings.TrimPrefix(filepath.Ext(m), "."))
+		if err != nil || attempt <= 0 {
 			continue
 		}
-		end, err := strconv.Atoi(lines[1])
-		if err != nil {
-			logrus.WithError(err).Errorf("invalid end time %q from container %s", lines[1], dir.Name())
-			continue
+		files[attempt] = m
+	}
+	return files
+}
+
+// startupFile is the content of a startup file.
+type startupFile struct {
+	start  int64
+	end    int64
+	extras map[string]string
+}
+
+// readStartupFile reads a startup file, a partial file is re-read a few times
+// before errPartialStartupFile is returned.
+func readStartupFile(p string) (startupFile, error) {
+	for i := 0; ; i++ {
+		f, err := parseStartupFile(p)
+		if err != errPartialStartupFile || i >= partialReadRetries {
+			return f, err
 		}
-		if end == 0 {
+		clk.Sleep(partialReadBackoff)
+	}
+}
+
+// parseStartupFile parses the start and end time from the first two lines of
+// a startup file, the following lines in the form of key=value are extra
+// metadata provided by the shim.
+func parseStartupFile(p string) (startupFile, error) {
+	var f startupFile
+	bs, err := ioutil.ReadFile(p)
+	if err != nil {
+		return f, err
+	}
+	content := strings.Trim(string(bs), " \t\n")
+	lines := strings.Split(content, "\n")
+	if len(lines) < 2 {
+		return f, errPartialStartupFile
+	}
+	f.start, err = strconv.ParseInt(strings.TrimSpace(lines[0]), 10, 64)
+	if err != nil {
+		return f, errors.Wrapf(err, "invalid start time %q", lines[0])
+	}
+	f.end, err = strconv.ParseInt(strings.TrimSpace(lines[1]), 10, 64)
+	if err != nil {
+		return f, errors.Wrapf(err, "invalid end time %q", lines[1])
+	}
+	if f.end == 0 {
+		return f, errPartialStartupFile
+	}
+	for _, line := range lines[2:] {
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
 			continue
 		}
-		t := typeDefault
-		if _, err := os.Stat(path.Join(namespace, dir.Name(), "work", "restore.log")); err == nil {
-			t = typeCheckpoint
+		if f.extras == nil {
+			f.extras = map[string]string{}
 		}
-		info = append(info, containerStartupInfo{
-			Name:      dir.Name(),
-			Namespace: namespace,
-			Start:     int64(start),
-			End:       int64(end),
-			Type:      t,
-		})
+		f.extras[kv[0]] = kv[1]
 	}
-	return info
+	return f, nil
 }
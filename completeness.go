@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// minSamplesAnnotation sets how many containers of a workload, as a number or
+// a percentage, must be received before its metrics are published.
+const minSamplesAnnotation = "startup-exporter.io/min-samples"
+
+// minSamples returns the number of containers of the workload which must be
+// received out of total, all of them unless the workload is annotated.
+func minSamples(w metav1.Object, total int) int {
+	v, ok := w.GetAnnotations()[minSamplesAnnotation]
+	if !ok {
+		return total
+	}
+	value := intstr.Parse(v)
+	n, err := intstr.GetValueFromIntOrPercent(&value, total, true)
+	if err != nil || n < 0 {
+		logrus.WithError(err).Errorf("invalid annotation %s=%q of %s(%s)", minSamplesAnnotation, v, w.GetName(), w.GetNamespace())
+		return total
+	}
+	if n > total {
+		return total
+	}
+	return n
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+)
+
+var (
+	projectAvgStartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemProject,
+			Name:      "average_startup_latency_milliseconds",
+		},
+		[]string{
+			"project",
+			"namespace",
+		},
+	)
+	projectServiceAvgStartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemProject,
+			Name:      "service_average_startup_latency_milliseconds",
+		},
+		[]string{
+			"project",
+			"service",
+			"namespace",
+		},
+	)
+)
+
+// composeExtras adds the compose project and service of a container found in
+// the annotations of its bundle to its extras, extras set by the shim take
+// precedence. nerdctl compose and docker compose label containers with them.
+func composeExtras(annotations, extras map[string]string) map[string]string {
+	for _, k := range []string{composeProjectLabel, composeServiceLabel} {
+		v, ok := annotations[k]
+		if !ok {
+			continue
+		}
+		if _, set := extras[k]; set {
+			continue
+		}
+		if extras == nil {
+			extras = map[string]string{}
+		}
+		extras[k] = v
+	}
+	return extras
+}
+
+// exportProjects sets the average startup latency of the containers of every
+// compose project and of every service of it, like the deployment averages
+// for containers not run by Kubernetes.
+func exportProjects() {
+	type project struct {
+		project, service, namespace string
+	}
+	type average struct {
+		total float64
+		count int
+	}
+	projects := map[project]*average{}
+	services := map[project]*average{}
+	add := func(m map[project]*average, p project, latency float64) {
+		a, exists := m[p]
+		if !exists {
+			a = &average{}
+			m[p] = a
+		}
+		a.total += latency
+		a.count++
+	}
+	mu.Lock()
+	allInfo.each(func(_ meta, r startupRecord) {
+		name := r.Extras[composeProjectLabel]
+		if name == "" {
+			return
+		}
+		add(projects, project{project: name, namespace: r.Namespace}, r.milliseconds())
+		if service := r.Extras[composeServiceLabel]; service != "" {
+			add(services, project{project: name, service: service, namespace: r.Namespace}, r.milliseconds())
+		}
+	})
+	mu.Unlock()
+	projectAvgStartupLatency.Reset()
+	projectServiceAvgStartupLatency.Reset()
+	for p, a := range projects {
+		projectAvgStartupLatency.WithLabelValues(p.project, p.namespace).Set(a.total / float64(a.count))
+	}
+	for p, a := range services {
+		projectServiceAvgStartupLatency.WithLabelValues(p.project, p.service, p.namespace).Set(a.total / float64(a.count))
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+// applyConfig sets the flags of the command from a JSON object keyed by the
+// flag names, e.g. {"buckets": [50, 100, 250], "sidecar": ["istio-proxy"]}.
+// An array sets a slice flag once per element and other flags to its
+// elements joined by commas, flags given on the command line are kept.
+func applyConfig(context *cli.Context, path string) error {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(bs, &config); err != nil {
+		return err
+	}
+	slices := map[string]bool{}
+	for _, f := range context.Command.Flags {
+		switch f.(type) {
+		case cli.StringSliceFlag, cli.IntSliceFlag, cli.Int64SliceFlag:
+			for _, name := range strings.Split(f.GetName(), ",") {
+				slices[strings.TrimSpace(name)] = true
+			}
+		}
+	}
+	for name, v := range config {
+		if context.IsSet(name) {
+			continue
+		}
+		var values []string
+		if elements, ok := v.([]interface{}); ok {
+			for _, e := range elements {
+				values = append(values, fmt.Sprint(e))
+			}
+			if !slices[name] {
+				values = []string{strings.Join(values, ",")}
+			}
+		} else {
+			values = []string{fmt.Sprint(v)}
+		}
+		for _, value := range values {
+			if err := context.Set(name, value); err != nil {
+				return errors.Wrapf(err, "invalid value of %s", name)
+			}
+		}
+	}
+	return nil
+}
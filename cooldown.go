@@ -0,0 +1,92 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// measurementCooldown keeps a deployment from being measured again for a
+// while after a measurement is published if its pods haven't changed, so
+// resyncs of the informers don't repeat the same measurement. The gauges of
+// the deployment are republished from the last measurement meanwhile, since
+// they are reset on every update. Records of the same containers arriving
+// meanwhile are taken after the window.
+type measurementCooldown struct {
+	sync.Mutex
+	window time.Duration
+	last   map[deployKey]publishedMeasurement
+}
+
+type publishedMeasurement struct {
+	at       time.Time
+	snapshot string
+	// republish sets the gauges of the deployment to the published values
+	republish func()
+}
+
+var cooldown = measurementCooldown{
+	last: map[deployKey]publishedMeasurement{},
+}
+
+// podSetSnapshot identifies the pods of a deployment and their containers,
+// a restarted container has a different ID.
+func podSetSnapshot(pods []*corev1.Pod) string {
+	var ids []string
+	for _, p := range pods {
+		if p == nil {
+			continue
+		}
+		for _, status := range p.Status.ContainerStatuses {
+			ids = append(ids, string(p.UID)+"/"+status.ContainerID)
+		}
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+// skip republishes the last measurement of the deployment and returns true if
+// it's within the window and the pods are the same.
+func (c *measurementCooldown) skip(k deployKey, pods []*corev1.Pod) bool {
+	if c.window <= 0 {
+		return false
+	}
+	c.Lock()
+	m, exists := c.last[k]
+	c.Unlock()
+	if !exists || clk.Since(m.at) > c.window || m.snapshot != podSetSnapshot(pods) {
+		return false
+	}
+	m.republish()
+	return true
+}
+
+// published records a measurement of the deployment published from the pods.
+func (c *measurementCooldown) published(k deployKey, pods []*corev1.Pod, republish func()) {
+	if c.window <= 0 {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.last[k] = publishedMeasurement{at: clk.Now(), snapshot: podSetSnapshot(pods), republish: republish}
+}
+
+// prune forgets the deployments which don't exist anymore.
+func (c *measurementCooldown) prune(existing map[deployKey]struct{}) {
+	c.Lock()
+	defer c.Unlock()
+	for k := range c.last {
+		if _, exists := existing[k]; !exists {
+			delete(c.last, k)
+		}
+	}
+}
+
+func (c *measurementCooldown) reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.last = map[deployKey]publishedMeasurement{}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	criContainerTypeAnnotation    = "io.kubernetes.cri.container-type"
+	criContainerNameAnnotation    = "io.kubernetes.cri.container-name"
+	criSandboxNameAnnotation      = "io.kubernetes.cri.sandbox-name"
+	criSandboxNamespaceAnnotation = "io.kubernetes.cri.sandbox-namespace"
+	criImageNameAnnotation        = "io.kubernetes.cri.image-name"
+)
+
+type bundleSpec struct {
+	Annotations map[string]string `json:"annotations"`
+}
+
+// bundleAnnotations returns the annotations of the OCI spec in the bundle dir,
+// it returns nil if the spec can't be read.
+func bundleAnnotations(bundle string) map[string]string {
+	bs, err := ioutil.ReadFile(path.Join(bundle, "config.json"))
+	if err != nil {
+		return nil
+	}
+	var spec bundleSpec
+	if err := json.Unmarshal(bs, &spec); err != nil {
+		return nil
+	}
+	return spec.Annotations
+}
+
+// criPod returns the pod a container belongs to according to the CRI
+// annotations of its bundle.
+func criPod(annotations map[string]string) (string, string) {
+	return annotations[criSandboxNameAnnotation], annotations[criSandboxNamespaceAnnotation]
+}
+
+// criImage returns the image of a container according to the CRI annotations
+// of its bundle.
+func criImage(annotations map[string]string) string {
+	return annotations[criImageNameAnnotation]
+}
+
+// podFields resolves the pod which a container belongs to from the CRI
+// annotations in its bundle, so log lines of the collector can be correlated
+// with pods.
+func podFields(bundle, id string) logrus.Fields {
+	fields := logrus.Fields{
+		"id": containerShortName(id),
+	}
+	annotations := bundleAnnotations(bundle)
+	if name, ok := annotations[criSandboxNameAnnotation]; ok {
+		fields["pod"] = name
+		fields["pod_namespace"] = annotations[criSandboxNamespaceAnnotation]
+	}
+	if name, ok := annotations[criContainerNameAnnotation]; ok {
+		fields["container"] = name
+	} else if annotations[criContainerTypeAnnotation] == "sandbox" {
+		fields["container"] = "sandbox"
+	}
+	return fields
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	customMetricsGroupVersion = "custom.metrics.k8s.io/v1beta1"
+	customMetricsPrefix       = "/apis/" + customMetricsGroupVersion
+
+	customMetricStartupLatency = "startup_latency_milliseconds"
+	customMetricScaleLatency   = "scale_latency_milliseconds"
+
+	// extensionAuthConfigMap in kube-system holds the client CA the API
+	// server proxies requests to extension API servers with
+	extensionAuthConfigMap = "extension-apiserver-authentication"
+	// accessReviewTTL is how long the decision of a SubjectAccessReview is
+	// cached
+	accessReviewTTL = 10 * time.Second
+)
+
+// customMetrics serves the custom metrics API for the deployments of the
+// cluster the exporter runs in, so the startup latency can be consumed by
+// horizontal pod autoscalers through the API aggregation layer. Requests
+// must come from the API server, which is verified by its front proxy client
+// certificate, and the user it proxies for is authorized by the cluster.
+type customMetrics struct {
+	cluster *cluster
+	auth    *requestHeaderAuth
+
+	mu       sync.Mutex
+	reviewed map[string]reviewedAccess
+}
+
+type reviewedAccess struct {
+	allowed bool
+	expires time.Time
+}
+
+// requestHeaderAuth is the requestheader configuration of the API server
+// from the extension-apiserver-authentication configmap.
+type requestHeaderAuth struct {
+	clientCAs *x509.CertPool
+	// allowedNames are the common names the client certificate may have,
+	// any name is allowed if it's empty
+	allowedNames []string
+	userHeaders  []string
+	groupHeaders []string
+}
+
+// loadRequestHeaderAuth reads the requestheader configuration of the API
+// server, which needs the exporter to be bound to the
+// extension-apiserver-authentication-reader role in kube-system.
+func loadRequestHeaderAuth(ctx context.Context, client kubernetes.Interface) (*requestHeaderAuth, error) {
+	cm, err := client.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get(ctx, extensionAuthConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get configmap %s/%s", metav1.NamespaceSystem, extensionAuthConfigMap)
+	}
+	ca := cm.Data["requestheader-client-ca-file"]
+	if ca == "" {
+		return nil, errors.Errorf("configmap %s/%s has no requestheader-client-ca-file, the API aggregation layer isn't enabled", metav1.NamespaceSystem, extensionAuthConfigMap)
+	}
+	auth := &requestHeaderAuth{clientCAs: x509.NewCertPool()}
+	if !auth.clientCAs.AppendCertsFromPEM([]byte(ca)) {
+		return nil, errors.New("invalid requestheader-client-ca-file")
+	}
+	for key, list := range map[string]*[]string{
+		"requestheader-allowed-names":    &auth.allowedNames,
+		"requestheader-username-headers": &auth.userHeaders,
+		"requestheader-group-headers":    &auth.groupHeaders,
+	} {
+		if v := cm.Data[key]; v != "" {
+			if err := json.Unmarshal([]byte(v), list); err != nil {
+				return nil, errors.Wrapf(err, "invalid %s", key)
+			}
+		}
+	}
+	if len(auth.userHeaders) == 0 {
+		auth.userHeaders = []string{"X-Remote-User"}
+	}
+	if len(auth.groupHeaders) == 0 {
+		auth.groupHeaders = []string{"X-Remote-Group"}
+	}
+	return auth, nil
+}
+
+// authenticate returns the user and the groups the API server proxies the
+// request for, it's false if the request doesn't come from the API server.
+// The client certificate itself is verified against the CA by the TLS
+// handshake.
+func (a *requestHeaderAuth) authenticate(r *http.Request) (string, []string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", nil, false
+	}
+	if len(a.allowedNames) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		allowed := false
+		for _, name := range a.allowedNames {
+			if name == cn {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "", nil, false
+		}
+	}
+	var user string
+	for _, h := range a.userHeaders {
+		if user = r.Header.Get(h); user != "" {
+			break
+		}
+	}
+	if user == "" {
+		return "", nil, false
+	}
+	var groups []string
+	for _, h := range a.groupHeaders {
+		groups = append(groups, r.Header.Values(h)...)
+	}
+	return user, groups, true
+}
+
+// authorize asks the cluster whether the user may get the path of the API,
+// the discovery on the root is a non-resource request.
+func (m *customMetrics) authorize(ctx context.Context, user string, groups []string, path string) (bool, error) {
+	spec := authorizationv1.SubjectAccessReviewSpec{User: user, Groups: groups}
+	if parts := strings.Split(strings.Trim(strings.TrimPrefix(path, customMetricsPrefix), "/"), "/"); len(parts) == 5 {
+		spec.ResourceAttributes = &authorizationv1.ResourceAttributes{
+			Namespace:   parts[1],
+			Verb:        "get",
+			Group:       "custom.metrics.k8s.io",
+			Resource:    parts[2],
+			Subresource: parts[4],
+			Name:        parts[3],
+		}
+		if parts[3] == "*" {
+			spec.ResourceAttributes.Verb = "list"
+			spec.ResourceAttributes.Name = ""
+		}
+	} else {
+		spec.NonResourceAttributes = &authorizationv1.NonResourceAttributes{Path: path, Verb: "get"}
+	}
+	key := user + "\x00" + strings.Join(groups, ",") + "\x00" + path
+	now := clk.Now()
+	m.mu.Lock()
+	reviewed, exists := m.reviewed[key]
+	m.mu.Unlock()
+	if exists && now.Before(reviewed.expires) {
+		return reviewed.allowed, nil
+	}
+	review, err := m.cluster.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{Spec: spec}, metav1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	for k, a := range m.reviewed {
+		if now.After(a.expires) {
+			delete(m.reviewed, k)
+		}
+	}
+	m.reviewed[key] = reviewedAccess{allowed: review.Status.Allowed, expires: now.Add(accessReviewTTL)}
+	m.mu.Unlock()
+	return review.Status.Allowed, nil
+}
+
+// customMetricValue is a value of the custom metrics API, the types of the
+// API are defined here so k8s.io/metrics isn't needed.
+type customMetricValue struct {
+	DescribedObject customObjectReference `json:"describedObject"`
+	MetricName      string                `json:"metricName"`
+	Timestamp       metav1.Time           `json:"timestamp"`
+	Value           resource.Quantity     `json:"value"`
+}
+
+type customObjectReference struct {
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	APIVersion string `json:"apiVersion"`
+}
+
+type customMetricValueList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []customMetricValue `json:"items"`
+}
+
+// resources lists the metrics in the discovery of the API.
+func (m *customMetrics) resources() *metav1.APIResourceList {
+	list := &metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: customMetricsGroupVersion,
+	}
+	for _, metric := range []string{customMetricStartupLatency, customMetricScaleLatency} {
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:       "deployments.apps/" + metric,
+			Namespaced: true,
+			Kind:       "MetricValueList",
+			Verbs:      []string{"get"},
+		})
+	}
+	return list
+}
+
+// value returns the value of the metric of the deployment if it's measured.
+func (m *customMetrics) value(name, namespace, metric string) (customMetricValue, bool) {
+	k := deployKey{cluster: m.cluster.name, meta: meta{name: name, namespace: namespace}}
+	deployStatuses.Lock()
+	status, exists := deployStatuses.deploys[k]
+	deployStatuses.Unlock()
+	var v float64
+	switch metric {
+	case customMetricStartupLatency:
+		if !exists {
+			return customMetricValue{}, false
+		}
+		v = status.AvgLatencyMs
+	case customMetricScaleLatency:
+		latency, ok := scales.last(k)
+		if !ok {
+			return customMetricValue{}, false
+		}
+		v = latency
+	default:
+		return customMetricValue{}, false
+	}
+	return customMetricValue{
+		DescribedObject: customObjectReference{Kind: "Deployment", Namespace: namespace, Name: name, APIVersion: "apps/v1"},
+		MetricName:      metric,
+		Timestamp:       metav1.Now(),
+		Value:           *resource.NewMilliQuantity(int64(math.Round(v*1000)), resource.DecimalSI),
+	}, true
+}
+
+// ServeHTTP serves the discovery of the API on its root and the metrics of
+// deployments on namespaces/NAMESPACE/deployments.apps/NAME/METRIC, NAME may
+// be * for the deployments matching the labelSelector parameter.
+func (m *customMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, groups, ok := m.auth.authenticate(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "requests must be proxied by the API server")
+		return
+	}
+	allowed, err := m.authorize(r.Context(), user, groups, r.URL.Path)
+	if err != nil {
+		logrus.WithError(err).Error("failed to review the access to the custom metrics API")
+		writeError(w, http.StatusInternalServerError, "failed to authorize the request")
+		return
+	}
+	if !allowed {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	p := strings.Trim(strings.TrimPrefix(r.URL.Path, customMetricsPrefix), "/")
+	if p == "" {
+		writeJSON(w, http.StatusOK, m.resources())
+		return
+	}
+	parts := strings.Split(p, "/")
+	if len(parts) != 5 || parts[0] != "namespaces" || parts[2] != "deployments.apps" {
+		writeError(w, http.StatusNotFound, "unknown metric")
+		return
+	}
+	namespace, name, metric := parts[1], parts[3], parts[4]
+	list := customMetricValueList{
+		TypeMeta: metav1.TypeMeta{Kind: "MetricValueList", APIVersion: customMetricsGroupVersion},
+		ListMeta: metav1.ListMeta{SelfLink: r.URL.Path},
+		Items:    []customMetricValue{},
+	}
+	if name != "*" {
+		v, ok := m.value(name, namespace, metric)
+		if !ok {
+			writeError(w, http.StatusNotFound, "the metric of the deployment is not measured")
+			return
+		}
+		list.Items = append(list.Items, v)
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+	selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid label selector")
+		return
+	}
+	deploys, err := m.cluster.deploymentLister.Deployments(namespace).List(selector)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, d := range deploys {
+		if v, ok := m.value(d.Name, namespace, metric); ok {
+			list.Items = append(list.Items, v)
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// serveCustomMetrics serves the custom metrics API over TLS on the address,
+// only to clients with a certificate signed by the requestheader client CA of
+// the API server. A self-signed certificate is used if no certificate is
+// given, which the APIService can't verify.
+func serveCustomMetrics(addr, certFile, keyFile string, c *cluster) error {
+	auth, err := loadRequestHeaderAuth(context.Background(), c.client)
+	if err != nil {
+		return err
+	}
+	m := &customMetrics{cluster: c, auth: auth, reviewed: map[string]reviewedAccess{}}
+	mux := http.NewServeMux()
+	mux.Handle(customMetricsPrefix, m)
+	mux.Handle(customMetricsPrefix+"/", m)
+	svr := &http.Server{Addr: addr, Handler: mux, TLSConfig: &tls.Config{
+		ClientCAs:  auth.clientCAs,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}}
+	if certFile != "" {
+		return svr.ListenAndServeTLS(certFile, keyFile)
+	}
+	certPEM, keyPEM, err := servingCertificate([]string{"startup-exporter"}, time.Now().AddDate(1, 0, 0))
+	if err != nil {
+		return errors.Wrap(err, "failed to create a self-signed certificate")
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	svr.TLSConfig.Certificates = []tls.Certificate{cert}
+	return svr.ListenAndServeTLS("", "")
+}
+
+// servingCertificate creates a self-signed certificate for the hosts, which
+// is its own CA, so it's also the caBundle of the APIService.
+func servingCertificate(hosts []string, notAfter time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0]},
+		DNSNames:              hosts,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
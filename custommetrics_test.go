@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func frontProxyCertificate(t *testing.T, cn string) (string, *x509.Certificate) {
+	certPEM, _, err := servingCertificate([]string{cn}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(certPEM), cert
+}
+
+func TestCustomMetricsAuth(t *testing.T) {
+	ca, cert := frontProxyCertificate(t, "front-proxy-client")
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: extensionAuthConfigMap, Namespace: metav1.NamespaceSystem},
+		Data: map[string]string{
+			"requestheader-client-ca-file":   ca,
+			"requestheader-allowed-names":    `["front-proxy-client"]`,
+			"requestheader-username-headers": `["X-Remote-User"]`,
+		},
+	})
+	var reviewed []authorizationv1.SubjectAccessReviewSpec
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		reviewed = append(reviewed, review.Spec)
+		review.Status.Allowed = review.Spec.User == "system:serviceaccount:kube-system:horizontal-pod-autoscaler"
+		return true, review, nil
+	})
+	auth, err := loadRequestHeaderAuth(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: auth.clientCAs, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		t.Fatalf("the client CA doesn't verify the front proxy: %v", err)
+	}
+	m := &customMetrics{cluster: &cluster{client: client}, auth: auth, reviewed: map[string]reviewedAccess{}}
+	request := func(user string, proxied bool) int {
+		r := httptest.NewRequest(http.MethodGet, customMetricsPrefix, nil)
+		r.TLS = &tls.ConnectionState{}
+		if proxied {
+			r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+		}
+		if user != "" {
+			r.Header.Set("X-Remote-User", user)
+		}
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := request("system:serviceaccount:kube-system:horizontal-pod-autoscaler", false); code != http.StatusUnauthorized {
+		t.Errorf("got %d without a client certificate", code)
+	}
+	if code := request("", true); code != http.StatusUnauthorized {
+		t.Errorf("got %d without a user", code)
+	}
+	if code := request("mallory", true); code != http.StatusForbidden {
+		t.Errorf("got %d for an unauthorized user", code)
+	}
+	if code := request("system:serviceaccount:kube-system:horizontal-pod-autoscaler", true); code != http.StatusOK {
+		t.Errorf("got %d for the autoscaler", code)
+	}
+	if len(reviewed) != 2 || reviewed[1].NonResourceAttributes == nil || reviewed[1].NonResourceAttributes.Path != customMetricsPrefix {
+		t.Errorf("reviewed %+v, want the discovery as a non-resource request", reviewed)
+	}
+	request("system:serviceaccount:kube-system:horizontal-pod-autoscaler", true)
+	if len(reviewed) != 2 {
+		t.Errorf("the decision isn't cached")
+	}
+
+	auth.allowedNames = []string{"aggregator"}
+	if code := request("system:serviceaccount:kube-system:horizontal-pod-autoscaler", true); code != http.StatusUnauthorized {
+		t.Errorf("got %d for a certificate with a name that isn't allowed", code)
+	}
+}
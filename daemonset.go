@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const kindDaemonSet = "DaemonSet"
+
+// daemonSetScales measures the roll-outs of daemon sets across nodes, a scale
+// event opens when the daemon set is created, lands on new nodes or gets a
+// new template and stays open until the pods of all the nodes are running.
+var daemonSetScales = newScaleTracker(kindDaemonSet)
+
+// updateDaemonSets measures the daemon sets of the clusters.
+func updateDaemonSets(clusters []*cluster) {
+	var (
+		sets     = map[*cluster][]*appsv1.DaemonSet{}
+		existing = map[deployKey]struct{}{}
+		listed   = true
+	)
+	for _, c := range clusters {
+		ds, err := c.daemonSetLister.List(labels.Everything())
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to list daemon sets in the cluster %s", c.name)
+			listed = false
+			continue
+		}
+		for _, d := range ds {
+			existing[deployKey{cluster: c.name, meta: meta{name: d.Name, namespace: d.Namespace}}] = struct{}{}
+			sets[c] = append(sets[c], d)
+		}
+	}
+	if listed {
+		daemonSetScales.prune(existing)
+		smoother.prune(kindDaemonSet, existing)
+	}
+	for _, c := range clusters {
+		for _, d := range sets[c] {
+			c.updateDaemonSet(d)
+		}
+	}
+	daemonSetScales.export()
+}
+
+func (c *cluster) updateDaemonSet(d *appsv1.DaemonSet) {
+	if d.Spec.Selector == nil {
+		logrus.Errorf("daemon set %s from %s has an empty selector", d.Name, d.Namespace)
+		return
+	}
+	pods, err := c.podLister.Pods(d.Namespace).List(makeSelector(*d.Spec.Selector))
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to list pods belongs to %s", d.Name)
+		return
+	}
+	pods = controlledPods(d, pods)
+	// the status of a daemon set doesn't carry its current revision, its
+	// generation changes with the template instead, the counts in the status
+	// are stale until the controller observes the generation
+	if d.Status.ObservedGeneration == d.Generation {
+		key := scaleKey{
+			deployKey: deployKey{cluster: c.name, meta: meta{name: d.Name, namespace: d.Namespace}},
+			hash:      strconv.FormatInt(d.Generation, 10),
+			replicas:  d.Status.DesiredNumberScheduled,
+		}
+		outdated := int(d.Status.DesiredNumberScheduled - d.Status.UpdatedNumberScheduled)
+		daemonSetScales.trackRevision(c, key, d.CreationTimestamp.Time, pods, outdated)
+	}
+	updateWorkload(c, kindDaemonSet, d, pods)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dataExportSchemaVersion = 1
+
+	dataKindRecords      = "records"
+	dataKindMeasurements = "measurements"
+
+	dataFormatJSON = "json"
+	dataFormatCSV  = "csv"
+)
+
+// dataField is a column of the exported rows, Type is the JSON type and
+// Dtype the pandas dtype the column is loaded as.
+type dataField struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Dtype    string `json:"dtype"`
+	Nullable bool   `json:"nullable,omitempty"`
+}
+
+// dataSchemas describe the rows of the data exports, they must be updated
+// with recordRow and measurementRow. Timestamps are RFC 3339 strings with
+// nanoseconds in UTC, which pandas parses as datetime64[ns, UTC].
+var dataSchemas = map[string][]dataField{
+	dataKindRecords: {
+		{Name: "name", Type: "string", Dtype: "string"},
+		{Name: "namespace", Type: "string", Dtype: "string"},
+		{Name: "type", Type: "string", Dtype: "category"},
+		{Name: "attempt", Type: "integer", Dtype: "int64"},
+		{Name: "start", Type: "string", Dtype: "datetime64[ns, UTC]"},
+		{Name: "end", Type: "string", Dtype: "datetime64[ns, UTC]"},
+		{Name: "latency_ms", Type: "number", Dtype: "float64"},
+		{Name: "received", Type: "string", Dtype: "datetime64[ns, UTC]"},
+		{Name: "node", Type: "string", Dtype: "string", Nullable: true},
+		{Name: "pod", Type: "string", Dtype: "string", Nullable: true},
+		{Name: "pod_namespace", Type: "string", Dtype: "string", Nullable: true},
+		{Name: "image", Type: "string", Dtype: "string", Nullable: true},
+		{Name: "snapshot", Type: "string", Dtype: "category", Nullable: true},
+		{Name: "extras", Type: "object", Dtype: "object", Nullable: true},
+		{Name: "request_id", Type: "string", Dtype: "string", Nullable: true},
+	},
+	dataKindMeasurements: {
+		{Name: "kind", Type: "string", Dtype: "category"},
+		{Name: "workload", Type: "string", Dtype: "category", Nullable: true},
+		{Name: "cluster", Type: "string", Dtype: "string", Nullable: true},
+		{Name: "namespace", Type: "string", Dtype: "string"},
+		{Name: "deployment", Type: "string", Dtype: "string"},
+		{Name: "replicas", Type: "integer", Dtype: "int64"},
+		{Name: "pods", Type: "integer", Dtype: "int64"},
+		{Name: "latency_ms", Type: "number", Dtype: "float64"},
+		{Name: "time", Type: "string", Dtype: "datetime64[ns, UTC]"},
+		{Name: "tags", Type: "object", Dtype: "object", Nullable: true},
+		{Name: "strategy", Type: "string", Dtype: "category", Nullable: true},
+		{Name: "max_surge", Type: "string", Dtype: "category", Nullable: true},
+		{Name: "max_unavailable", Type: "string", Dtype: "category", Nullable: true},
+	},
+}
+
+// recordRow is a startup record as a flat row of a data export.
+type recordRow struct {
+	Name         string            `json:"name"`
+	Namespace    string            `json:"namespace"`
+	Type         string            `json:"type"`
+	Attempt      int               `json:"attempt"`
+	Start        string            `json:"start"`
+	End          string            `json:"end"`
+	LatencyMs    float64           `json:"latency_ms"`
+	Received     string            `json:"received"`
+	Node         *string           `json:"node"`
+	Pod          *string           `json:"pod"`
+	PodNamespace *string           `json:"pod_namespace"`
+	Image        *string           `json:"image"`
+	Snapshot     *string           `json:"snapshot"`
+	Extras       map[string]string `json:"extras"`
+	RequestID    *string           `json:"request_id"`
+}
+
+// measurementRow is a measurement as a flat row of a data export.
+type measurementRow struct {
+	Kind       string            `json:"kind"`
+	Workload   *string           `json:"workload"`
+	Cluster    *string           `json:"cluster"`
+	Namespace  string            `json:"namespace"`
+	Deployment string            `json:"deployment"`
+	Replicas   int32             `json:"replicas"`
+	Pods       int               `json:"pods"`
+	LatencyMs  float64           `json:"latency_ms"`
+	Time       string            `json:"time"`
+	Tags       map[string]string `json:"tags"`
+	// Strategy, MaxSurge and MaxUnavailable are null but for the scale
+	// measurements of deployments
+	Strategy       *string `json:"strategy"`
+	MaxSurge       *string `json:"max_surge"`
+	MaxUnavailable *string `json:"max_unavailable"`
+}
+
+func formatDataTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// nullable returns nil for an empty string, so it's null in the row.
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func newRecordRow(r startupRecord) recordRow {
+	return recordRow{
+		Name:         r.Name,
+		Namespace:    r.Namespace,
+		Type:         r.Type,
+		Attempt:      r.Attempt,
+		Start:        formatDataTime(time.Unix(0, r.Start)),
+		End:          formatDataTime(time.Unix(0, r.End)),
+		LatencyMs:    r.milliseconds(),
+		Received:     formatDataTime(r.Received),
+		Node:         nullable(r.Node),
+		Pod:          nullable(r.Pod),
+		PodNamespace: nullable(r.PodNamespace),
+		Image:        nullable(r.Image),
+		Snapshot:     nullable(r.Snapshot),
+		Extras:       r.Extras,
+		RequestID:    nullable(r.RequestID),
+	}
+}
+
+func newMeasurementRow(m measurement) measurementRow {
+	return measurementRow{
+		Kind:           m.Kind,
+		Workload:       nullable(m.Workload),
+		Cluster:        nullable(m.Cluster),
+		Namespace:      m.Namespace,
+		Deployment:     m.Deployment,
+		Replicas:       m.Replicas,
+		Pods:           m.Pods,
+		LatencyMs:      m.LatencyMs,
+		Time:           formatDataTime(m.Time),
+		Tags:           m.Tags,
+		Strategy:       nullable(m.Strategy),
+		MaxSurge:       nullable(m.MaxSurge),
+		MaxUnavailable: nullable(m.MaxUnavailable),
+	}
+}
+
+// csvCell formats a value of a row decoded from JSON as a CSV cell, null is
+// empty and objects are kept as JSON.
+func csvCell(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	bs, err := json.Marshal(v)
+	return string(bs), err
+}
+
+// writeDataCSV writes the rows as CSV with a header of the columns of the
+// schema of the kind.
+func writeDataCSV(w http.ResponseWriter, kind string, rows []interface{}) error {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+kind+".csv\"")
+	w.Header().Set("X-Schema-Version", strconv.Itoa(dataExportSchemaVersion))
+	fields := dataSchemas[kind]
+	cw := csv.NewWriter(w)
+	record := make([]string, len(fields))
+	for i, f := range fields {
+		record[i] = f.Name
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		bs, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		var columns map[string]interface{}
+		if err := json.Unmarshal(bs, &columns); err != nil {
+			return err
+		}
+		for i, f := range fields {
+			if record[i], err = csvCell(columns[f.Name]); err != nil {
+				return err
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// handleDataExport writes the startup records the exporter retains, or the
+// records or measurements of the session parameter, as JSON lines with GET on
+// /api/v1/export?kind=records|measurements, or as CSV for spreadsheets with
+// format=csv. The columns are described by GET on /api/v1/export/schema,
+// e.g. for pandas:
+//
+//	schema = requests.get(f"{url}/api/v1/export/schema").json()["records"]
+//	df = pd.read_json(f"{url}/api/v1/export?kind=records", lines=True,
+//	                  dtype={f["name"]: f["dtype"] for f in schema})
+func handleDataExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	kind, name := r.URL.Query().Get("kind"), r.URL.Query().Get("session")
+	if kind == "" {
+		kind = dataKindRecords
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = dataFormatJSON
+	}
+	if format != dataFormatJSON && format != dataFormatCSV {
+		writeError(w, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+	var rows []interface{}
+	switch {
+	case kind != dataKindRecords && kind != dataKindMeasurements:
+		writeError(w, http.StatusBadRequest, "kind must be records or measurements")
+		return
+	case name != "":
+		sessions.Lock()
+		sess, exists := sessions.sessions[name]
+		if exists && kind == dataKindRecords {
+			for _, record := range sess.Records {
+				rows = append(rows, newRecordRow(record))
+			}
+		} else if exists {
+			for _, m := range sess.Measurements {
+				rows = append(rows, newMeasurementRow(m))
+			}
+		}
+		sessions.Unlock()
+		if !exists {
+			writeError(w, http.StatusNotFound, "session not found")
+			return
+		}
+	case kind == dataKindRecords:
+		mu.Lock()
+		allInfo.each(func(_ meta, record startupRecord) {
+			rows = append(rows, newRecordRow(record))
+		})
+		mu.Unlock()
+	default:
+		writeError(w, http.StatusBadRequest, "measurements are exported of a session only")
+		return
+	}
+	if format == dataFormatCSV {
+		if err := writeDataCSV(w, kind, rows); err != nil {
+			logrus.WithError(err).Error("failed to write the data export")
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Schema-Version", strconv.Itoa(dataExportSchemaVersion))
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			logrus.WithError(err).Error("failed to write the data export")
+			return
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		logrus.WithError(err).Error("failed to write the data export")
+	}
+}
+
+// handleDataExportSchema writes the schemas of the data exports.
+func handleDataExportSchema(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"version":            dataExportSchemaVersion,
+		dataKindRecords:      dataSchemas[dataKindRecords],
+		dataKindMeasurements: dataSchemas[dataKindMeasurements],
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+)
+
+// pendingDeployment is a deployment waiting for the startup info of its
+// containers, Missing names the containers of its pods without a startup
+// record as pod/container.
+type pendingDeployment struct {
+	Cluster   string   `json:"cluster,omitempty"`
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Missing   []string `json:"missing"`
+}
+
+type debugState struct {
+	exporterState
+	Draining bool                `json:"draining"`
+	Pending  []pendingDeployment `json:"pending"`
+}
+
+// handleDebugState dumps the startup records, the published measurements and
+// the deployments waiting for startup info with GET on /debug/state, to find
+// out why the metrics of a deployment are never updated.
+func handleDebugState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	dump := debugState{exporterState: currentState(), Pending: []pendingDeployment{}}
+	drain.Lock()
+	dump.Draining = drain.draining
+	var pending []deployKey
+	for k := range drain.pending {
+		pending = append(pending, k)
+	}
+	drain.Unlock()
+	for _, k := range pending {
+		p := pendingDeployment{Cluster: k.cluster, Namespace: k.namespace, Name: k.name, Missing: []string{}}
+		if c := experiments.cluster(k.cluster); c != nil {
+			pods, _, _, err := podDetails(c, k)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			for _, pod := range pods {
+				for _, container := range pod.Containers {
+					if container.Missing {
+						p.Missing = append(p.Missing, pod.Name+"/"+container.Name)
+					}
+				}
+			}
+		}
+		dump.Pending = append(dump.Pending, p)
+	}
+	sort.Slice(dump.Pending, func(i, j int) bool {
+		a, b := dump.Pending[i], dump.Pending[j]
+		return a.Cluster+"/"+a.Namespace+"/"+a.Name < b.Cluster+"/"+b.Namespace+"/"+b.Name
+	})
+	writeJSON(w, http.StatusOK, dump)
+}
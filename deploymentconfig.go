@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	kindDeploymentConfig = "DeploymentConfig"
+	// deploymentConfigAnnotation is set on the pods of a deployment config
+	// to its name
+	deploymentConfigAnnotation = "openshift.io/deployment-config.name"
+	// deployerPodLabel is set on the pods which roll out a deployment config
+	deployerPodLabel = "openshift.io/deployer-pod-for.name"
+)
+
+var (
+	// openShift enables measuring the deployment configs of OpenShift
+	openShift bool
+
+	deploymentConfigResource = schema.GroupVersionResource{Group: "apps.openshift.io", Version: "v1", Resource: "deploymentconfigs"}
+	// deploymentConfigScales measures the scale events of deployment configs,
+	// a new version of a deployment config is a new revision
+	deploymentConfigScales = newScaleTracker(kindDeploymentConfig)
+)
+
+// deploymentConfig holds the fields of a deployment config of OpenShift the
+// exporter needs, so the OpenShift API types aren't needed.
+type deploymentConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		Replicas int32             `json:"replicas"`
+		Selector map[string]string `json:"selector,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		LatestVersion int64 `json:"latestVersion"`
+	} `json:"status"`
+}
+
+// watchDeploymentConfigs makes the clusters watch deployment configs, it's
+// called before the informers start.
+func watchDeploymentConfigs(clusters []*cluster) {
+	for _, c := range clusters {
+		c.deploymentConfigLister = c.dynamicFactory.ForResource(deploymentConfigResource).Lister()
+	}
+}
+
+// updateDeploymentConfigs measures the deployment configs of the clusters.
+func updateDeploymentConfigs(clusters []*cluster) {
+	var (
+		configs  = map[*cluster][]*deploymentConfig{}
+		existing = map[deployKey]struct{}{}
+		listed   = true
+	)
+	for _, c := range clusters {
+		objs, err := c.deploymentConfigLister.List(labels.Everything())
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to list deployment configs in the cluster %s", c.name)
+			listed = false
+			continue
+		}
+		for _, obj := range objs {
+			u, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			dc := &deploymentConfig{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, dc); err != nil {
+				logrus.WithError(err).Errorf("invalid deployment config %s(%s)", u.GetName(), u.GetNamespace())
+				continue
+			}
+			existing[deployKey{cluster: c.name, meta: meta{name: dc.Name, namespace: dc.Namespace}}] = struct{}{}
+			configs[c] = append(configs[c], dc)
+		}
+	}
+	if listed {
+		deploymentConfigScales.prune(existing)
+		smoother.prune(kindDeploymentConfig, existing)
+	}
+	for _, c := range clusters {
+		for _, dc := range configs[c] {
+			c.updateDeploymentConfig(dc)
+		}
+	}
+	deploymentConfigScales.export()
+}
+
+func (c *cluster) updateDeploymentConfig(dc *deploymentConfig) {
+	if len(dc.Spec.Selector) == 0 {
+		logrus.Errorf("deployment config %s from %s has an empty selector", dc.Name, dc.Namespace)
+		return
+	}
+	selected, err := c.podLister.Pods(dc.Namespace).List(labels.SelectorFromSet(dc.Spec.Selector))
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to list pods belongs to %s", dc.Name)
+		return
+	}
+	// the pods are controlled by the replication controllers of the
+	// versions of the deployment config, the deployer pods aren't part of it
+	var pods []*corev1.Pod
+	for _, p := range selected {
+		if p.Annotations[deploymentConfigAnnotation] != dc.Name {
+			continue
+		}
+		if _, deployer := p.Labels[deployerPodLabel]; deployer {
+			continue
+		}
+		pods = append(pods, p)
+	}
+	key := scaleKey{
+		deployKey: deployKey{cluster: c.name, meta: meta{name: dc.Name, namespace: dc.Namespace}},
+		hash:      strconv.FormatInt(dc.Status.LatestVersion, 10),
+		replicas:  dc.Spec.Replicas,
+	}
+	deploymentConfigScales.trackKey(c, key, dc.CreationTimestamp.Time, pods)
+	updateWorkload(c, kindDeploymentConfig, dc, pods)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// deploymentStatus is the last published measurement of a deployment.
+type deploymentStatus struct {
+	Cluster        string    `json:"cluster,omitempty"`
+	Namespace      string    `json:"namespace"`
+	Name           string    `json:"name"`
+	AvgLatencyMs   float64   `json:"avgLatencyMs"`
+	Samples        int       `json:"samples"`
+	ScaleLatencyMs *float64  `json:"scaleLatencyMs,omitempty"`
+	Updated        time.Time `json:"updated"`
+}
+
+type deploymentStore struct {
+	sync.Mutex
+	deploys map[deployKey]deploymentStatus
+}
+
+var deployStatuses = deploymentStore{
+	deploys: map[deployKey]deploymentStatus{},
+}
+
+// update records the average startup latency published for the deployment,
+// it reports whether the average or the samples changed.
+func (s *deploymentStore) update(k deployKey, samples int, avg float64) (deploymentStatus, bool) {
+	s.Lock()
+	defer s.Unlock()
+	last, exists := s.deploys[k]
+	status := deploymentStatus{
+		Cluster:      k.cluster,
+		Namespace:    k.namespace,
+		Name:         k.name,
+		AvgLatencyMs: avg,
+		Samples:      samples,
+		Updated:      clk.Now(),
+	}
+	s.deploys[k] = status
+	return status, !exists || last.Samples != samples || last.AvgLatencyMs != avg
+}
+
+// prune forgets the deployments which don't exist anymore.
+func (s *deploymentStore) prune(existing map[deployKey]struct{}) {
+	s.Lock()
+	defer s.Unlock()
+	for k := range s.deploys {
+		if _, exists := existing[k]; !exists {
+			delete(s.deploys, k)
+		}
+	}
+}
+
+func (s *deploymentStore) reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.deploys = map[deployKey]deploymentStatus{}
+}
+
+// containerDetail is the startup of a container of a pod, it's missing if
+// the exporter has no startup record of it, which keeps the deployment from
+// being measured.
+type containerDetail struct {
+	Name      string   `json:"name"`
+	Sidecar   bool     `json:"sidecar,omitempty"`
+	Type      string   `json:"type,omitempty"`
+	LatencyMs *float64 `json:"latencyMs,omitempty"`
+	Missing   bool     `json:"missing,omitempty"`
+	// Reason tells why a container is missing
+	Reason string `json:"reason,omitempty"`
+}
+
+type podDetail struct {
+	Name       string            `json:"name"`
+	Node       string            `json:"node,omitempty"`
+	Phase      string            `json:"phase"`
+	Containers []containerDetail `json:"containers"`
+}
+
+// deploymentDetail is the published measurement of a deployment with the
+// startups of the containers of its current pods.
+type deploymentDetail struct {
+	deploymentStatus
+	Measured          bool        `json:"measured"`
+	Pods              []podDetail `json:"pods"`
+	MissingContainers int         `json:"missingContainers"`
+}
+
+// newPodDetail looks up the startup records of the containers of the pod, it
+// must be called with mu held.
+func newPodDetail(p *corev1.Pod) podDetail {
+	pod := podDetail{Name: p.Name, Node: p.Spec.NodeName, Phase: string(p.Status.Phase), Containers: []containerDetail{}}
+	for _, status := range p.Status.ContainerStatuses {
+		c := containerDetail{Name: status.Name, Sidecar: isSidecar(status.Name, status.Image)}
+		switch {
+		case status.ContainerID == "":
+			c.Missing, c.Reason = true, "not started"
+			if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+				c.Reason = status.State.Waiting.Reason
+			}
+		case !strings.HasPrefix(status.ContainerID, containerNamePrefix):
+			c.Missing, c.Reason = true, "not run by containerd"
+		default:
+			name := strings.TrimPrefix(status.ContainerID, containerNamePrefix)
+			if info, exists := podContainer(name); exists {
+				latency := info.milliseconds()
+				c.Type, c.LatencyMs = info.Type, &latency
+			} else if verifier.mismatched(meta{name: name, namespace: defaultContainerdK8sNamespace}) {
+				c.Missing, c.Reason = true, "belongs to another pod"
+			} else {
+				c.Missing, c.Reason = true, "no startup info"
+			}
+		}
+		pod.Containers = append(pod.Containers, c)
+	}
+	return pod
+}
+
+// podDetails returns the current pods of the deployment of the cluster and
+// the number of their missing containers, exists is false if the deployment
+// doesn't exist.
+func podDetails(c *cluster, k deployKey) ([]podDetail, int, bool, error) {
+	pods := []podDetail{}
+	d, err := c.deploymentLister.Deployments(k.namespace).Get(k.name)
+	if apierrors.IsNotFound(err) {
+		return pods, 0, false, nil
+	}
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if d.Spec.Selector == nil {
+		return pods, 0, true, nil
+	}
+	current, err := c.podLister.Pods(k.namespace).List(makeSelector(*d.Spec.Selector))
+	if err != nil {
+		return nil, 0, false, err
+	}
+	missing := 0
+	mu.Lock()
+	for _, p := range c.owners.ownedBy(k.meta, current) {
+		pod := newPodDetail(p)
+		for _, container := range pod.Containers {
+			if container.Missing {
+				missing++
+			}
+		}
+		pods = append(pods, pod)
+	}
+	mu.Unlock()
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+	return pods, missing, true, nil
+}
+
+// getDeployment serves the detail of a deployment of the cluster parameter,
+// the pods are left out if the exporter doesn't watch the cluster.
+func getDeployment(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	k := deployKey{cluster: r.URL.Query().Get("cluster"), meta: meta{name: name, namespace: namespace}}
+	detail := deploymentDetail{
+		deploymentStatus: deploymentStatus{Cluster: k.cluster, Namespace: namespace, Name: name},
+		Pods:             []podDetail{},
+	}
+	deployStatuses.Lock()
+	status, measured := deployStatuses.deploys[k]
+	deployStatuses.Unlock()
+	if measured {
+		detail.deploymentStatus, detail.Measured = status, true
+		if latency, ok := scales.last(k); ok {
+			detail.ScaleLatencyMs = &latency
+		}
+	}
+	found := measured
+	if c := experiments.cluster(k.cluster); c != nil {
+		pods, missing, exists, err := podDetails(c, k)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		detail.Pods, detail.MissingContainers = pods, missing
+		found = found || exists
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "deployment not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// handleDeployments pages the deployments with a published measurement with
+// GET on /api/v1/deployments, and serves the detail of a deployment with its
+// pods and missing containers with GET on
+// /api/v1/deployments/{namespace}/{name}.
+func handleDeployments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	if path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/deployments"), "/"); path != "" {
+		parts := strings.Split(path, "/")
+		if len(parts) != 2 {
+			writeError(w, http.StatusNotFound, "unknown route")
+			return
+		}
+		getDeployment(w, r, parts[0], parts[1])
+		return
+	}
+	deployStatuses.Lock()
+	var items []listItem
+	for k, status := range deployStatuses.deploys {
+		if latency, ok := scales.last(k); ok {
+			status.ScaleLatencyMs = &latency
+		}
+		items = append(items, listItem{value: status, name: status.Cluster + "/" + status.Namespace + "/" + status.Name, latency: status.AvgLatencyMs, time: status.Updated})
+	}
+	deployStatuses.Unlock()
+	writeList(w, r, items)
+}
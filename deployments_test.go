@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestDeploymentUpdateReportsChanges(t *testing.T) {
+	s := deploymentStore{deploys: map[deployKey]deploymentStatus{}}
+	k := deployKey{meta: meta{name: "web", namespace: "default"}}
+	if _, changed := s.update(k, 2, 100); !changed {
+		t.Error("got the first aggregate unchanged")
+	}
+	if _, changed := s.update(k, 2, 100); changed {
+		t.Error("got the same aggregate changed")
+	}
+	if status, changed := s.update(k, 3, 100); !changed || status.Samples != 3 {
+		t.Errorf("got %+v changed %v, want a new sample to change the aggregate", status, changed)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	profileDev = "dev"
+
+	kindProviderPrefix  = "kind://"
+	minikubeNameLabel   = "minikube.k8s.io/name"
+	containerdRuntimeID = "containerd://"
+)
+
+// devCluster is a local cluster of kind or minikube. Their nodes are
+// containers running their own containerd, so the task root of a node is the
+// one inside its container and the image of the exporter has to be loaded
+// into the nodes rather than pulled.
+type devCluster struct {
+	provider string
+	name     string
+	taskRoot string
+}
+
+// loadCommand returns the command which loads the image into the nodes.
+func (d *devCluster) loadCommand(image string) string {
+	if d.provider == "minikube" {
+		return fmt.Sprintf("minikube image load %s -p %s", image, d.name)
+	}
+	return fmt.Sprintf("kind load docker-image %s --name %s", image, d.name)
+}
+
+// detectDevCluster tells kind and minikube clusters apart by their nodes, it
+// returns an error for any other cluster or nodes not running containerd.
+func detectDevCluster(kubeconfig, kubeContext string) (*devCluster, error) {
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+	).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := kubeClient.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+	if len(nodes.Items) == 0 {
+		return nil, errors.New("the cluster has no nodes")
+	}
+	node := nodes.Items[0]
+	d := &devCluster{taskRoot: defaultContainerdRoot}
+	switch {
+	case strings.HasPrefix(node.Spec.ProviderID, kindProviderPrefix):
+		// the provider ID is kind://docker/<cluster>/<node>
+		d.provider = "kind"
+		d.name = "kind"
+		if parts := strings.Split(strings.TrimPrefix(node.Spec.ProviderID, kindProviderPrefix), "/"); len(parts) == 3 {
+			d.name = parts[1]
+		}
+	case node.Labels[minikubeNameLabel] != "":
+		d.provider = "minikube"
+		d.name = node.Labels[minikubeNameLabel]
+	default:
+		return nil, errors.Errorf("node %s belongs to neither a kind nor a minikube cluster", node.Name)
+	}
+	for _, n := range nodes.Items {
+		if runtime := n.Status.NodeInfo.ContainerRuntimeVersion; !strings.HasPrefix(runtime, containerdRuntimeID) {
+			return nil, errors.Errorf("node %s runs %s, the %s cluster must use containerd", n.Name, runtime, d.provider)
+		}
+	}
+	return d, nil
+}
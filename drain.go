@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// drainState tracks the deployments being measured, so the exporter can stop
+// taking new deployments and tell when the measurements in flight are done
+// before it's terminated.
+type drainState struct {
+	sync.Mutex
+	draining bool
+	// pending holds the deployments which wait for startup info of containers
+	pending map[deployKey]struct{}
+	// measured holds the deployments which have been measured
+	measured map[deployKey]struct{}
+}
+
+type drainStatus struct {
+	Draining bool `json:"draining"`
+	Pending  int  `json:"pending"`
+	Ready    bool `json:"ready"`
+	// Flushed is the result of flushing the state file, the measurement log
+	// and the startup events, "ok" or the error, on POST only
+	Flushed map[string]string `json:"flushed,omitempty"`
+}
+
+var drain = drainState{
+	pending:  map[deployKey]struct{}{},
+	measured: map[deployKey]struct{}{},
+}
+
+// admit reports whether the deployment should be measured, only deployments
+// already known are measured while draining.
+func (d *drainState) admit(k deployKey) bool {
+	d.Lock()
+	defer d.Unlock()
+	if !d.draining {
+		return true
+	}
+	_, pending := d.pending[k]
+	_, measured := d.measured[k]
+	return pending || measured
+}
+
+// track records the result of a measurement of the deployment.
+func (d *drainState) track(k deployKey, updated bool) {
+	d.Lock()
+	defer d.Unlock()
+	if updated {
+		delete(d.pending, k)
+		d.measured[k] = struct{}{}
+	} else {
+		d.pending[k] = struct{}{}
+	}
+}
+
+// prune forgets the deployments which don't exist anymore, so a deleted
+// deployment doesn't block the drain.
+func (d *drainState) prune(existing map[deployKey]struct{}) {
+	d.Lock()
+	defer d.Unlock()
+	for k := range d.pending {
+		if _, exists := existing[k]; !exists {
+			delete(d.pending, k)
+		}
+	}
+	for k := range d.measured {
+		if _, exists := existing[k]; !exists {
+			delete(d.measured, k)
+		}
+	}
+}
+
+func (d *drainState) status() drainStatus {
+	d.Lock()
+	defer d.Unlock()
+	return drainStatus{
+		Draining: d.draining,
+		Pending:  len(d.pending),
+		Ready:    d.draining && len(d.pending) == 0,
+	}
+}
+
+// flushAll writes what the exporter holds in memory to the state file, the
+// measurement log and the startup events, so nothing measured is lost when
+// it's terminated.
+func flushAll() map[string]string {
+	results := map[string]string{}
+	for name, flush := range map[string]func() error{
+		"state":        state.save,
+		"measurements": measurements.sync,
+		"events":       startupEvents.flush,
+	} {
+		results[name] = "ok"
+		if err := flush(); err != nil {
+			logrus.WithError(err).Errorf("failed to flush the %s", name)
+			results[name] = err.Error()
+		}
+	}
+	return results
+}
+
+// handleDrain starts draining on POST and reports the drain status. Every
+// POST flushes the sinks, the exporter is ready to be terminated once a POST
+// reports it ready.
+func handleDrain(w http.ResponseWriter, r *http.Request) {
+	var flushed map[string]string
+	switch r.Method {
+	case http.MethodPost:
+		drain.Lock()
+		if !drain.draining {
+			logrus.Infof("start draining with %d deployments pending", len(drain.pending))
+		}
+		drain.draining = true
+		drain.Unlock()
+		flushed = flushAll()
+	case http.MethodGet:
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	status := drain.status()
+	if flushed != nil {
+		status.Flushed = flushed
+		for _, result := range flushed {
+			if result != "ok" {
+				status.Ready = false
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestDrainFlushesSinks(t *testing.T) {
+	defer func() { drain.draining = false }()
+	if err := measurements.open(filepath.Join(t.TempDir(), "measurements.log"), "test"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { measurements.w = nil }()
+	w := httptest.NewRecorder()
+	handleDrain(w, httptest.NewRequest(http.MethodPost, "/api/v1/drain", nil))
+	var status drainStatus
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Draining || len(status.Flushed) != 3 {
+		t.Fatalf("got %+v, want draining with the results of 3 flushes", status)
+	}
+	for name, result := range status.Flushed {
+		if result != "ok" {
+			t.Errorf("flushing the %s: %s", name, result)
+		}
+	}
+}
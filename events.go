@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultEventRetention      = 7 * 24 * time.Hour
+	defaultEventVacuumInterval = time.Hour
+	// eventFlushInterval is how often the startup events are written
+	eventFlushInterval = time.Second
+)
+
+var eventsBucket = []byte("events")
+
+// eventStore records every container startup in a bbolt file keyed by the
+// time the container started, so startup latencies can be queried long after
+// the gauges moved on. Events out of the retention are deleted by the vacuum
+// job, which also compacts the file.
+type eventStore struct {
+	// the mutex guards pending only, as events are added with mu held
+	sync.Mutex
+	pending []startupRecord
+	// dbMu is held exclusively only to swap db for the compacted file,
+	// writes and queries hold it shared as bbolt serializes them itself
+	dbMu      sync.RWMutex
+	path      string
+	db        *bolt.DB
+	retention time.Duration
+}
+
+var startupEvents = eventStore{
+	retention: defaultEventRetention,
+}
+
+func (s *eventStore) open(path string) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(eventsBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return err
+	}
+	s.path, s.db = path, db
+	return nil
+}
+
+// enabled reports whether the store was opened, it doesn't change once the
+// exporter runs.
+func (s *eventStore) enabled() bool {
+	return s.path != ""
+}
+
+// eventKey orders the events by the time the containers started, the name
+// tells apart containers started at the same time.
+func eventKey(r startupRecord) []byte {
+	k := make([]byte, 8, 8+len(r.Namespace)+1+len(r.Name))
+	binary.BigEndian.PutUint64(k, uint64(r.End))
+	return append(append(append(k, r.Namespace...), '/'), r.Name...)
+}
+
+// add queues the startup of a container to be written.
+func (s *eventStore) add(r startupRecord) {
+	if !s.enabled() {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.pending = append(s.pending, r)
+}
+
+// run writes the queued events and vacuums the store every interval until
+// done.
+func (s *eventStore) run(vacuumInterval time.Duration, done <-chan struct{}) {
+	flush := clk.NewTicker(eventFlushInterval)
+	defer flush.Stop()
+	vacuum := clk.NewTicker(vacuumInterval)
+	defer vacuum.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-flush.C():
+			if err := s.flush(); err != nil {
+				logrus.WithError(err).Error("failed to write startup events")
+			}
+		case <-vacuum.C():
+			if err := s.vacuum(); err != nil {
+				logrus.WithError(err).Error("failed to vacuum startup events")
+			}
+		}
+	}
+}
+
+// flush writes the queued events, they are taken off the queue first so
+// adding events doesn't wait for the write.
+func (s *eventStore) flush() error {
+	s.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(eventsBucket)
+		for _, r := range pending {
+			v, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(eventKey(r), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// vacuum deletes the events out of the retention and compacts the file, as
+// bbolt never gives back the pages it frees.
+func (s *eventStore) vacuum() error {
+	oldest := make([]byte, 8)
+	binary.BigEndian.PutUint64(oldest, uint64(clk.Now().Add(-s.retention).UnixNano()))
+	deleted := 0
+	s.dbMu.RLock()
+	if s.db == nil {
+		s.dbMu.RUnlock()
+		return nil
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(eventsBucket)
+		// deleting through the cursor moves it to the next key, which
+		// Next would skip
+		var keys [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:8], oldest) < 0; k, _ = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		deleted = len(keys)
+		return nil
+	})
+	s.dbMu.RUnlock()
+	if err != nil || deleted == 0 {
+		return err
+	}
+	logrus.Debugf("deleted %d startup events out of the retention", deleted)
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+	compacted := s.path + ".compact"
+	dst, err := bolt.Open(compacted, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	if err := bolt.Compact(dst, s.db, 0); err != nil {
+		dst.Close()
+		os.Remove(compacted)
+		return errors.Wrap(err, "failed to compact")
+	}
+	dst.Close()
+	s.db.Close()
+	if err := os.Rename(compacted, s.path); err != nil {
+		os.Remove(compacted)
+	}
+	s.db, err = bolt.Open(s.path, 0600, &bolt.Options{Timeout: time.Second})
+	return err
+}
+
+func (s *eventStore) close() {
+	if err := s.flush(); err != nil {
+		logrus.WithError(err).Error("failed to write startup events")
+	}
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+	if s.db != nil {
+		s.db.Close()
+		s.db = nil
+	}
+}
+
+const (
+	defaultEventPageSize = 1000
+	maxEventPageSize     = 10000
+)
+
+// handleEvents pages the startups of containers within a time range with GET
+// on /api/v1/events. The range is given by from and to in RFC 3339 or by
+// since, a duration which may be in days, and the events can be filtered by
+// the pod namespace, the pod, the node and the type. The events are in the
+// order they started, a page holds at most limit of them and is read from
+// the store after the event its continue token ends with.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	query := r.URL.Query()
+	to := clk.Now()
+	from := to.Add(-time.Hour)
+	var err error
+	if s := query.Get("since"); s != "" {
+		since, err := parseHistoryDuration(s)
+		if err != nil || since <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid since")
+			return
+		}
+		from = to.Add(-since)
+	}
+	if s := query.Get("from"); s != "" {
+		if from, err = time.Parse(time.RFC3339, s); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid from")
+			return
+		}
+	}
+	if s := query.Get("to"); s != "" {
+		if to, err = time.Parse(time.RFC3339, s); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid to")
+			return
+		}
+	}
+	if s := query.Get("sort"); s != "" && s != sortByTime {
+		writeError(w, http.StatusBadRequest, "events can only be sorted by time")
+		return
+	}
+	limit := defaultEventPageSize
+	if s := query.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > maxEventPageSize {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+	lower, upper := make([]byte, 8), make([]byte, 8)
+	binary.BigEndian.PutUint64(lower, uint64(from.UnixNano()))
+	binary.BigEndian.PutUint64(upper, uint64(to.UnixNano()))
+	var after []byte
+	if s := query.Get("continue"); s != "" {
+		if after, err = base64.RawURLEncoding.DecodeString(s); err != nil || len(after) < 8 {
+			writeError(w, http.StatusBadRequest, "invalid continue token")
+			return
+		}
+	}
+	q := listQuery{}
+	if s := query.Get("fields"); s != "" {
+		q.fields = strings.Split(s, ",")
+	}
+	if !startupEvents.enabled() {
+		writeError(w, http.StatusNotFound, "the event store isn't enabled")
+		return
+	}
+	if err := startupEvents.flush(); err != nil {
+		logrus.WithError(err).Error("failed to write startup events")
+	}
+	page := listPage{Items: []interface{}{}}
+	var last startupRecord
+	startupEvents.dbMu.RLock()
+	if startupEvents.db == nil {
+		startupEvents.dbMu.RUnlock()
+		writeError(w, http.StatusServiceUnavailable, "the event store is closed")
+		return
+	}
+	err = startupEvents.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+		k, v := c.Seek(lower)
+		if after != nil && bytes.Compare(after, lower) >= 0 {
+			if k, v = c.Seek(after); k != nil && bytes.Equal(k, after) {
+				k, v = c.Next()
+			}
+		}
+		for ; k != nil && bytes.Compare(k[:8], upper) < 0; k, v = c.Next() {
+			var e startupRecord
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if ns := query.Get("namespace"); ns != "" && e.PodNamespace != ns ||
+				query.Get("pod") != "" && e.Pod != query.Get("pod") ||
+				query.Get("node") != "" && e.Node != query.Get("node") ||
+				query.Get("type") != "" && e.Type != query.Get("type") {
+				continue
+			}
+			if len(page.Items) == limit {
+				page.Continue = base64.RawURLEncoding.EncodeToString(eventKey(last))
+				return nil
+			}
+			item, err := q.selectFields(e)
+			if err != nil {
+				return err
+			}
+			page.Items = append(page.Items, item)
+			last = e
+		}
+		return nil
+	})
+	startupEvents.dbMu.RUnlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	excludeReasonEviction = "eviction"
+
+	// evictionReplacementWindow is how long after an eviction a new pod of the
+	// same owner is considered as its replacement
+	evictionReplacementWindow = 5 * time.Minute
+)
+
+// evictionReasons are the reasons of pod events which mean the pod is evicted.
+var evictionReasons = map[string]struct{}{
+	"Evicted":              {},
+	"TaintManagerEviction": {},
+	"Preempted":            {},
+}
+
+// evictionTracker finds the pods which replace evicted pods, they are created
+// by maintenance activity like node drains rather than scale events.
+type evictionTracker struct {
+	sync.Mutex
+	nodeLister corelisters.NodeLister
+	podLister  corelisters.PodLister
+	// evicted holds the UIDs of the evicted pods, so an eviction noticed more
+	// than once is counted once
+	evicted map[types.UID]struct{}
+	// credits holds the times of evictions which haven't been replaced by
+	// the UID of the owner of the evicted pods
+	credits map[types.UID][]time.Time
+	// replacements holds the UIDs of the pods replacing evicted pods
+	replacements map[types.UID]struct{}
+}
+
+// newEvictionTracker registers the event handlers which track evictions on
+// the informers.
+func newEvictionTracker(factory informers.SharedInformerFactory) *evictionTracker {
+	e := &evictionTracker{
+		nodeLister:   factory.Core().V1().Nodes().Lister(),
+		podLister:    factory.Core().V1().Pods().Lister(),
+		evicted:      map[types.UID]struct{}{},
+		credits:      map[types.UID][]time.Time{},
+		replacements: map[types.UID]struct{}{},
+	}
+	factory.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if p, ok := obj.(*corev1.Pod); ok {
+				e.podAdded(p)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if p, ok := obj.(*corev1.Pod); ok && p.Status.Reason == "Evicted" {
+				e.podEvicted(p)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			p, ok := obj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+			if e.drained(p) {
+				e.podEvicted(p)
+			}
+			e.Lock()
+			delete(e.replacements, p.UID)
+			delete(e.evicted, p.UID)
+			e.Unlock()
+		},
+	})
+	factory.Core().V1().Events().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			ev, ok := obj.(*corev1.Event)
+			if !ok || ev.InvolvedObject.Kind != "Pod" {
+				return
+			}
+			if _, ok := evictionReasons[ev.Reason]; !ok {
+				return
+			}
+			if p, err := e.podLister.Pods(ev.InvolvedObject.Namespace).Get(ev.InvolvedObject.Name); err == nil {
+				e.podEvicted(p)
+			}
+		},
+	})
+	return e
+}
+
+// drained reports whether a deleted pod ran on a cordoned node, which is how a
+// node drain evicts pods.
+func (e *evictionTracker) drained(p *corev1.Pod) bool {
+	if p.Spec.NodeName == "" {
+		return false
+	}
+	node, err := e.nodeLister.Get(p.Spec.NodeName)
+	if err != nil {
+		return false
+	}
+	return node.Spec.Unschedulable
+}
+
+func (e *evictionTracker) podEvicted(p *corev1.Pod) {
+	owner := metav1.GetControllerOf(p)
+	if owner == nil {
+		return
+	}
+	e.Lock()
+	defer e.Unlock()
+	if _, exists := e.evicted[p.UID]; exists {
+		return
+	}
+	e.evicted[p.UID] = struct{}{}
+	e.credits[owner.UID] = append(e.credits[owner.UID], clk.Now())
+	logrus.Debugf("pod %s(%s) is evicted", p.Name, p.Namespace)
+}
+
+func (e *evictionTracker) podAdded(p *corev1.Pod) {
+	owner := metav1.GetControllerOf(p)
+	if owner == nil {
+		return
+	}
+	e.Lock()
+	defer e.Unlock()
+	credits := e.credits[owner.UID]
+	for len(credits) > 0 && clk.Since(credits[0]) > evictionReplacementWindow {
+		credits = credits[1:]
+	}
+	if len(credits) == 0 {
+		delete(e.credits, owner.UID)
+		return
+	}
+	e.credits[owner.UID] = credits[1:]
+	e.replacements[p.UID] = struct{}{}
+	logrus.Debugf("pod %s(%s) replaces an evicted pod", p.Name, p.Namespace)
+}
+
+// isReplacement reports whether the pod replaces an evicted pod.
+func (e *evictionTracker) isReplacement(p *corev1.Pod) bool {
+	e.Lock()
+	defer e.Unlock()
+	_, exists := e.replacements[p.UID]
+	return exists
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	experimentKindPodKill = "pod-kill"
+	experimentKindScale   = "scale"
+	experimentTag         = "experiment"
+
+	experimentStatusRunning  = "running"
+	experimentStatusMeasured = "measured"
+	experimentStatusFailed   = "failed"
+
+	// experimentTimeout fails the experiments which aren't measured in
+	// time, it's longer than the scale and self-healing timeouts so it only
+	// catches the ones no scale event or deletion was tracked for
+	experimentTimeout = time.Hour
+	// experimentRetention is how long finished experiments are kept
+	experimentRetention = time.Hour
+)
+
+// experiment is a disruption of a deployment triggered through the API, its
+// measurement is set once the deployment recovers.
+type experiment struct {
+	ID          string            `json:"id"`
+	Kind        string            `json:"kind"`
+	Cluster     string            `json:"cluster,omitempty"`
+	Namespace   string            `json:"namespace"`
+	Deployment  string            `json:"deployment"`
+	Pod         string            `json:"pod,omitempty"`
+	Replicas    int32             `json:"replicas,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Started     time.Time         `json:"started"`
+	Status      string            `json:"status"`
+	Error       string            `json:"error,omitempty"`
+	Finished    *time.Time        `json:"finished,omitempty"`
+	Measurement *measurement      `json:"measurement,omitempty"`
+}
+
+type experimentStore struct {
+	sync.Mutex
+	clusters    []*cluster
+	experiments map[string]*experiment
+}
+
+var experiments = experimentStore{
+	experiments: map[string]*experiment{},
+}
+
+func (s *experimentStore) cluster(name string) *cluster {
+	for _, c := range s.clusters {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *experimentStore) add(e *experiment) {
+	s.Lock()
+	defer s.Unlock()
+	s.experiments[e.ID] = e
+}
+
+func (s *experimentStore) remove(id string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.experiments, id)
+}
+
+// complete sets the measurement of the experiment.
+func (s *experimentStore) complete(id string, m measurement) {
+	s.Lock()
+	defer s.Unlock()
+	if e, exists := s.experiments[id]; exists && e.Status == experimentStatusRunning {
+		now := clk.Now()
+		e.Measurement, e.Status, e.Finished = &m, experimentStatusMeasured, &now
+	}
+}
+
+// fail finishes the experiment without a measurement for the reason.
+func (s *experimentStore) fail(id, reason string) {
+	s.Lock()
+	defer s.Unlock()
+	if e, exists := s.experiments[id]; exists && e.Status == experimentStatusRunning {
+		now := clk.Now()
+		e.Status, e.Error, e.Finished = experimentStatusFailed, reason, &now
+		logrus.Warnf("experiment %s failed: %s", id, reason)
+	}
+}
+
+// expire fails the experiments running for longer than the timeout and
+// forgets the ones finished for longer than the retention.
+func (s *experimentStore) expire() {
+	s.Lock()
+	defer s.Unlock()
+	now := clk.Now()
+	for id, e := range s.experiments {
+		switch {
+		case e.Status == experimentStatusRunning && now.Sub(e.Started) > experimentTimeout:
+			e.Status, e.Error, e.Finished = experimentStatusFailed, fmt.Sprintf("not measured in %v", experimentTimeout), &now
+			logrus.Warnf("experiment %s failed: %s", id, e.Error)
+		case e.Finished != nil && now.Sub(*e.Finished) > experimentRetention:
+			delete(s.experiments, id)
+		}
+	}
+}
+
+// handleExperiments serves the experiments API. Experiments are paged with
+// GET on /api/v1/experiments, finished ones are kept for an hour. A pod of a
+// deployment is
+// killed with POST on /api/v1/experiments/pod-kill, a deployment is scaled up
+// with POST on /api/v1/experiments/scale and an experiment is got with GET on
+// /api/v1/experiments/{id}.
+func handleExperiments(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/experiments"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		listExperiments(w, r)
+	case id == experimentKindPodKill && r.Method == http.MethodPost:
+		requireToken(killPod)(w, r)
+	case id == experimentKindScale && r.Method == http.MethodPost:
+		requireToken(scaleDeployment)(w, r)
+	case id != "" && !strings.Contains(id, "/") && r.Method == http.MethodGet:
+		experiments.Lock()
+		defer experiments.Unlock()
+		e, exists := experiments.experiments[id]
+		if !exists {
+			writeError(w, http.StatusNotFound, "experiment not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, e)
+	default:
+		writeError(w, http.StatusNotFound, "unknown route")
+	}
+}
+
+func listExperiments(w http.ResponseWriter, r *http.Request) {
+	experiments.Lock()
+	var items []listItem
+	for _, e := range experiments.experiments {
+		// the default order is by the time the experiments start
+		item := listItem{value: *e, name: fmt.Sprintf("%020d/%s", e.Started.UnixNano(), e.ID), time: e.Started}
+		if e.Measurement != nil {
+			item.latency = e.Measurement.LatencyMs
+		}
+		items = append(items, item)
+	}
+	experiments.Unlock()
+	writeList(w, r, items)
+}
+
+// killPod deletes a random running pod of a deployment, the deployment
+// replacing it is measured as a self-healing latency tagged with the
+// experiment.
+func killPod(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Cluster    string            `json:"cluster"`
+		Namespace  string            `json:"namespace"`
+		Deployment string            `json:"deployment"`
+		Tags       map[string]string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Namespace == "" || req.Deployment == "" {
+		writeError(w, http.StatusBadRequest, "the namespace and the name of a deployment must be provided")
+		return
+	}
+	c := experiments.cluster(req.Cluster)
+	if c == nil {
+		writeError(w, http.StatusNotFound, "cluster not found")
+		return
+	}
+	d, err := c.deploymentLister.Deployments(req.Namespace).Get(req.Deployment)
+	if err != nil || d.Spec.Selector == nil {
+		writeError(w, http.StatusNotFound, "deployment not found")
+		return
+	}
+	pods, err := c.podLister.Pods(d.Namespace).List(makeSelector(*d.Spec.Selector))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var running []*corev1.Pod
+	for _, p := range c.owners.ownedBy(meta{name: d.Name, namespace: d.Namespace}, pods) {
+		if p.DeletionTimestamp == nil && p.Status.Phase == corev1.PodRunning {
+			running = append(running, p)
+		}
+	}
+	if len(running) == 0 {
+		writeError(w, http.StatusConflict, "deployment has no running pod")
+		return
+	}
+	victim := running[rand.Intn(len(running))]
+	e := &experiment{
+		ID:         newID(),
+		Kind:       experimentKindPodKill,
+		Cluster:    c.name,
+		Namespace:  d.Namespace,
+		Deployment: d.Name,
+		Pod:        victim.Name,
+		Tags:       map[string]string{},
+		Started:    clk.Now(),
+		Status:     experimentStatusRunning,
+	}
+	for k, v := range req.Tags {
+		e.Tags[k] = v
+	}
+	e.Tags[experimentTag] = e.ID
+	resp := *e
+	experiments.add(e)
+	c.healing.expect(victim.UID, e.ID, e.Tags)
+	if err := c.client.CoreV1().Pods(victim.Namespace).Delete(gocontext.Background(), victim.Name, metav1.DeleteOptions{}); err != nil {
+		c.healing.unexpect(victim.UID)
+		experiments.remove(e.ID)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logrus.Infof("experiment %s killed pod %s(%s)", e.ID, victim.Name, victim.Namespace)
+	w.Header().Set("Location", "/api/v1/experiments/"+e.ID)
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// scaleDeployment scales a deployment up to the replicas, the scale event is
+// measured as a scale latency tagged with the experiment.
+func scaleDeployment(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Cluster    string            `json:"cluster"`
+		Namespace  string            `json:"namespace"`
+		Deployment string            `json:"deployment"`
+		Replicas   int32             `json:"replicas"`
+		Tags       map[string]string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Namespace == "" || req.Deployment == "" {
+		writeError(w, http.StatusBadRequest, "the namespace and the name of a deployment must be provided")
+		return
+	}
+	c := experiments.cluster(req.Cluster)
+	if c == nil {
+		writeError(w, http.StatusNotFound, "cluster not found")
+		return
+	}
+	ctx := gocontext.Background()
+	scale, err := c.client.AppsV1().Deployments(req.Namespace).GetScale(ctx, req.Deployment, metav1.GetOptions{})
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	// only scale-ups are measured
+	if req.Replicas <= scale.Spec.Replicas {
+		writeError(w, http.StatusConflict, "replicas must be more than the current replicas")
+		return
+	}
+	e := &experiment{
+		ID:         newID(),
+		Kind:       experimentKindScale,
+		Cluster:    c.name,
+		Namespace:  req.Namespace,
+		Deployment: req.Deployment,
+		Replicas:   req.Replicas,
+		Tags:       map[string]string{},
+		Started:    clk.Now(),
+		Status:     experimentStatusRunning,
+	}
+	for k, v := range req.Tags {
+		e.Tags[k] = v
+	}
+	e.Tags[experimentTag] = e.ID
+	k := deployKey{cluster: c.name, meta: meta{name: req.Deployment, namespace: req.Namespace}}
+	resp := *e
+	experiments.add(e)
+	if !scales.expect(k, req.Replicas, e.ID, e.Tags) {
+		experiments.remove(e.ID)
+		writeError(w, http.StatusServiceUnavailable, "deployment isn't tracked yet")
+		return
+	}
+	scale.Spec.Replicas = req.Replicas
+	if _, err := c.client.AppsV1().Deployments(req.Namespace).UpdateScale(ctx, req.Deployment, scale, metav1.UpdateOptions{}); err != nil {
+		scales.unexpect(k, e.ID)
+		experiments.remove(e.ID)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logrus.Infof("experiment %s scaled deployment %s(%s) to %d replicas", e.ID, req.Deployment, req.Namespace, req.Replicas)
+	w.Header().Set("Location", "/api/v1/experiments/"+e.ID)
+	writeJSON(w, http.StatusAccepted, resp)
+}
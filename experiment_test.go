@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExperimentsFailAndExpire(t *testing.T) {
+	c := fakeClock(t)
+	defer func(e map[string]*experiment) { experiments.experiments = e }(experiments.experiments)
+	experiments.experiments = map[string]*experiment{}
+	experiments.add(&experiment{ID: "stuck", Started: clk.Now(), Status: experimentStatusRunning})
+	experiments.add(&experiment{ID: "measured", Started: clk.Now(), Status: experimentStatusRunning})
+	experiments.complete("measured", measurement{LatencyMs: 100})
+
+	c.Advance(experimentTimeout + time.Second)
+	experiments.expire()
+	if e := experiments.experiments["stuck"]; e.Status != experimentStatusFailed || e.Error == "" {
+		t.Errorf("got %+v, want the experiment failed after the timeout", e)
+	}
+	if _, exists := experiments.experiments["measured"]; exists {
+		t.Error("a finished experiment is kept after the retention")
+	}
+	// a late measurement doesn't revive a failed experiment
+	experiments.complete("stuck", measurement{LatencyMs: 100})
+	if e := experiments.experiments["stuck"]; e.Status != experimentStatusFailed || e.Measurement != nil {
+		t.Errorf("got %+v, want it to stay failed", e)
+	}
+	c.Advance(experimentRetention + time.Second)
+	experiments.expire()
+	if len(experiments.experiments) != 0 {
+		t.Errorf("kept %d experiments", len(experiments.experiments))
+	}
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/json"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,32 +17,47 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
-	"k8s.io/client-go/informers"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 const (
 	metricsNamespace              = "startup_exporter"
 	metricsSubsystemPod           = "pod"
 	metricsSubsystemDeploy        = "deployment"
+	metricsSubsystemNode          = "node"
+	metricsSubsystemWorkload      = "workload"
+	metricsSubsystemJob           = "job"
+	metricsSubsystemRollout       = "rollout"
+	metricsSubsystemNamespace     = "namespace"
+	metricsSubsystemCluster       = "cluster"
+	metricsSubsystemProject       = "project"
 	defaultContainerdK8sNamespace = "k8s.io"
 	containerNamePrefix           = "containerd://"
-	maxContainerNameLength        = 10
+	informerResyncPeriod          = 5 * time.Second
 )
 
+var stuckReasons = map[string]struct{}{
+	"ErrImagePull":               {},
+	"ImagePullBackOff":           {},
+	"InvalidImageName":           {},
+	"CrashLoopBackOff":           {},
+	"CreateContainerConfigError": {},
+	"CreateContainerError":       {},
+}
+
 type meta struct {
 	name      string
 	namespace string
 }
 
 var (
-	allInfo                     = map[meta]containerStartupInfo{}
+	allInfo                     = newRecordStore()
 	mu                          sync.Mutex
 	deployPodsAvgStartupLatency = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -53,6 +68,99 @@ var (
 		[]string{
 			"deploy_name",
 			"namespace",
+			"cluster",
+			"runtime_class",
+		},
+	)
+	deploySidecarsAvgStartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemPod,
+			Name:      "sidecar_average_startup_latency_milliseconds",
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+			"container",
+		},
+	)
+	deployContainersAvgStartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemPod,
+			Name:      "container_average_startup_latency_milliseconds",
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+			"container",
+		},
+	)
+	deployTypesAvgStartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "type_average_startup_latency_milliseconds",
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+			"type",
+		},
+	)
+	deployStuckContainers = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "stuck_containers",
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+			"reason",
+		},
+	)
+	deployDegradedNodePods = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "degraded_node_pods",
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+			"reason",
+		},
+	)
+	deployExcludedPods = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "excluded_pods",
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+			"reason",
+		},
+	)
+	deploySkipped = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "measurement_skipped",
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+			"reason",
 		},
 	)
 	currentStartupLatency = promauto.NewGaugeVec(
@@ -64,6 +172,37 @@ var (
 		[]string{
 			"type",
 			"namespace",
+			"node",
+		},
+	)
+	collectorNetwork = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "collector_network_mode",
+		},
+		[]string{
+			"collector",
+			"mode",
+		},
+	)
+	receivedBatchSize = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "received_batch_size",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 11),
+		},
+	)
+	snapshotStartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemPod,
+			Name:      "snapshot_startup_latency_milliseconds",
+		},
+		[]string{
+			"type",
+			"namespace",
+			"snapshot",
+			"node",
 		},
 	)
 )
@@ -81,6 +220,289 @@ var exportCmd = cli.Command{
 			Name:  "master",
 			Usage: "the address of the API server",
 		},
+		cli.StringSliceFlag{
+			Name:  "context",
+			Usage: "kubeconfig context of a cluster to watch, can be given more than once",
+		},
+		cli.StringFlag{
+			Name:  "host",
+			Usage: "the address the exporter listens on",
+			Value: "0.0.0.0",
+		},
+		cli.DurationFlag{
+			Name:  "gc-grace-period",
+			Usage: "remove startup info of containers which belong to no pod for this long, 0 disables it",
+			Value: defaultGCGracePeriod,
+		},
+		cli.IntFlag{
+			Name:  "namespace-rate",
+			Usage: "max number of records of a namespace accepted per minute, the namespace of their pod if they have one, 0 means no limit",
+		},
+		cli.IntFlag{
+			Name:  "max-records",
+			Usage: "max number of startup records retained, the least recently used ones are evicted, 0 means no limit",
+			Value: defaultMaxRecords,
+		},
+		cli.IntFlag{
+			Name:  "max-records-bytes",
+			Usage: "approximate max bytes of the startup records retained, 0 means no limit",
+		},
+		cli.StringFlag{
+			Name:  "state-file",
+			Usage: "bbolt file the startup records and the measurements of deployments are saved to and loaded from on start, they aren't saved if not set",
+		},
+		cli.DurationFlag{
+			Name:  "state-interval",
+			Usage: "interval between saves of the state",
+			Value: defaultStateInterval,
+		},
+		cli.StringFlag{
+			Name:  "mirror-to",
+			Usage: "address of a standby exporter every accepted record is forwarded to",
+		},
+		cli.StringFlag{
+			Name:   "mirror-token",
+			Usage:  "bearer token sent to the standby exporter",
+			EnvVar: "STARTUP_EXPORTER_MIRROR_TOKEN",
+		},
+		cli.IntFlag{
+			Name:  "mirror-spool",
+			Usage: "max number of records spooled while the standby exporter is unreachable, the oldest ones are dropped",
+			Value: defaultMirrorSpool,
+		},
+		cli.StringSliceFlag{
+			Name:  "warm-up-from",
+			Usage: "address of a peer replica to load the state from before serving, the first one serving it is used, can be given more than once",
+		},
+		cli.StringFlag{
+			Name:   "warm-up-token",
+			Usage:  "bearer token sent to the peers to warm up from",
+			EnvVar: "STARTUP_EXPORTER_WARM_UP_TOKEN",
+		},
+		cli.DurationFlag{
+			Name:  "warm-up-timeout",
+			Usage: "max time a peer may take to serve its state",
+			Value: defaultWarmUpTimeout,
+		},
+		cli.IntFlag{
+			Name:  "namespace-retain",
+			Usage: "max number of containers of a namespace retained, the namespace of their pod if they have one, 0 means no limit",
+		},
+		cli.StringSliceFlag{
+			Name:  "from-file",
+			Usage: "load startup records from a JSON lines file before serving, can be given more than once",
+		},
+		cli.BoolFlag{
+			Name:  "offline",
+			Usage: "neither watch Kubernetes nor accept records from collectors, only serve the records loaded from files",
+		},
+		cli.StringFlag{
+			Name:  "measurement-log",
+			Usage: "file to write a JSON line to for every published deployment measurement and scale event, - means stdout",
+		},
+		cli.DurationFlag{
+			Name:  "history-retention",
+			Usage: "how long published deployment measurements are kept for the history API, they are loaded back from the measurement log file on start, 0 disables the history",
+			Value: defaultHistoryRetention,
+		},
+		cli.StringFlag{
+			Name:  "event-store",
+			Usage: "bbolt file every container startup is recorded in for the events API, it's disabled if not set",
+		},
+		cli.DurationFlag{
+			Name:  "event-retention",
+			Usage: "how long container startups are kept in the event store",
+			Value: defaultEventRetention,
+		},
+		cli.DurationFlag{
+			Name:  "event-vacuum-interval",
+			Usage: "interval between deletions of the container startups out of the retention",
+			Value: defaultEventVacuumInterval,
+		},
+		cli.BoolFlag{
+			Name:  "access-log",
+			Usage: "write a JSON line to stdout for every HTTP request",
+		},
+		cli.StringFlag{
+			Name:  "run-id",
+			Usage: "ID of this run in the measurement log, a random one is used if not set",
+		},
+		cli.DurationFlag{
+			Name:  "slow-loop-threshold",
+			Usage: "count update loops slower than this and profile the next one, 0 disables it",
+		},
+		cli.StringFlag{
+			Name:  "profile-dir",
+			Usage: "dir to write profiles of slow update loops to, no profile is taken if not set",
+		},
+		cli.StringFlag{
+			Name:  "profile-type",
+			Usage: "type of the profiles of slow update loops, cpu or trace",
+			Value: profileTypeCPU,
+		},
+		cli.StringFlag{
+			Name:  "buckets,latency-buckets",
+			Usage: "comma separated buckets in milliseconds of the histograms of the startup latency of containers",
+		},
+		cli.StringFlag{
+			Name:  "config",
+			Usage: "JSON file of flags of the command keyed by their names, flags given on the command line take precedence",
+		},
+		cli.StringFlag{
+			Name:  "quantiles",
+			Usage: "comma separated quantiles of the summary of the startup latency of containers of deployments, empty disables the summary",
+			Value: defaultQuantiles,
+		},
+		cli.DurationFlag{
+			Name:  "quantiles-max-age",
+			Usage: "window the quantiles of the summary are computed over, it should span several scale events as each container is observed once",
+			Value: defaultQuantilesMaxAge,
+		},
+		cli.IntFlag{
+			Name:  "quantiles-age-buckets",
+			Usage: "buckets the window of the summary is rotated in",
+			Value: defaultQuantilesAgeBuckets,
+		},
+		cli.Float64Flag{
+			Name:  "smoothing-factor",
+			Usage: "weight of a new value in the moving average deployment gauges are smoothed with, 1 disables the smoothing",
+			Value: 1,
+		},
+		cli.Float64Flag{
+			Name:  "min-change",
+			Usage: "min change in milliseconds of a deployment gauge to update it",
+		},
+		cli.BoolFlag{
+			Name:  "exclude-degraded-nodes",
+			Usage: "exclude pods on cordoned, pressured or recently rebooted nodes from the deployment aggregation instead of only reporting them",
+		},
+		cli.DurationFlag{
+			Name:  "node-window",
+			Usage: "window the startup latency of containers is aggregated per node over",
+			Value: defaultNodeWindow,
+		},
+		cli.DurationFlag{
+			Name:  "cluster-window",
+			Usage: "window the startup latency of containers is aggregated per cluster over",
+			Value: defaultClusterWindow,
+		},
+		cli.IntSliceFlag{
+			Name:  "predict-pods",
+			Usage: "number of pods added by a scale-up to predict the scale latency of deployments for, can be given more than once",
+		},
+		cli.StringFlag{
+			Name:   "api-token",
+			Usage:  "bearer token required by the APIs which change the clusters, they are disabled if not set",
+			EnvVar: "STARTUP_EXPORTER_API_TOKEN",
+		},
+		cli.StringFlag{
+			Name:  "authz-policy",
+			Usage: "JSON file mapping tokens, ServiceAccounts and client certificate CNs to the ingest, read or admin role, every route is open if not set",
+		},
+		cli.StringFlag{
+			Name:  "tls-cert",
+			Usage: "certificate to serve over TLS with, cleartext is served if not set",
+		},
+		cli.StringFlag{
+			Name:  "tls-key",
+			Usage: "key of the TLS certificate",
+		},
+		cli.StringFlag{
+			Name:  "client-ca",
+			Usage: "CA bundle the certificates of clients are verified against, for the commonName identities of the authz policy",
+		},
+		cli.StringSliceFlag{
+			Name:  "alertmanager",
+			Usage: "URL of an Alertmanager to post alerts to when deployments exceed the alert thresholds, can be given more than once",
+		},
+		cli.Float64Flag{
+			Name:  "alert-startup-latency",
+			Usage: "average startup latency of a deployment in milliseconds over which an alert fires, 0 disables it",
+		},
+		cli.Float64Flag{
+			Name:  "alert-scale-latency",
+			Usage: "scale latency of a deployment in milliseconds over which an alert fires, 0 disables it",
+		},
+		cli.BoolFlag{
+			Name:  "scale-down",
+			Usage: "measure how long deployments take to scale down, from the replicas being lowered to the pods over them being gone",
+		},
+		cli.StringFlag{
+			Name:  "scale-time-source",
+			Usage: "clock scale latency is measured with, node for the timestamps of the containers or receive for the exporter receiving them, which also exports both to cross-check the clocks of the nodes",
+			Value: scaleTimeNode,
+		},
+		cli.StringFlag{
+			Name:  "ready-clusters",
+			Usage: "clusters which must be reachable and synced for /readyz to answer ready, any or all",
+			Value: readyAny,
+		},
+		cli.BoolFlag{
+			Name:  "standalone",
+			Usage: "run without Kubernetes and aggregate containers by their containerd namespace and the extra labels",
+		},
+		cli.StringSliceFlag{
+			Name:  "extra-label",
+			Usage: "key of the shim-provided extras of containers which is exported as a label, can be given more than once",
+		},
+		cli.DurationFlag{
+			Name:  "measurement-cooldown",
+			Usage: "don't measure a deployment again for this long after a measurement is published unless its pods change, 0 disables it",
+		},
+		cli.BoolFlag{
+			Name:  "openshift",
+			Usage: "measure the deployment configs of OpenShift as well",
+		},
+		cli.BoolFlag{
+			Name:  "argo-rollouts",
+			Usage: "measure the rollouts of Argo Rollouts as well",
+		},
+		cli.StringFlag{
+			Name:  "collector-service",
+			Usage: "headless service of collectors started with --listen in the form of NAMESPACE/NAME, the collectors behind it are discovered from its endpoints and pulled from",
+		},
+		cli.StringFlag{
+			Name:   "collector-token",
+			Usage:  "token the collectors of --collector-service serve their containers with",
+			EnvVar: collectorTokenEnv,
+		},
+		cli.DurationFlag{
+			Name:  "pull-interval",
+			Usage: "interval between pulls from the collectors of --collector-service",
+			Value: defaultPullInterval,
+		},
+		cli.StringFlag{
+			Name:  "custom-metrics-addr",
+			Usage: "address to serve the custom metrics API on over TLS for the API aggregation layer, it's disabled if not set. Clients must have a certificate of the requestheader client CA in kube-system/extension-apiserver-authentication and the user they proxy for is authorized by SubjectAccessReviews",
+		},
+		cli.StringFlag{
+			Name:  "custom-metrics-cert",
+			Usage: "certificate of the custom metrics API, a self-signed one is used if not set, which the APIService can only use with insecureSkipTLSVerify",
+		},
+		cli.StringFlag{
+			Name:  "custom-metrics-key",
+			Usage: "key of the certificate of the custom metrics API",
+		},
+		cli.BoolFlag{
+			Name:  "pod-metrics",
+			Usage: "export the startup latency of every pod, a series per pod",
+		},
+		cli.BoolFlag{
+			Name:  "reports",
+			Usage: "keep a DeploymentStartupReport with the latest measurements in the namespace of every measured deployment",
+		},
+		cli.DurationFlag{
+			Name:  "update-budget",
+			Usage: "how long the deployments of an update may take before the ones which aren't benchmark targets are deferred to the next update, 0 means no limit",
+		},
+		cli.BoolFlag{
+			Name:  "generic-workloads",
+			Usage: "measure pods by their top-level controller found through their owner references, or by themselves if they have none, instead of by deployments, stateful sets and daemon sets",
+		},
+		cli.StringSliceFlag{
+			Name:  "sidecar",
+			Usage: "name or image of containers which are excluded from the deployment aggregation and reported separately",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		port := context.Args().First()
@@ -91,31 +513,258 @@ var exportCmd = cli.Command{
 		if context.GlobalBool("debug") {
 			logrus.SetLevel(logrus.DebugLevel)
 		}
-		clientCmdConfig, err := clientcmd.BuildConfigFromFlags(context.String("master"), context.String("kubeconfig"))
+		if path := context.String("config"); path != "" {
+			if err := applyConfig(context, path); err != nil {
+				return errors.Wrapf(err, "failed to apply the config %s", path)
+			}
+		}
+		setContainerNameLength(context)
+		sidecars = context.StringSlice("sidecar")
+		apiToken = context.String("api-token")
+		if path := context.String("authz-policy"); path != "" {
+			policy, err := loadAuthzPolicy(path)
+			if err != nil {
+				return errors.Wrapf(err, "failed to load the authz policy %s", path)
+			}
+			authz = policy
+		}
+		predictedSteps = context.IntSlice("predict-pods")
+		nodes.window = context.Duration("node-window")
+		clusterWide.window = context.Duration("cluster-window")
+		excludeDegradedNodes = context.Bool("exclude-degraded-nodes")
+		genericWorkloads = context.Bool("generic-workloads")
+		cooldown.window = context.Duration("measurement-cooldown")
+		openShift = context.Bool("openshift")
+		argoRollouts = context.Bool("argo-rollouts")
+		podMetrics = context.Bool("pod-metrics")
+		writeReports = context.Bool("reports")
+		priorities.budget = context.Duration("update-budget")
+		smoother.factor = context.Float64("smoothing-factor")
+		if smoother.factor <= 0 || smoother.factor > 1 {
+			return errors.Errorf("smoothing factor %v is not in (0, 1]", smoother.factor)
+		}
+		smoother.minChange = context.Float64("min-change")
+		gcGracePeriod = context.Duration("gc-grace-period")
+		buckets, err := parseBuckets(context.String("buckets"))
 		if err != nil {
 			return err
 		}
+		if err := registerLatencyHistogram(buckets); err != nil {
+			return errors.Wrap(err, "failed to register the latency histogram")
+		}
+		objectives, err := parseQuantiles(context.String("quantiles"))
+		if err != nil {
+			return err
+		}
+		if err := registerLatencySummary(objectives, context.Duration("quantiles-max-age"), context.Int("quantiles-age-buckets")); err != nil {
+			return errors.Wrap(err, "failed to register the latency summary")
+		}
+		if err := registerExtraLabels(context.StringSlice("extra-label")); err != nil {
+			return errors.Wrap(err, "failed to register extra labels")
+		}
+		measureScaleDown = context.Bool("scale-down")
+		scaleTimeSource = context.String("scale-time-source")
+		if scaleTimeSource != scaleTimeNode && scaleTimeSource != scaleTimeReceive {
+			return errors.Errorf("invalid scale time source %q", scaleTimeSource)
+		}
+		health.policy = context.String("ready-clusters")
+		if health.policy != readyAny && health.policy != readyAll {
+			return errors.Errorf("invalid ready clusters %q", health.policy)
+		}
+		alerts.urls = context.StringSlice("alertmanager")
+		alerts.startupThreshold = context.Float64("alert-startup-latency")
+		alerts.scaleThreshold = context.Float64("alert-scale-latency")
+		if len(alerts.urls) > 0 && alerts.startupThreshold <= 0 && alerts.scaleThreshold <= 0 {
+			return errors.New("an alert threshold must be set to post alerts to Alertmanager")
+		}
+		standalone = context.Bool("standalone")
+		if standalone {
+			if err := registerStandalone(context.StringSlice("extra-label")); err != nil {
+				return errors.Wrap(err, "failed to register the standalone metrics")
+			}
+		}
+		if path := context.String("event-store"); path != "" {
+			if context.Duration("event-retention") <= 0 || context.Duration("event-vacuum-interval") <= 0 {
+				return errors.New("event retention and vacuum interval must be positive")
+			}
+			startupEvents.retention = context.Duration("event-retention")
+			if err := startupEvents.open(path); err != nil {
+				return errors.Wrapf(err, "failed to open the event store %s", path)
+			}
+		}
+		allInfo.maxEntries = context.Int("max-records")
+		allInfo.maxBytes = context.Int("max-records-bytes")
+		for _, f := range context.StringSlice("from-file") {
+			n, err := loadRecords(f)
+			if err != nil {
+				return errors.Wrapf(err, "failed to load records from %s", f)
+			}
+			logrus.Infof("loaded %d records from %s", n, f)
+		}
+		if path := context.String("state-file"); path != "" {
+			if context.Duration("state-interval") <= 0 {
+				return errors.New("state interval must be positive")
+			}
+			state.interval = context.Duration("state-interval")
+			records, deploys, err := state.open(path)
+			if err != nil {
+				return errors.Wrapf(err, "failed to load the state from %s", path)
+			}
+			logrus.Infof("loaded %d records and %d deployments from %s", records, deploys, path)
+		}
+		if addr := context.String("mirror-to"); addr != "" {
+			if context.Int("mirror-spool") <= 0 {
+				return errors.New("mirror spool must be positive")
+			}
+			u, err := exporterURL(addr)
+			if err != nil {
+				return err
+			}
+			mirror.url, mirror.token, mirror.max = u, context.String("mirror-token"), context.Int("mirror-spool")
+		}
+		warmUp(context.StringSlice("warm-up-from"), context.String("warm-up-token"), context.Duration("warm-up-timeout"))
+		// records loaded from files aren't limited by the quotas
+		quotas.rate = context.Int("namespace-rate")
+		quotas.retain = context.Int("namespace-retain")
+		offline = context.Bool("offline")
+		profiler.threshold = context.Duration("slow-loop-threshold")
+		profiler.dir = context.String("profile-dir")
+		profiler.kind = context.String("profile-type")
+		if profiler.kind != profileTypeCPU && profiler.kind != profileTypeTrace {
+			return errors.Errorf("unknown profile type %q", profiler.kind)
+		}
+		if context.Bool("access-log") {
+			enableAccessLog()
+		}
+		history.retention = context.Duration("history-retention")
+		if path := context.String("measurement-log"); path != "" && path != "-" && history.retention > 0 {
+			n, err := history.load(path)
+			if err != nil {
+				return errors.Wrapf(err, "failed to load the history from %s", path)
+			}
+			logrus.Infof("loaded %d measurements from %s", n, path)
+		}
+		if err := measurements.open(context.String("measurement-log"), context.String("run-id")); err != nil {
+			return errors.Wrap(err, "failed to open the measurement log")
+		}
 		signalC := make(chan os.Signal, 1024)
 		signal.Notify(signalC, handledSignals...)
 		done := handleSignals(signalC)
-		kubeClient, err := kubernetes.NewForConfig(clientCmdConfig)
-		if err != nil {
-			return err
+		if state.db != nil {
+			go state.run(done)
+		}
+		if mirror.url != "" {
+			go mirror.run(done)
 		}
-		go updateDeployScaleLatency(kubeClient, done)
+		if startupEvents.enabled() {
+			go startupEvents.run(context.Duration("event-vacuum-interval"), done)
+		}
+		if offline {
+			// the records don't change once they are loaded
+			exportOffline()
+		}
+		if standalone && !offline {
+			go updateStandalone(done)
+		} else if !offline {
+			clusters, err := loadClusters(context.String("kubeconfig"), context.String("master"), context.StringSlice("context"))
+			if err != nil {
+				return err
+			}
+			if authz != nil {
+				// ServiceAccount tokens are reviewed by the cluster of
+				// the exporter
+				authz.reviewer = clusters[0].client
+			}
+			if openShift {
+				watchDeploymentConfigs(clusters)
+			}
+			if argoRollouts {
+				watchRollouts(clusters)
+			}
+			if genericWorkloads {
+				watchCronJobs(clusters)
+			}
+			if s := context.String("collector-service"); s != "" {
+				service, err := parseService(s)
+				if err != nil {
+					return err
+				}
+				if context.Duration("pull-interval") <= 0 {
+					return errors.New("pull interval must be positive")
+				}
+				// the collectors run in the cluster of the exporter,
+				// which is the first one
+				if context.String("collector-token") == "" {
+					return errors.New("the token of the collectors must be provided")
+				}
+				puller := watchCollectors(clusters[0], service, context.Duration("pull-interval"), context.String("collector-token"))
+				go puller.run(done)
+			}
+			if addr := context.String("custom-metrics-addr"); addr != "" {
+				go func() {
+					if err := serveCustomMetrics(addr, context.String("custom-metrics-cert"), context.String("custom-metrics-key"), clusters[0]); err != nil {
+						logrus.WithError(err).Fatal("failed to serve the custom metrics API")
+					}
+				}()
+			}
+			experiments.clusters = clusters
+			health.clusters = clusters
+			resolver = statusResolver{clusters: clusters}
+			go updateDeployScaleLatency(clusters, done)
+		}
+		// HTTP/1.1 and cleartext HTTP/2 are served on the same port, gRPC
+		// requests are routed by their path, so only one port needs to be
+		// exposed
 		svr := &http.Server{
-			Addr: "0.0.0.0:" + port,
+			Addr:    net.JoinHostPort(context.String("host"), port),
+			Handler: h2c.NewHandler(instrument(http.DefaultServeMux, authorize(http.DefaultServeMux)), &http2.Server{}),
+		}
+		certFile := context.String("tls-cert")
+		if certFile != "" {
+			if svr.TLSConfig, err = serverTLSConfig(context.String("client-ca")); err != nil {
+				return errors.Wrap(err, "failed to load the client CA")
+			}
 		}
 		http.HandleFunc("/", receiveStartupInfo)
+		http.Handle(ingestGRPCRoute, newIngestHandler())
 		http.Handle("/metrics", promhttp.Handler())
+		http.HandleFunc("/api/v1/drain", handleDrain)
+		http.HandleFunc("/api/v1/sessions", handleSessions)
+		http.HandleFunc("/api/v1/sessions/", handleSessions)
+		http.HandleFunc("/api/v1/stream", handleStream)
+		http.HandleFunc("/api/v1/experiments", handleExperiments)
+		http.HandleFunc("/api/v1/experiments/", handleExperiments)
+		http.HandleFunc("/api/v1/records", handleRecords)
+		http.HandleFunc("/api/v1/heatmap", handleHeatmap)
+		http.HandleFunc("/api/v1/analysis", handleAnalysis)
+		http.HandleFunc("/api/v1/history", handleHistory)
+		http.HandleFunc("/api/v1/deployments", handleDeployments)
+		http.HandleFunc("/api/v1/deployments/", handleDeployments)
+		http.HandleFunc("/api/v1/reset", requireToken(handleReset))
+		http.HandleFunc("/api/v1/priorities", requireToken(handlePriorities))
+		http.HandleFunc("/api/v1/priorities/", requireToken(handlePriorities))
+		http.HandleFunc("/api/v1/state", handleState)
+		http.HandleFunc("/api/v1/events", handleEvents)
+		http.HandleFunc("/api/v1/export", handleDataExport)
+		http.HandleFunc("/api/v1/export/schema", handleDataExportSchema)
+		http.HandleFunc("/openapi.json", handleOpenAPI)
+		http.HandleFunc("/debug/state", handleDebugState)
+		http.HandleFunc("/healthz", handleHealthz)
+		http.HandleFunc("/readyz", handleReadyz)
 		logrus.Info("exporter started")
 		exit := make(chan struct{})
 		go func() {
 			<-done
 			svr.Shutdown(gocontext.Background())
+			state.close()
+			startupEvents.close()
 			close(exit)
 		}()
-		if err = svr.ListenAndServe(); err != http.ErrServerClosed {
+		serve := svr.ListenAndServe
+		if certFile != "" {
+			serve = func() error { return svr.ListenAndServeTLS(certFile, context.String("tls-key")) }
+		}
+		if err := serve(); err != http.ErrServerClosed {
 			return err
 		}
 		<-exit
@@ -129,72 +778,180 @@ func receiveStartupInfo(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	var info containerStartupInfo
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&info); err != nil {
-		logrus.WithError(err).Error("failed to decode data")
+	if offline {
+		writeError(w, http.StatusServiceUnavailable, "the exporter is offline")
+		return
+	}
+	id := requestID(w, r)
+	checkCollectorVersion(r)
+	recordCollectorNetworkMode(r)
+	records, rejected, err := decodeStartupRecords(r.Body)
+	if err != nil {
+		logrus.WithError(err).WithField("request_id", id).Error("failed to decode data")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	writeJSON(w, http.StatusOK, acceptStartupRecords(id, r.Header.Get(nodeHeader), records, rejected))
+}
+
+// acceptStartupRecords ingests a batch of valid records from the collector
+// of the node.
+func acceptStartupRecords(id, node string, records []startupRecord, rejected int) *ingestResult {
+	receivedBatchSize.Observe(float64(len(records) + rejected))
+	if rejected > 0 {
+		logrus.WithField("request_id", id).Warnf("rejected %d invalid records from %s", rejected, node)
+	}
+	logrus.WithField("request_id", id).Debugf("received %d records from %s", len(records), node)
+	for _, info := range records {
+		if node != "" {
+			info.Node = node
+		}
+		// records mirrored from another exporter keep their request
+		if info.RequestID == "" {
+			info.RequestID = id
+		}
+		ingest(info)
+	}
+	return &ingestResult{Accepted: len(records), Rejected: rejected}
+}
+
+// ingestResult is the response to a batch of startup info, the rejected
+// records are invalid and shouldn't be sent again.
+type ingestResult struct {
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+}
+
+// ingest adds a startup record to the exporter.
+func ingest(info startupRecord) {
 	mu.Lock()
 	defer mu.Unlock()
-	currentStartupLatency.WithLabelValues(info.Type, info.Namespace).Set(float64(info.End - info.Start))
+	currentStartupLatency.WithLabelValues(info.Type, info.Namespace, info.Node).Set(info.milliseconds())
 	m := meta{
 		name:      info.Name,
 		namespace: info.Namespace,
 	}
-	if _, exists := allInfo[m]; !exists {
-		allInfo[m] = info
+	// every attempt of a container is observed once, whatever order the
+	// collectors send them in, the latest one is the one aggregated
+	if seenAttempts[m].has(info.Attempt) {
+		return
+	}
+	old, exists := allInfo.get(m)
+	if !quotas.admit(m, info, !exists) {
+		logrus.WithField("request_id", info.RequestID).Debugf("dropped container %s over the quota of namespace %s", containerShortName(info.Name), quotaNamespace(info))
+		return
+	}
+	seenAttempts[m] = seenAttempts[m].add(info.Attempt)
+	logrus.WithField("request_id", info.RequestID).Debugf("accepted attempt %d of container %s", info.Attempt, containerShortName(info.Name))
+	startupEvents.add(info)
+	mirror.add(info)
+	stream.publish(streamEventRecord, info)
+	if attemptStartupLatency != nil {
+		attemptStartupLatency.WithLabelValues(info.Type, info.Namespace, attemptLabel(info.Attempt)).Observe(info.milliseconds())
+	}
+	if !exists || info.Attempt > old.Attempt {
+		for _, evicted := range allInfo.put(m, info) {
+			forget(evicted)
+		}
+		lastSeen[m] = clk.Now()
+		verifier.add(m)
+		state.put(info)
+		sessions.addRecord(info)
+		observeExtras(info)
+		nodes.add(info)
+		if typeStartupLatency != nil {
+			typeStartupLatency.WithLabelValues(info.Type).Observe(info.milliseconds())
+		}
+		if latency, ok := sandboxBoot(info); ok {
+			sandboxBootLatency.WithLabelValues(info.Type, info.Namespace, info.Node).Set(latency)
+		}
+		if info.Snapshot != "" {
+			snapshotStartupLatency.WithLabelValues(info.Type, info.Namespace, info.Snapshot, info.Node).Set(info.milliseconds())
+		}
 		logrus.WithFields(logrus.Fields{
 			"name":      containerShortName(info.Name),
 			"namespace": info.Namespace,
 			"start":     info.Start,
 			"end":       info.End,
+			"attempt":   info.Attempt,
 		}).Debug("received a new container")
 	}
-	w.WriteHeader(http.StatusOK)
 }
 
-func updateDeployScaleLatency(kubeClient *kubernetes.Clientset, done <-chan struct{}) {
-	kubeInformerFactory := informers.NewSharedInformerFactory(kubeClient, 5*time.Second)
-	deploymentLister := kubeInformerFactory.Apps().V1().Deployments().Lister()
-	podLister := kubeInformerFactory.Core().V1().Pods().Lister()
-	go kubeInformerFactory.Start(done)
-	ticker := time.NewTicker(2 * time.Second)
+func updateDeployScaleLatency(clusters []*cluster, done <-chan struct{}) {
+	for _, c := range clusters {
+		go c.factory.Start(done)
+		go c.dynamicFactory.Start(done)
+	}
+	ticker := clk.NewTicker(2 * time.Second)
 	stop := false
 	for {
+		began := clk.Now()
+		profiler.begin()
+		collectGarbage(clusters)
+		collectors.prune()
+		verifyContainers()
+		priorities.snapshot()
 		deployPodsAvgStartupLatency.Reset()
-		deployments, err := deploymentLister.List(labels.Everything())
-		if err != nil {
-			logrus.WithError(err).Error("failed to list deployments in the cluster")
+		deploySidecarsAvgStartupLatency.Reset()
+		deployContainersAvgStartupLatency.Reset()
+		deployTypesAvgStartupLatency.Reset()
+		deployStuckContainers.Reset()
+		deploySkipped.Reset()
+		deployExcludedPods.Reset()
+		deployDegradedNodePods.Reset()
+		deployPrestartLatency.Reset()
+		deployAdmissionToStartLatency.Reset()
+		deployStartupProbeLatency.Reset()
+		deployScaleLatency.Reset()
+		deployScaleDownDuration.Reset()
+		deployScaleLatencyBySource.Reset()
+		deployPredictedScaleLatency.Reset()
+		deployLabels.Reset()
+		deployStrategyInfo.Reset()
+		deploySelfHealingLatency.Reset()
+		deployRolloutDuration.Reset()
+		deployRevisionLatencyDelta.Reset()
+		deployRevisionLatencyRatio.Reset()
+		workloadAvgStartupLatency.Reset()
+		workloadScaleLatency.Reset()
+		jobStartupLatency.Reset()
+		rolloutAvgStartupLatency.Reset()
+		podStartupLatency.Reset()
+		if genericWorkloads {
+			updateGenericWorkloads(clusters)
 		} else {
-			for _, d := range deployments {
-				if d != nil {
-					m := meta{name: d.Name, namespace: d.Namespace}
-					if d.Spec.Selector == nil {
-						logrus.Errorf("deployment %s from %s has an empty selector", d.Name, d.Namespace)
-						continue
-					}
-					pods, err := podLister.Pods(d.Namespace).List(makeSelector(*d.Spec.Selector))
-					if err != nil {
-						logrus.WithError(err).Errorf("failed to list pods belongs to %s", d.Name)
-					}
-					if !shouldUpdate(m, pods) {
-						continue
-					}
-					logrus.Debugf("new deployment %s from %s", d.Name, d.Namespace)
-					if updated, err := doUpdate(d, pods); err != nil {
-						logrus.Error(err)
-					} else if updated {
-						logrus.Debugf("update deployment %s(%s) successfully", d.Name, d.Namespace)
-					}
-				}
+			updateDeployments(clusters)
+			if writeReports {
+				reports.start(clusters)
+			}
+			updateStatefulSets(clusters)
+			updateDaemonSets(clusters)
+			updateJobs(clusters)
+			if openShift {
+				updateDeploymentConfigs(clusters)
+			}
+			if argoRollouts {
+				updateRollouts(clusters)
 			}
+			scales.export()
+			alerts.evaluate()
+		}
+		if podMetrics {
+			exportPodLatency(clusters)
+		}
+		exportNamespaceLatency(clusters)
+		clusterWide.export()
+		nodes.export()
+		for _, c := range clusters {
+			c.healing.export(c)
 		}
+		exportQueueLengths()
+		profiler.end(clk.Since(began))
 		select {
 		case <-done:
 			stop = true
-		case <-ticker.C:
+		case <-ticker.C():
 		}
 		if stop {
 			break
@@ -202,6 +959,99 @@ func updateDeployScaleLatency(kubeClient *kubernetes.Clientset, done <-chan stru
 	}
 }
 
+// updateDeployments measures the deployments of the clusters.
+func updateDeployments(clusters []*cluster) {
+	var (
+		deployments = map[*cluster][]*appsv1.Deployment{}
+		existing    = map[deployKey]struct{}{}
+		listed      = true
+	)
+	for _, c := range clusters {
+		ds, err := c.deploymentLister.List(labels.Everything())
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to list deployments in the cluster %s", c.name)
+			listed = false
+			continue
+		}
+		for _, d := range ds {
+			if d != nil {
+				existing[deployKey{cluster: c.name, meta: meta{name: d.Name, namespace: d.Namespace}}] = struct{}{}
+				deployments[c] = append(deployments[c], d)
+			}
+		}
+	}
+	experiments.expire()
+	if listed {
+		drain.prune(existing)
+		scales.prune(existing)
+		smoother.prune("", existing)
+		deployStatuses.prune(existing)
+		histogramDeploys.prune(existing)
+		cooldown.prune(existing)
+		reports.prune(existing)
+		priorities.prune(existing)
+		rollouts.prune(existing)
+		revisions.prune(existing)
+		for _, c := range clusters {
+			c.healing.prune(c, existing)
+		}
+	}
+	priorities.update(deployments)
+}
+
+func (c *cluster) updateDeployment(d *appsv1.Deployment) {
+	m := meta{name: d.Name, namespace: d.Namespace}
+	k := deployKey{cluster: c.name, meta: m}
+	exportDeployLabels(c, d)
+	exportDeployStrategy(c, d)
+	if !drain.admit(k) {
+		return
+	}
+	if d.Spec.Selector == nil {
+		logrus.Errorf("deployment %s from %s has an empty selector", d.Name, d.Namespace)
+		return
+	}
+	rollouts.track(c, d)
+	if reason := skipReason(k, d); reason != "" {
+		deploySkipped.WithLabelValues(d.Name, d.Namespace, c.name, reason).Set(1)
+		return
+	}
+	pods, err := c.podLister.Pods(d.Namespace).List(makeSelector(*d.Spec.Selector))
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to list pods belongs to %s", d.Name)
+	}
+	pods = c.owners.ownedBy(m, pods)
+	scales.track(c, d, pods)
+	c.healing.track(c, d, pods)
+	c.volumes.export(c, d, pods)
+	exportAdmissionLatency(c, d, pods)
+	exportSandboxBootLatency(c, d, pods)
+	exportStartupProbeLatency(c, d, pods)
+	if stuck := stuckContainers(pods); len(stuck) > 0 {
+		for reason, n := range stuck {
+			deployStuckContainers.WithLabelValues(d.Name, d.Namespace, c.name, reason).Set(float64(n))
+		}
+		logrus.Warnf("deployment %s(%s) has stuck containers %v", d.Name, d.Namespace, stuck)
+		return
+	}
+	if !shouldUpdate(m, pods) {
+		return
+	}
+	if cooldown.skip(k, pods) {
+		drain.track(k, true)
+		return
+	}
+	logrus.Debugf("new deployment %s from %s", d.Name, d.Namespace)
+	if updated, err := doUpdate(c, d, pods); err != nil {
+		logrus.Error(err)
+	} else {
+		drain.track(k, updated)
+		if updated {
+			logrus.Debugf("update deployment %s(%s) successfully", d.Name, d.Namespace)
+		}
+	}
+}
+
 func shouldUpdate(m meta, currentPods []*corev1.Pod) bool {
 	if len(currentPods) == 0 {
 		return false
@@ -222,43 +1072,135 @@ func shouldUpdate(m meta, currentPods []*corev1.Pod) bool {
 	return true
 }
 
-func doUpdate(deploy *appsv1.Deployment, pods []*corev1.Pod) (bool, error) {
+// stuckContainers counts the containers of the pods by the reason they are
+// stuck in, e.g. ImagePullBackOff or CrashLoopBackOff.
+func stuckContainers(pods []*corev1.Pod) map[string]int {
+	stuck := map[string]int{}
+	for _, p := range pods {
+		if p == nil {
+			continue
+		}
+		for _, c := range p.Status.ContainerStatuses {
+			if c.State.Waiting == nil {
+				continue
+			}
+			if _, ok := stuckReasons[c.State.Waiting.Reason]; ok {
+				stuck[c.State.Waiting.Reason]++
+			}
+		}
+	}
+	return stuck
+}
+
+func doUpdate(c *cluster, deploy *appsv1.Deployment, pods []*corev1.Pod) (bool, error) {
 	var (
 		targetLen       = 0
 		total           float64
 		unreceivedNames []string
 		name            string
+		sidecarTotal    = map[string]float64{}
+		sidecarCount    = map[string]int{}
+		containerTotal  = map[string]float64{}
+		containerCount  = map[string]int{}
+		typeTotal       = map[string]float64{}
+		typeCount       = map[string]int{}
+		evicted         = 0
+		degraded        = map[string]int{}
 	)
 	for _, p := range pods {
 		if p != nil {
-			targetLen += len(p.Spec.Containers)
-			for _, c := range p.Status.ContainerStatuses {
-				if strings.HasPrefix(c.ContainerID, containerNamePrefix) {
-					name = strings.TrimPrefix(c.ContainerID, containerNamePrefix)
+			if c.evictions.isReplacement(p) {
+				evicted++
+				continue
+			}
+			if reason := c.nodes.degradedReason(p.Spec.NodeName, podStarted(p)); reason != "" {
+				degraded[reason]++
+				if excludeDegradedNodes {
+					continue
+				}
+			}
+			for _, container := range p.Spec.Containers {
+				if !isSidecar(container.Name, container.Image) {
+					targetLen++
+				}
+			}
+			for _, status := range p.Status.ContainerStatuses {
+				sidecar := isSidecar(status.Name, status.Image)
+				if strings.HasPrefix(status.ContainerID, containerNamePrefix) {
+					name = strings.TrimPrefix(status.ContainerID, containerNamePrefix)
 				} else {
-					return false, errors.Errorf("container %s(%s) of deployment %s(%s) is not running by containerd", c.Name, c.ContainerID, p.Name, p.Namespace)
+					return false, errors.Errorf("container %s(%s) of deployment %s(%s) is not running by containerd", status.Name, status.ContainerID, p.Name, p.Namespace)
 				}
 				mu.Lock()
-				if info, exists := allInfo[meta{name: name, namespace: defaultContainerdK8sNamespace}]; exists {
-					total += float64(info.End - info.Start)
-				} else {
+				m := meta{name: name, namespace: defaultContainerdK8sNamespace}
+				if info, exists := allInfo.get(m); exists {
+					containerTotal[status.Name] += info.milliseconds()
+					containerCount[status.Name]++
+					if sidecar {
+						sidecarTotal[status.Name] += info.milliseconds()
+						sidecarCount[status.Name]++
+					} else {
+						total += info.milliseconds()
+						typeTotal[info.Type] += info.milliseconds()
+						typeCount[info.Type]++
+						observeContainer(deployKey{cluster: c.name, meta: meta{name: deploy.Name, namespace: deploy.Namespace}}, m, info)
+					}
+				} else if !sidecar {
 					unreceivedNames = append(unreceivedNames, containerShortName(name))
 				}
 				mu.Unlock()
 			}
 		}
 	}
+	setExcluded := func() {
+		if evicted > 0 {
+			deployExcludedPods.WithLabelValues(deploy.Name, deploy.Namespace, c.name, excludeReasonEviction).Set(float64(evicted))
+		}
+		for reason, n := range degraded {
+			if excludeDegradedNodes {
+				deployExcludedPods.WithLabelValues(deploy.Name, deploy.Namespace, c.name, reason).Set(float64(n))
+			} else {
+				deployDegradedNodePods.WithLabelValues(deploy.Name, deploy.Namespace, c.name, reason).Set(float64(n))
+			}
+		}
+	}
+	setExcluded()
 	receivedLen := targetLen - len(unreceivedNames)
 	logrus.Debugf("%d containers total, %d received, need %v", targetLen, receivedLen, unreceivedNames)
 	if receivedLen == 0 {
 		return false, nil
 	}
-	if receivedLen != targetLen {
+	if receivedLen < minSamples(deploy, targetLen) {
 		return false, nil
 	}
 	avg := total / float64(receivedLen)
+	k := deployKey{cluster: c.name, meta: meta{name: deploy.Name, namespace: deploy.Namespace}}
 	logrus.Debugf("update average startup latency of deployment %s(%s) to %v", deploy.Name, deploy.Namespace, avg)
-	deployPodsAvgStartupLatency.WithLabelValues(deploy.Name, deploy.Namespace).Set(avg)
+	smoothed := smoother.smooth(smoothKey{metric: smoothedAverageStartup, deployKey: k}, avg)
+	setAverages := func() {
+		deployPodsAvgStartupLatency.WithLabelValues(deploy.Name, deploy.Namespace, c.name, runtimeClass(deploy.Spec.Template.Spec)).Set(smoothed)
+		for container, t := range sidecarTotal {
+			deploySidecarsAvgStartupLatency.WithLabelValues(deploy.Name, deploy.Namespace, c.name, container).Set(t / float64(sidecarCount[container]))
+		}
+		for container, t := range containerTotal {
+			deployContainersAvgStartupLatency.WithLabelValues(deploy.Name, deploy.Namespace, c.name, container).Set(t / float64(containerCount[container]))
+		}
+		// restored from a checkpoint or started cold
+		for t, total := range typeTotal {
+			deployTypesAvgStartupLatency.WithLabelValues(deploy.Name, deploy.Namespace, c.name, t).Set(total / float64(typeCount[t]))
+		}
+		revisions.export(k)
+	}
+	revisions.record(k, deploy, avg)
+	setAverages()
+	measurements.log(k, receivedLen, avg)
+	if status, changed := deployStatuses.update(k, receivedLen, avg); changed {
+		stream.publish(streamEventAggregate, status)
+	}
+	cooldown.published(k, pods, func() {
+		setExcluded()
+		setAverages()
+	})
 	return true, nil
 }
 
@@ -273,11 +1215,3 @@ func makeSelector(labelSeletor metav1.LabelSelector) labels.Selector {
 	}
 	return selector
 }
-
-func containerShortName(name string) string {
-	n := len(name)
-	if n > maxContainerNameLength {
-		return name[:maxContainerNameLength]
-	}
-	return name
-}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// extraLabels holds the keys of the shim-provided extras which are
+	// exported as labels
+	extraLabels         []string
+	extraStartupLatency *prometheus.GaugeVec
+)
+
+// extraLabelName turns the key of an extra into a valid label name.
+func extraLabelName(key string) string {
+	return "extra_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// registerExtraLabels registers the metric which is labeled by the extras with
+// the keys.
+func registerExtraLabels(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	labelNames := []string{"type", "namespace"}
+	for _, k := range keys {
+		labelNames = append(labelNames, extraLabelName(k))
+	}
+	extraLabels = keys
+	extraStartupLatency = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemPod,
+			Name:      "extra_startup_latency_milliseconds",
+		},
+		labelNames,
+	)
+	return prometheus.Register(extraStartupLatency)
+}
+
+// observeExtras exports the startup latency of a record labeled by its extras.
+func observeExtras(r startupRecord) {
+	if extraStartupLatency == nil {
+		return
+	}
+	values := []string{r.Type, r.Namespace}
+	for _, k := range extraLabels {
+		values = append(values, r.Extras[k])
+	}
+	extraStartupLatency.WithLabelValues(values...).Set(r.milliseconds())
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const defaultGCGracePeriod = 10 * time.Minute
+
+var (
+	// gcGracePeriod is how long a container may be absent from all pods
+	// before its startup info is removed, 0 disables the GC
+	gcGracePeriod = defaultGCGracePeriod
+	// lastSeen records when a container was last seen in the status of a pod
+	// or received from a collector
+	lastSeen = map[meta]time.Time{}
+	// seenAttempts holds the start attempts of every container received, so
+	// an attempt sent again is ignored
+	seenAttempts = map[meta]attemptSet{}
+)
+
+// collectGarbage removes the startup info of containers which don't belong to
+// any pod of the clusters for longer than the grace period.
+func collectGarbage(clusters []*cluster) {
+	if gcGracePeriod <= 0 {
+		return
+	}
+	now := clk.Now()
+	running := map[string]struct{}{}
+	for _, c := range clusters {
+		pods, err := c.podLister.List(labels.Everything())
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to list pods of cluster %s for the gc", c.name)
+			return
+		}
+		for _, p := range pods {
+			for _, status := range p.Status.ContainerStatuses {
+				if strings.HasPrefix(status.ContainerID, containerNamePrefix) {
+					running[strings.TrimPrefix(status.ContainerID, containerNamePrefix)] = struct{}{}
+				}
+			}
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	allInfo.each(func(m meta, _ startupRecord) {
+		if m.namespace != defaultContainerdK8sNamespace {
+			return
+		}
+		if _, exists := running[m.name]; exists {
+			lastSeen[m] = now
+			return
+		}
+		if now.Sub(lastSeen[m]) > gcGracePeriod {
+			allInfo.remove(m)
+			forget(m)
+			logrus.Debugf("removed container %s which belongs to no pod", containerShortName(m.name))
+		}
+	})
+}
+
+// forget drops what's kept of a container removed from the records, it must
+// be called with mu held.
+func forget(m meta) {
+	delete(lastSeen, m)
+	delete(seenAttempts, m)
+	state.remove(m)
+	delete(observedContainers, m)
+	verifier.forget(m)
+	quotas.release(m)
+}
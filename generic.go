@@ -0,0 +1,131 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	kindPod = "Pod"
+	// maxOwnerDepth bounds the walk up the controller references, so a
+	// reference cycle doesn't loop forever
+	maxOwnerDepth = 8
+)
+
+// cronJobResource is batch/v1beta1 as the clusters the exporter supports
+// don't serve CronJobs in batch/v1 yet
+var cronJobResource = schema.GroupVersionResource{Group: "batch", Version: "v1beta1", Resource: "cronjobs"}
+
+// genericWorkloads attributes pods to their top-level controller instead of
+// measuring the known kinds of workloads.
+var genericWorkloads bool
+
+// workloadRef identifies the top-level controller of pods in a namespace.
+type workloadRef struct {
+	kind string
+	meta
+}
+
+// watchCronJobs makes the clusters watch CronJobs, which own the jobs of
+// generic workloads.
+func watchCronJobs(clusters []*cluster) {
+	for _, c := range clusters {
+		c.cronJobLister = c.dynamicFactory.ForResource(cronJobResource).Lister()
+	}
+}
+
+// controller returns the object of the controller reference from the
+// listers of the cluster, it's nil if the kind isn't watched or the object
+// isn't the referenced one.
+func (c *cluster) controller(namespace string, ref *metav1.OwnerReference) metav1.Object {
+	var (
+		obj     metav1.Object
+		generic cache.GenericLister
+		err     error
+	)
+	switch ref.Kind {
+	case "ReplicaSet":
+		obj, err = c.rsLister.ReplicaSets(namespace).Get(ref.Name)
+	case "Deployment":
+		obj, err = c.deploymentLister.Deployments(namespace).Get(ref.Name)
+	case "StatefulSet":
+		obj, err = c.statefulSetLister.StatefulSets(namespace).Get(ref.Name)
+	case "DaemonSet":
+		obj, err = c.daemonSetLister.DaemonSets(namespace).Get(ref.Name)
+	case "Job":
+		obj, err = c.jobLister.Jobs(namespace).Get(ref.Name)
+	case "CronJob":
+		generic = c.cronJobLister
+	case "DeploymentConfig":
+		generic = c.deploymentConfigLister
+	case "Rollout":
+		generic = c.rolloutLister
+	}
+	if generic != nil {
+		var o runtime.Object
+		if o, err = generic.ByNamespace(namespace).Get(ref.Name); err == nil {
+			obj, err = apimeta.Accessor(o)
+		}
+	}
+	if err != nil || obj == nil || obj.GetUID() != ref.UID {
+		return nil
+	}
+	return obj
+}
+
+// topController returns the top-level controller of the pod and its object
+// by walking the controller references through every kind the cluster
+// watches, a pod without a controller is its own workload. The object is nil
+// if the top-level controller is of a kind which isn't watched.
+func (c *cluster) topController(p *corev1.Pod) (workloadRef, metav1.Object) {
+	var obj metav1.Object = p
+	top := workloadRef{kind: kindPod, meta: meta{name: p.Name, namespace: p.Namespace}}
+	for i := 0; i < maxOwnerDepth; i++ {
+		ref := metav1.GetControllerOf(obj)
+		if ref == nil {
+			break
+		}
+		top = workloadRef{kind: ref.Kind, meta: meta{name: ref.Name, namespace: p.Namespace}}
+		if obj = c.controller(p.Namespace, ref); obj == nil {
+			break
+		}
+	}
+	return top, obj
+}
+
+// updateGenericWorkloads groups the pods of the clusters by their top-level
+// controller and publishes the average startup latency of each group.
+func updateGenericWorkloads(clusters []*cluster) {
+	for _, c := range clusters {
+		pods, err := c.podLister.List(labels.Everything())
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to list pods in the cluster %s", c.name)
+			continue
+		}
+		groups := map[workloadRef][]*corev1.Pod{}
+		objects := map[workloadRef]metav1.Object{}
+		for _, p := range pods {
+			if p == nil {
+				continue
+			}
+			ref, obj := c.topController(p)
+			groups[ref] = append(groups[ref], p)
+			if obj != nil {
+				objects[ref] = obj
+			}
+		}
+		for ref, pods := range groups {
+			w, exists := objects[ref]
+			if !exists {
+				w = &metav1.ObjectMeta{Name: ref.name, Namespace: ref.namespace}
+			}
+			updateWorkload(c, ref.kind, w, pods)
+		}
+	}
+}
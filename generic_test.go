@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func controlledBy(kind, name string, uid types.UID) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, UID: uid, Controller: &controller}}
+}
+
+func TestTopControllerWalksOwnerChain(t *testing.T) {
+	cronJob := &unstructured.Unstructured{}
+	cronJob.SetGroupVersionKind(schema.GroupVersionKind{Group: "batch", Version: "v1beta1", Kind: "CronJob"})
+	cronJob.SetName("backup")
+	cronJob.SetNamespace("default")
+	cronJob.SetUID("c1")
+	cronJob.SetAnnotations(map[string]string{minSamplesAnnotation: "1"})
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name: "backup-1", Namespace: "default", UID: "j1",
+		OwnerReferences: controlledBy("CronJob", "backup", "c1"),
+	}}
+	jobs := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	cronJobs := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := jobs.Add(job); err != nil {
+		t.Fatal(err)
+	}
+	if err := cronJobs.Add(cronJob); err != nil {
+		t.Fatal(err)
+	}
+	c := &cluster{
+		jobLister:     batchlisters.NewJobLister(jobs),
+		cronJobLister: cache.NewGenericLister(cronJobs, cronJobResource.GroupResource()),
+	}
+	p := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: "backup-1-x", Namespace: "default",
+		OwnerReferences: controlledBy("Job", "backup-1", "j1"),
+	}}
+	ref, obj := c.topController(p)
+	if ref.kind != "CronJob" || ref.name != "backup" {
+		t.Fatalf("got %+v, want the cron job", ref)
+	}
+	if obj == nil || obj.GetAnnotations()[minSamplesAnnotation] != "1" {
+		t.Errorf("got %v, want the object of the cron job", obj)
+	}
+
+	// a controller of a kind which isn't watched is the top one
+	c.cronJobLister = nil
+	if ref, obj := c.topController(p); ref.kind != "CronJob" || obj != nil {
+		t.Errorf("got %+v, %v, want the reference of the cron job without its object", ref, obj)
+	}
+}
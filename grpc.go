@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ingestServiceName is the gRPC service collectors may push startup info
+	// with instead of POST on /, it's served on the exporter port next to
+	// the HTTP API and the metrics
+	ingestServiceName = "startupexporter.v1.Ingest"
+	// ingestGRPCRoute is the route of the methods of the ingest service
+	ingestGRPCRoute = "/" + ingestServiceName + "/"
+	// grpcCodecJSON is the content subtype of the messages of the ingest
+	// service, they are the JSON of the HTTP API, so neither side needs
+	// generated code
+	grpcCodecJSON = "json"
+)
+
+// ingestRequest is the message of Push, the records are an object or an
+// array of the startup info POST on / takes.
+type ingestRequest struct {
+	Records json.RawMessage `json:"records"`
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return grpcCodecJSON }
+
+var ingestServiceDesc = grpc.ServiceDesc{
+	ServiceName: ingestServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Push",
+		Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := &ingestRequest{}
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			return pushStartupInfo(ctx, req)
+		},
+	}},
+	Metadata: "startupexporter/v1/ingest",
+}
+
+// newIngestHandler returns the handler of the gRPC ingest service, the
+// requests come through the HTTP/2 server of the exporter port, so gRPC, the
+// HTTP API and the metrics share one listener.
+func newIngestHandler() http.Handler {
+	encoding.RegisterCodec(jsonCodec{})
+	s := grpc.NewServer()
+	s.RegisterService(&ingestServiceDesc, struct{}{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checkCollectorVersion(r)
+		recordCollectorNetworkMode(r)
+		s.ServeHTTP(w, r)
+	})
+}
+
+// pushStartupInfo ingests the records of a Push like receiveStartupInfo.
+func pushStartupInfo(ctx context.Context, req *ingestRequest) (*ingestResult, error) {
+	if offline {
+		return nil, status.Error(codes.Unavailable, "the exporter is offline")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	id, node := first(md.Get(requestIDHeader)), first(md.Get(nodeHeader))
+	if id == "" {
+		id = newID()
+	}
+	if err := grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id)); err != nil {
+		logrus.WithError(err).WithField("request_id", id).Debug("failed to set the request ID")
+	}
+	records, rejected, err := decodeStartupRecords(bytes.NewReader(req.Records))
+	if err != nil {
+		logrus.WithError(err).WithField("request_id", id).Error("failed to decode data")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return acceptStartupRecords(id, node, records, rejected), nil
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
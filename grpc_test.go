@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestPushOverGRPC(t *testing.T) {
+	resetRecords()
+	defer resetRecords()
+	mux := http.NewServeMux()
+	mux.Handle(ingestGRPCRoute, newIngestHandler())
+	svr := httptest.NewServer(h2c.NewHandler(mux, &http2.Server{}))
+	defer svr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, strings.TrimPrefix(svr.URL, "http://"), grpc.WithInsecure(), grpc.WithBlock(),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(grpcCodecJSON)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	req := &ingestRequest{Records: []byte(`[{"name":"a","namespace":"k8s.io","type":"default","start":1,"end":2},{"name":"b"}]`)}
+	res := &ingestResult{}
+	ctx = metadata.AppendToOutgoingContext(ctx, nodeHeader, "node-1")
+	if err := conn.Invoke(ctx, ingestGRPCRoute+"Push", req, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Accepted != 1 || res.Rejected != 1 {
+		t.Errorf("accepted %d and rejected %d records, want 1 and 1", res.Accepted, res.Rejected)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	r, exists := allInfo.get(meta{name: "a", namespace: "k8s.io"})
+	if !exists || r.Node != "node-1" || r.RequestID == "" {
+		t.Errorf("got record %+v, want it from node-1 with a request ID", r)
+	}
+}
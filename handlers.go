@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// writeJSON writes v as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.WithError(err).Error("failed to encode the response")
+	}
+}
+
+// writeError writes an error message as the JSON body of the response.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// handleRecords pages the startup records the exporter retains with GET on
+// /api/v1/records, they can be filtered by the namespace and type
+// parameters.
+func handleRecords(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	namespace, t := r.URL.Query().Get("namespace"), r.URL.Query().Get("type")
+	var items []listItem
+	mu.Lock()
+	allInfo.each(func(_ meta, record startupRecord) {
+		if (namespace != "" && record.Namespace != namespace) || (t != "" && record.Type != t) {
+			return
+		}
+		items = append(items, listItem{value: record, name: record.Namespace + "/" + record.Name, latency: record.milliseconds(), time: record.Received})
+	})
+	mu.Unlock()
+	writeList(w, r, items)
+}
+
+// handleReset forgets the retained startup records and the measurements
+// derived from them with POST on /api/v1/reset, so a benchmark run starts
+// from a clean state. Sessions and experiments are kept.
+func handleReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "only POST is allowed")
+		return
+	}
+	mu.Lock()
+	allInfo.reset()
+	lastSeen = map[meta]time.Time{}
+	seenAttempts = map[meta]attemptSet{}
+	observedContainers = map[meta]struct{}{}
+	quotas.reset()
+	state.clear()
+	mu.Unlock()
+	nodes.reset()
+	clusterWide.reset()
+	rollouts.reset()
+	revisions.reset()
+	history.reset()
+	scales.reset()
+	statefulSetScales.reset()
+	daemonSetScales.reset()
+	deploymentConfigScales.reset()
+	rolloutScales.reset()
+	smoother.reset()
+	deployStatuses.reset()
+	cooldown.reset()
+	logrus.Info("reset the startup records")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// healingTimeout is how long a deployment may take to replace a deleted pod
+// before the deletion is forgotten.
+const healingTimeout = 30 * time.Minute
+
+var deploySelfHealingLatency = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystemDeploy,
+		Name:      "self_healing_latency_milliseconds",
+	},
+	[]string{
+		"deploy_name",
+		"namespace",
+		"cluster",
+	},
+)
+
+// podDeletion is a pod of a deployment being deleted while the deployment is
+// not scaling down or rolling out.
+type podDeletion struct {
+	at time.Time
+	// hash is the pod template hash of the deleted pod, its replacements
+	// have the same one
+	hash string
+	// experiment is the ID of the experiment which deleted the pod
+	experiment string
+	tags       map[string]string
+}
+
+// healingTracker measures how long deployments take to get back to all of
+// their replicas ready after a pod is deleted.
+type healingTracker struct {
+	sync.Mutex
+	owners           *ownerCache
+	deploymentLister appslisters.DeploymentLister
+	// seen holds the UIDs of the deleted pods, so a deletion noticed more
+	// than once is counted once
+	seen map[types.UID]struct{}
+	// expected holds the deletions of pods requested by experiments
+	expected  map[types.UID]podDeletion
+	deletions map[meta][]podDeletion
+	// latency holds the last self-healing latency of the deployments
+	latency map[meta]float64
+}
+
+// newHealingTracker registers the event handlers which track pod deletions on
+// the informers.
+func newHealingTracker(factory informers.SharedInformerFactory, owners *ownerCache) *healingTracker {
+	h := &healingTracker{
+		owners:           owners,
+		deploymentLister: factory.Apps().V1().Deployments().Lister(),
+		seen:             map[types.UID]struct{}{},
+		expected:         map[types.UID]podDeletion{},
+		deletions:        map[meta][]podDeletion{},
+		latency:          map[meta]float64{},
+	}
+	factory.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(_, obj interface{}) {
+			if p, ok := obj.(*corev1.Pod); ok && p.DeletionTimestamp != nil {
+				h.podDeleted(p)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			p, ok := obj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+			h.podDeleted(p)
+			h.Lock()
+			delete(h.seen, p.UID)
+			h.Unlock()
+		},
+	})
+	return h
+}
+
+// deletedAt returns when the deletion of the pod was requested.
+func deletedAt(p *corev1.Pod) time.Time {
+	if p.DeletionTimestamp == nil {
+		return clk.Now()
+	}
+	at := p.DeletionTimestamp.Time
+	if p.DeletionGracePeriodSeconds != nil {
+		at = at.Add(-time.Duration(*p.DeletionGracePeriodSeconds) * time.Second)
+	}
+	return at
+}
+
+func (h *healingTracker) podDeleted(p *corev1.Pod) {
+	// the owner cache may have forgotten the pod already
+	e, resolved := h.owners.resolve(p)
+	if !resolved || !e.owned {
+		return
+	}
+	d, err := h.deploymentLister.Deployments(e.deploy.namespace).Get(e.deploy.name)
+	// pods deleted by a scale-down or a rollout aren't replaced
+	if err != nil || !rolloutComplete(d) {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	if _, exists := h.seen[p.UID]; exists {
+		return
+	}
+	h.seen[p.UID] = struct{}{}
+	deletion := h.expected[p.UID]
+	delete(h.expected, p.UID)
+	deletion.at = deletedAt(p)
+	deletion.hash = p.Labels[podTemplateHashLabel]
+	h.deletions[e.deploy] = append(h.deletions[e.deploy], deletion)
+	logrus.Debugf("pod %s(%s) of deployment %s is deleted", p.Name, p.Namespace, e.deploy.name)
+}
+
+// expect tags the deletion of the pod with the experiment deleting it.
+func (h *healingTracker) expect(uid types.UID, experiment string, tags map[string]string) {
+	h.Lock()
+	defer h.Unlock()
+	h.expected[uid] = podDeletion{experiment: experiment, tags: tags}
+}
+
+func (h *healingTracker) unexpect(uid types.UID) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.expected, uid)
+}
+
+// podReadyTime returns when the pod became ready.
+func podReadyTime(p *corev1.Pod) (time.Time, bool) {
+	for _, c := range p.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.LastTransitionTime.Time, c.Status == corev1.ConditionTrue
+		}
+	}
+	return time.Time{}, false
+}
+
+// track measures the self-healing latency of the deployment once it has as
+// many ready pods as its replicas and the deleted pods have been replaced,
+// the latency is from the first deletion to the last replacement being
+// ready.
+func (h *healingTracker) track(c *cluster, d *appsv1.Deployment, pods []*corev1.Pod) {
+	m := meta{name: d.Name, namespace: d.Namespace}
+	h.Lock()
+	defer h.Unlock()
+	deletions := h.deletions[m]
+	if len(deletions) == 0 {
+		return
+	}
+	since := deletions[0].at
+	if clk.Since(since) > healingTimeout {
+		logrus.Warnf("deployment %s(%s) didn't replace its deleted pods in %v", d.Name, d.Namespace, healingTimeout)
+		for _, deletion := range deletions {
+			if deletion.experiment != "" {
+				experiments.fail(deletion.experiment, fmt.Sprintf("the deleted pods weren't replaced in %v", healingTimeout))
+			}
+		}
+		delete(h.deletions, m)
+		return
+	}
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	var (
+		ready, replaced int32
+		end             time.Time
+	)
+	for _, p := range pods {
+		if p.DeletionTimestamp != nil {
+			continue
+		}
+		readyAt, isReady := podReadyTime(p)
+		if !isReady {
+			continue
+		}
+		ready++
+		// timestamps of pods are in seconds
+		if p.Labels[podTemplateHashLabel] == deletions[0].hash && !p.CreationTimestamp.Time.Before(since.Truncate(time.Second)) {
+			replaced++
+			if readyAt.After(end) {
+				end = readyAt
+			}
+		}
+	}
+	if ready < replicas || int(replaced) < len(deletions) {
+		return
+	}
+	delete(h.deletions, m)
+	latency := float64(end.Sub(since).Milliseconds())
+	if latency < 0 {
+		latency = 0
+	}
+	h.latency[m] = latency
+	ms := measurement{
+		Kind:       measurementKindSelfHealing,
+		Cluster:    c.name,
+		Namespace:  d.Namespace,
+		Deployment: d.Name,
+		Replicas:   replicas,
+		Pods:       len(deletions),
+		LatencyMs:  latency,
+		Time:       clk.Now(),
+	}
+	for _, deletion := range deletions {
+		for k, v := range deletion.tags {
+			if ms.Tags == nil {
+				ms.Tags = map[string]string{}
+			}
+			ms.Tags[k] = v
+		}
+	}
+	sessions.addMeasurement(ms)
+	stream.publish(streamEventMeasurement, ms)
+	for _, deletion := range deletions {
+		if deletion.experiment != "" {
+			experiments.complete(deletion.experiment, ms)
+		}
+	}
+	logrus.Debugf("deployment %s(%s) replaced %d deleted pods in %vms", d.Name, d.Namespace, len(deletions), latency)
+}
+
+// export sets the last self-healing latency of the deployments.
+func (h *healingTracker) export(c *cluster) {
+	h.Lock()
+	defer h.Unlock()
+	for m, latency := range h.latency {
+		deploySelfHealingLatency.WithLabelValues(m.name, m.namespace, c.name).Set(latency)
+	}
+}
+
+// prune forgets the deployments which don't exist anymore.
+func (h *healingTracker) prune(c *cluster, existing map[deployKey]struct{}) {
+	h.Lock()
+	defer h.Unlock()
+	for m := range h.latency {
+		if _, exists := existing[deployKey{cluster: c.name, meta: m}]; !exists {
+			delete(h.latency, m)
+		}
+	}
+	for m := range h.deletions {
+		if _, exists := existing[deployKey{cluster: c.name, meta: m}]; !exists {
+			delete(h.deletions, m)
+		}
+	}
+}
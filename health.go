@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	// readyTimeout bounds how long the API server of a cluster may take to
+	// answer a readiness check
+	readyTimeout = 5 * time.Second
+
+	// readyAny makes the exporter ready with any of its clusters reachable
+	// and synced, so one unreachable cluster doesn't stop the others from
+	// being scraped
+	readyAny = "any"
+	// readyAll makes the exporter ready with all of its clusters reachable
+	// and synced
+	readyAll = "all"
+)
+
+type readyCheck struct {
+	Cluster string `json:"cluster"`
+	// Connected is whether the API server of the cluster answered
+	Connected bool `json:"connected"`
+	// Synced is whether the informers of the cluster have synced their
+	// caches
+	Synced bool   `json:"synced"`
+	Error  string `json:"error,omitempty"`
+}
+
+type readyStatus struct {
+	Ready  bool         `json:"ready"`
+	Checks []readyCheck `json:"checks"`
+}
+
+// healthChecker tells the readiness of the exporter by the clusters it
+// watches, it's ready once it reaches any or all of them by the policy and
+// their caches are synced. There's nothing to wait for in the offline and
+// standalone modes.
+type healthChecker struct {
+	clusters []*cluster
+	policy   string
+}
+
+var health = healthChecker{policy: readyAny}
+
+// check checks a cluster, the informers which haven't been started yet
+// aren't synced.
+func (c *cluster) check(ctx context.Context) readyCheck {
+	check := readyCheck{Cluster: c.name}
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	if _, err := c.client.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Raw(); err != nil {
+		check.Error = err.Error()
+	} else {
+		check.Connected = true
+	}
+	// a closed channel makes waiting for the caches return at once
+	stop := make(chan struct{})
+	close(stop)
+	synced := c.factory.WaitForCacheSync(stop)
+	check.Synced = len(synced) > 0
+	for _, ok := range synced {
+		check.Synced = check.Synced && ok
+	}
+	for _, ok := range c.dynamicFactory.WaitForCacheSync(stop) {
+		check.Synced = check.Synced && ok
+	}
+	return check
+}
+
+func (h *healthChecker) status(ctx context.Context) readyStatus {
+	status := readyStatus{Checks: []readyCheck{}}
+	for _, c := range h.clusters {
+		status.Checks = append(status.Checks, c.check(ctx))
+	}
+	status.Ready = h.ready(status.Checks)
+	return status
+}
+
+// ready tells the readiness by the checks of the clusters and the policy.
+func (h *healthChecker) ready(checks []readyCheck) bool {
+	ready := 0
+	for _, check := range checks {
+		if check.Connected && check.Synced {
+			ready++
+		}
+	}
+	if h.policy == readyAll {
+		return ready == len(checks)
+	}
+	return ready > 0 || len(checks) == 0
+}
+
+// handleHealthz answers GET on /healthz for as long as the exporter serves
+// HTTP, it's meant for the liveness probe.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports the readiness of the exporter with GET on /readyz, it
+// answers 503 until the clusters the policy needs are reachable and synced,
+// it's meant for the readiness probe.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	status := health.status(r.Context())
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestReadyByPolicy(t *testing.T) {
+	checks := []readyCheck{
+		{Cluster: "a", Connected: true, Synced: true},
+		{Cluster: "b", Error: "connection refused"},
+	}
+	if h := (healthChecker{policy: readyAny}); !h.ready(checks) {
+		t.Error("an unreachable cluster makes the exporter unready with any")
+	}
+	if h := (healthChecker{policy: readyAll}); h.ready(checks) {
+		t.Error("an unreachable cluster keeps the exporter ready with all")
+	}
+	if h := (healthChecker{policy: readyAny}); h.ready(checks[1:]) {
+		t.Error("the exporter is ready without any reachable cluster")
+	}
+	if h := (healthChecker{policy: readyAny}); !h.ready(nil) {
+		t.Error("the exporter without clusters isn't ready")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	defaultHeatmapStep  = time.Minute
+	defaultHeatmapRange = time.Hour
+	// maxHeatmapSteps bounds the size of a heatmap
+	maxHeatmapSteps = 10000
+)
+
+// heatmap counts the containers started in every step of the range by their
+// startup latency, a count per bucket and one for the latencies over the
+// last bucket.
+type heatmap struct {
+	Start      time.Time          `json:"start"`
+	Step       string             `json:"step"`
+	Buckets    []float64          `json:"buckets"`
+	Times      []time.Time        `json:"times"`
+	Namespaces []namespaceHeatmap `json:"namespaces"`
+}
+
+type namespaceHeatmap struct {
+	Namespace string `json:"namespace"`
+	// Counts holds the counts of the buckets of every step
+	Counts [][]int `json:"counts"`
+}
+
+// handleHeatmap serves the heatmap of the retained records per namespace of
+// their pods with GET on /api/v1/heatmap. The step and range parameters are
+// durations, the buckets parameter overrides the buckets of the latency
+// histogram and the namespace parameter chooses a namespace.
+func handleHeatmap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	query := r.URL.Query()
+	step, span := defaultHeatmapStep, defaultHeatmapRange
+	var err error
+	if s := query.Get("step"); s != "" {
+		if step, err = time.ParseDuration(s); err != nil || step <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid step")
+			return
+		}
+	}
+	if s := query.Get("range"); s != "" {
+		if span, err = time.ParseDuration(s); err != nil || span <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid range")
+			return
+		}
+	}
+	steps := int((span + step - 1) / step)
+	if steps > maxHeatmapSteps {
+		writeError(w, http.StatusBadRequest, "too many steps")
+		return
+	}
+	buckets := latencyBuckets
+	if s := query.Get("buckets"); s != "" {
+		if buckets, err = parseBuckets(s); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	end := clk.Now().Truncate(step).Add(step)
+	h := heatmap{
+		Start:   end.Add(-time.Duration(steps) * step),
+		Step:    step.String(),
+		Buckets: buckets,
+	}
+	for i := 0; i < steps; i++ {
+		h.Times = append(h.Times, h.Start.Add(time.Duration(i)*step))
+	}
+	namespace := query.Get("namespace")
+	counts := map[string][][]int{}
+	mu.Lock()
+	allInfo.each(func(_ meta, record startupRecord) {
+		if namespace != "" && record.PodNamespace != namespace {
+			return
+		}
+		started := time.Unix(0, record.End)
+		if started.Before(h.Start) || !started.Before(end) {
+			return
+		}
+		c, exists := counts[record.PodNamespace]
+		if !exists {
+			c = make([][]int, steps)
+			for i := range c {
+				c[i] = make([]int, len(buckets)+1)
+			}
+			counts[record.PodNamespace] = c
+		}
+		i := int(started.Sub(h.Start) / step)
+		c[i][sort.SearchFloat64s(buckets, record.milliseconds())]++
+	})
+	mu.Unlock()
+	for ns, c := range counts {
+		h.Namespaces = append(h.Namespaces, namespaceHeatmap{Namespace: ns, Counts: c})
+	}
+	sort.Slice(h.Namespaces, func(i, j int) bool {
+		return h.Namespaces[i].Namespace < h.Namespaces[j].Namespace
+	})
+	writeJSON(w, http.StatusOK, h)
+}
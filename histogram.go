@@ -0,0 +1,246 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// defaultLatencyBuckets range from 50ms to about 100s
+	defaultLatencyBuckets = prometheus.ExponentialBuckets(50, 2, 12)
+	// latencyBuckets are the buckets of the histogram
+	latencyBuckets = defaultLatencyBuckets
+
+	deployContainerStartupLatency *prometheus.HistogramVec
+	// typeStartupLatency observes every container by the type of its start
+	typeStartupLatency *prometheus.HistogramVec
+	// attemptStartupLatency observes every start attempt of containers
+	attemptStartupLatency *prometheus.HistogramVec
+	// deployContainerStartupQuantiles is observed with the histogram, so the
+	// quantiles can be read without recording rules
+	deployContainerStartupQuantiles *prometheus.SummaryVec
+	// observedContainers holds the containers whose startup latency has been
+	// observed by the histogram, so a container is observed once however
+	// many times its deployment is updated. It's guarded by mu.
+	observedContainers = map[meta]struct{}{}
+	histogramDeploys   = histogramDeploySet{deploys: map[deployKey]struct{}{}}
+)
+
+// histogramDeploySet holds the deployments with histogram series, so the
+// series of deleted deployments can be removed.
+type histogramDeploySet struct {
+	sync.Mutex
+	deploys map[deployKey]struct{}
+}
+
+// parseBuckets parses comma separated bucket boundaries in milliseconds, they
+// must be positive and strictly increasing as a histogram panics on equal
+// boundaries.
+func parseBuckets(s string) ([]float64, error) {
+	if s == "" {
+		return defaultLatencyBuckets, nil
+	}
+	var buckets []float64
+	for _, f := range strings.Split(s, ",") {
+		b, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid bucket %q", f)
+		}
+		if b <= 0 || math.IsInf(b, 0) || math.IsNaN(b) {
+			return nil, errors.Errorf("bucket %q must be positive", f)
+		}
+		if n := len(buckets); n > 0 && b <= buckets[n-1] {
+			return nil, errors.New("buckets must be in strictly increasing order")
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+// registerLatencyHistogram registers the histograms of the startup latency of
+// containers with the buckets.
+func registerLatencyHistogram(buckets []float64) error {
+	latencyBuckets = buckets
+	typeStartupLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemPod,
+			Name:      "type_startup_latency_milliseconds",
+			Buckets:   buckets,
+		},
+		[]string{
+			"type",
+		},
+	)
+	if err := prometheus.Register(typeStartupLatency); err != nil {
+		return err
+	}
+	attemptStartupLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemPod,
+			Name:      "attempt_startup_latency_milliseconds",
+			Buckets:   buckets,
+		},
+		[]string{
+			"type",
+			"namespace",
+			"attempt",
+		},
+	)
+	if err := prometheus.Register(attemptStartupLatency); err != nil {
+		return err
+	}
+	deployContainerStartupLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "container_startup_latency_milliseconds",
+			Buckets:   buckets,
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+		},
+	)
+	if err := prometheus.Register(deployContainerStartupLatency); err != nil {
+		return err
+	}
+	deployScaleLatencyByStep = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "scale_latency_by_step_milliseconds",
+			Buckets:   buckets,
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+			"step",
+		},
+	)
+	if err := prometheus.Register(deployScaleLatencyByStep); err != nil {
+		return err
+	}
+	strategyScaleLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "strategy_scale_latency_milliseconds",
+			Buckets:   buckets,
+		},
+		strategyLabels,
+	)
+	if err := prometheus.Register(strategyScaleLatency); err != nil {
+		return err
+	}
+	strategyRolloutDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "strategy_rollout_duration_milliseconds",
+			Buckets:   buckets,
+		},
+		strategyLabels,
+	)
+	return prometheus.Register(strategyRolloutDuration)
+}
+
+const (
+	// defaultQuantiles are the quantiles of the summary of the startup
+	// latency.
+	defaultQuantiles = "0.5,0.9,0.99"
+	// defaultQuantilesMaxAge is the window of the summary, each container
+	// is observed once, so a window of the default 10 minutes of summaries
+	// turns the quantiles NaN soon after a scale event
+	defaultQuantilesMaxAge     = time.Hour
+	defaultQuantilesAgeBuckets = 6
+)
+
+// parseQuantiles parses comma separated quantiles into the objectives of a
+// summary, the allowed error of a quantile is a tenth of its distance to 1.
+func parseQuantiles(s string) (map[float64]float64, error) {
+	objectives := map[float64]float64{}
+	for _, f := range strings.Split(s, ",") {
+		if strings.TrimSpace(f) == "" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || q <= 0 || q >= 1 {
+			return nil, errors.Errorf("invalid quantile %q", f)
+		}
+		objectives[q] = (1 - q) / 10
+	}
+	return objectives, nil
+}
+
+// registerLatencySummary registers the summary of the startup latency of the
+// containers of deployments with the objectives over the window of maxAge
+// rotated in ageBuckets, no summary is registered without objectives.
+func registerLatencySummary(objectives map[float64]float64, maxAge time.Duration, ageBuckets int) error {
+	if len(objectives) == 0 {
+		return nil
+	}
+	if maxAge <= 0 || ageBuckets <= 0 {
+		return errors.New("the window of the summary and its buckets must be positive")
+	}
+	deployContainerStartupQuantiles = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace:  metricsNamespace,
+			Subsystem:  metricsSubsystemDeploy,
+			Name:       "container_startup_latency_quantiles_milliseconds",
+			Objectives: objectives,
+			MaxAge:     maxAge,
+			AgeBuckets: uint32(ageBuckets),
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+		},
+	)
+	return prometheus.Register(deployContainerStartupQuantiles)
+}
+
+// observeContainer adds the startup latency of a container of the deployment
+// to the histogram and the summary if it hasn't been, it's called with mu
+// locked.
+func observeContainer(k deployKey, m meta, r startupRecord) {
+	if deployContainerStartupLatency == nil {
+		return
+	}
+	if _, observed := observedContainers[m]; observed {
+		return
+	}
+	observedContainers[m] = struct{}{}
+	deployContainerStartupLatency.WithLabelValues(k.name, k.namespace, k.cluster).Observe(r.milliseconds())
+	if deployContainerStartupQuantiles != nil {
+		deployContainerStartupQuantiles.WithLabelValues(k.name, k.namespace, k.cluster).Observe(r.milliseconds())
+	}
+	histogramDeploys.Lock()
+	histogramDeploys.deploys[k] = struct{}{}
+	histogramDeploys.Unlock()
+}
+
+// prune removes the series of the deployments which don't exist anymore.
+func (s *histogramDeploySet) prune(existing map[deployKey]struct{}) {
+	s.Lock()
+	defer s.Unlock()
+	for k := range s.deploys {
+		if _, exists := existing[k]; !exists {
+			deployContainerStartupLatency.DeleteLabelValues(k.name, k.namespace, k.cluster)
+			if deployContainerStartupQuantiles != nil {
+				deployContainerStartupQuantiles.DeleteLabelValues(k.name, k.namespace, k.cluster)
+			}
+			delete(s.deploys, k)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBuckets(t *testing.T) {
+	for _, s := range []string{"100,100", "200,100", "0,100", "-1,100", "100,x", "100,+Inf"} {
+		if _, err := parseBuckets(s); err == nil {
+			t.Errorf("parsed invalid buckets %q", s)
+		}
+	}
+	buckets, err := parseBuckets("50, 100,200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 3 || buckets[0] != 50 || buckets[2] != 200 {
+		t.Errorf("parsed %v", buckets)
+	}
+}
+
+func TestLatencySummaryNeedsWindow(t *testing.T) {
+	objectives := map[float64]float64{0.5: 0.05}
+	if err := registerLatencySummary(objectives, 0, defaultQuantilesAgeBuckets); err == nil {
+		t.Error("registered a summary without a window")
+	}
+	if err := registerLatencySummary(objectives, time.Hour, 0); err == nil {
+		t.Error("registered a summary without age buckets")
+	}
+}
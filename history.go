@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultHistoryRetention = 7 * 24 * time.Hour
+	defaultHistoryStep      = time.Hour
+	defaultHistoryRange     = 24 * time.Hour
+	// maxHistorySteps bounds the size of a history query
+	maxHistorySteps = 10000
+
+	historyMetricStartup = "startup"
+	historyMetricScale   = "scale"
+)
+
+// historyStore keeps the published measurements of deployments over the
+// retention, so trends can be queried without exporting raw dumps. The
+// measurement log is its database, it's loaded back when the exporter starts.
+type historyStore struct {
+	sync.Mutex
+	retention time.Duration
+	lines     []measurementLogLine
+}
+
+var history = historyStore{
+	retention: defaultHistoryRetention,
+}
+
+// add records a measurement and drops the ones out of the retention.
+func (h *historyStore) add(line measurementLogLine) {
+	h.Lock()
+	defer h.Unlock()
+	h.lines = append(h.lines, line)
+	h.expire()
+}
+
+func (h *historyStore) expire() {
+	i := 0
+	now := clk.Now()
+	for i < len(h.lines) && now.Sub(h.lines[i].Time) > h.retention {
+		i++
+	}
+	h.lines = h.lines[i:]
+}
+
+// load reads the measurements within the retention from a measurement log, a
+// missing log is an empty one.
+func (h *historyStore) load(path string) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	h.Lock()
+	defer h.Unlock()
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line measurementLogLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue
+		}
+		switch line.Schema {
+		case measurementLogSchema:
+		case measurementLogSchemaV1:
+			// the scale latency of v1 lines is repeated, only the
+			// startup measurement is kept
+			line.ScaleLatencyMs = nil
+		default:
+			continue
+		}
+		h.lines = append(h.lines, line)
+		n++
+	}
+	sort.SliceStable(h.lines, func(i, j int) bool {
+		return h.lines[i].Time.Before(h.lines[j].Time)
+	})
+	h.expire()
+	return n, scanner.Err()
+}
+
+func (h *historyStore) reset() {
+	h.Lock()
+	defer h.Unlock()
+	h.lines = nil
+}
+
+// parseHistoryDuration parses a duration which may be in days, e.g. 7d.
+func parseHistoryDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, errors.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// aggregate applies the aggregation function to the values, which are
+// sorted by it.
+func aggregate(agg string, values []float64) (float64, bool) {
+	sort.Float64s(values)
+	switch agg {
+	case "avg":
+		var total float64
+		for _, v := range values {
+			total += v
+		}
+		return total / float64(len(values)), true
+	case "min":
+		return values[0], true
+	case "max":
+		return values[len(values)-1], true
+	case "count":
+		return float64(len(values)), true
+	}
+	if !strings.HasPrefix(agg, "p") {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(strings.TrimPrefix(agg, "p"), 64)
+	if err != nil || p <= 0 || p > 100 {
+		return 0, false
+	}
+	return values[int(math.Ceil(p/100*float64(len(values))))-1], true
+}
+
+type historyPoint struct {
+	Time    time.Time `json:"time"`
+	Value   float64   `json:"value"`
+	Samples int       `json:"samples"`
+}
+
+type historyResult struct {
+	Deployment string         `json:"deployment"`
+	Namespace  string         `json:"namespace,omitempty"`
+	Cluster    string         `json:"cluster,omitempty"`
+	Metric     string         `json:"metric"`
+	Agg        string         `json:"agg"`
+	Start      time.Time      `json:"start"`
+	Step       string         `json:"step"`
+	Points     []historyPoint `json:"points"`
+}
+
+// handleHistory aggregates the measurements of a deployment in every step of
+// the range with GET on /api/v1/history. The metric parameter is startup or
+// scale, the agg parameter is avg, min, max, count or a percentile like p95,
+// steps without measurements are left out.
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	query := r.URL.Query()
+	result := historyResult{
+		Deployment: query.Get("deployment"),
+		Namespace:  query.Get("namespace"),
+		Cluster:    query.Get("cluster"),
+		Metric:     query.Get("metric"),
+		Agg:        query.Get("agg"),
+	}
+	if result.Deployment == "" {
+		writeError(w, http.StatusBadRequest, "deployment must be provided")
+		return
+	}
+	if result.Metric == "" {
+		result.Metric = historyMetricStartup
+	}
+	if result.Metric != historyMetricStartup && result.Metric != historyMetricScale {
+		writeError(w, http.StatusBadRequest, "invalid metric")
+		return
+	}
+	if result.Agg == "" {
+		result.Agg = "avg"
+	}
+	if _, ok := aggregate(result.Agg, []float64{0}); !ok {
+		writeError(w, http.StatusBadRequest, "invalid agg")
+		return
+	}
+	step, span := defaultHistoryStep, defaultHistoryRange
+	var err error
+	if s := query.Get("step"); s != "" {
+		if step, err = parseHistoryDuration(s); err != nil || step <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid step")
+			return
+		}
+	}
+	if s := query.Get("range"); s != "" {
+		if span, err = parseHistoryDuration(s); err != nil || span <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid range")
+			return
+		}
+	}
+	steps := int((span + step - 1) / step)
+	if steps > maxHistorySteps {
+		writeError(w, http.StatusBadRequest, "too many steps")
+		return
+	}
+	end := clk.Now().Truncate(step).Add(step)
+	result.Start = end.Add(-time.Duration(steps) * step)
+	result.Step = step.String()
+	values := make([][]float64, steps)
+	history.Lock()
+	history.expire()
+	for _, line := range history.lines {
+		if line.Name != result.Deployment ||
+			result.Namespace != "" && line.Namespace != result.Namespace ||
+			result.Cluster != "" && line.Cluster != result.Cluster ||
+			line.Time.Before(result.Start) || !line.Time.Before(end) {
+			continue
+		}
+		v := line.AvgMs
+		if (result.Metric == historyMetricScale) != (line.ScaleLatencyMs != nil) {
+			continue
+		}
+		if line.ScaleLatencyMs != nil {
+			v = *line.ScaleLatencyMs
+		}
+		i := int(line.Time.Sub(result.Start) / step)
+		values[i] = append(values[i], v)
+	}
+	history.Unlock()
+	result.Points = []historyPoint{}
+	for i, vs := range values {
+		if len(vs) == 0 {
+			continue
+		}
+		v, _ := aggregate(result.Agg, vs)
+		result.Points = append(result.Points, historyPoint{
+			Time:    result.Start.Add(time.Duration(i) * step),
+			Value:   v,
+			Samples: len(vs),
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func queryHistory(t *testing.T, query string) historyResult {
+	w := httptest.NewRecorder()
+	handleHistory(w, httptest.NewRequest(http.MethodGet, "/api/v1/history?"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var result historyResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestHistoryCountsScaleEventsOnce(t *testing.T) {
+	c := fakeClock(t)
+	history.reset()
+	defer history.reset()
+	defer func(last map[deployKey]measurementLogLine) { measurements.last = last }(measurements.last)
+	measurements.last = map[deployKey]measurementLogLine{}
+	k := deployKey{meta: meta{name: "web", namespace: "default"}}
+
+	measurements.log(k, 1, 100)
+	measurements.logScale(k, 2000)
+	measurements.log(k, 2, 150)
+	measurements.log(k, 3, 120)
+	if points := queryHistory(t, "deployment=web&metric=scale&agg=count").Points; len(points) != 1 || points[0].Value != 1 {
+		t.Errorf("got %+v, want the scale event once", points)
+	}
+	if points := queryHistory(t, "deployment=web&agg=count").Points; len(points) != 1 || points[0].Value != 3 {
+		t.Errorf("got %+v, want the 3 startup measurements", points)
+	}
+
+	// nothing is added while the exporter is idle
+	c.Advance(history.retention + time.Hour)
+	queryHistory(t, "deployment=web")
+	if len(history.lines) != 0 {
+		t.Errorf("kept %d lines out of the retention", len(history.lines))
+	}
+}
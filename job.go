@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var jobStartupLatency = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystemJob,
+		Name:      "startup_latency_milliseconds",
+	},
+	[]string{
+		"job_name",
+		"namespace",
+		"cluster",
+		"cronjob",
+	},
+)
+
+// updateJobs measures the jobs of the clusters.
+func updateJobs(clusters []*cluster) {
+	for _, c := range clusters {
+		jobs, err := c.jobLister.List(labels.Everything())
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to list jobs in the cluster %s", c.name)
+			continue
+		}
+		for _, j := range jobs {
+			if j != nil {
+				c.updateJob(j)
+			}
+		}
+	}
+}
+
+// updateJob sets the time from the job being created to the containers of
+// its first pods all starting. The first pods are the ones the job starts in
+// parallel, pods created later to complete the job or to retry failed ones
+// are left out, so a job running its pods one after another is measured by
+// its first pod.
+func (c *cluster) updateJob(j *batchv1.Job) {
+	if j.Spec.Selector == nil {
+		return
+	}
+	pods, err := c.podLister.Pods(j.Namespace).List(makeSelector(*j.Spec.Selector))
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to list pods belongs to %s", j.Name)
+		return
+	}
+	pods = controlledPods(j, pods)
+	first := int32(1)
+	if j.Spec.Parallelism != nil {
+		first = *j.Spec.Parallelism
+	}
+	if j.Spec.Completions != nil && *j.Spec.Completions < first {
+		first = *j.Spec.Completions
+	}
+	if first <= 0 || int32(len(pods)) < first {
+		return
+	}
+	sort.Slice(pods, func(i, k int) bool {
+		return pods[i].CreationTimestamp.Before(&pods[k].CreationTimestamp)
+	})
+	var end int64
+	for _, p := range pods[:first] {
+		records, ok := podStartupRecords(p)
+		if !ok {
+			return
+		}
+		for _, r := range records {
+			if r.End > end {
+				end = r.End
+			}
+		}
+	}
+	cronJob := ""
+	if ref := metav1.GetControllerOf(j); ref != nil && ref.Kind == "CronJob" {
+		cronJob = ref.Name
+	}
+	latency := float64(end-j.CreationTimestamp.UnixNano()) / 1e6
+	jobStartupLatency.WithLabelValues(j.Name, j.Namespace, c.name, cronJob).Set(latency)
+	logrus.Debugf("job %s(%s) started in %vms", j.Name, j.Namespace, latency)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ksmNone is the value kube-state-metrics uses for missing owners.
+const ksmNone = "<none>"
+
+// deployLabels is an info series of every deployment, it carries the labels
+// kube-state-metrics identifies a deployment with, so the deployment metrics
+// can be joined with kube-state-metrics series on them, e.g.
+//
+//	startup_exporter_pod_average_startup_latency_milliseconds
+//	  * on(deploy_name, namespace) group_left(deployment, uid)
+//	startup_exporter_deployment_labels
+var deployLabels = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystemDeploy,
+		Name:      "labels",
+	},
+	[]string{
+		"deploy_name",
+		"namespace",
+		"cluster",
+		"deployment",
+		"uid",
+		"owner_kind",
+		"owner_name",
+	},
+)
+
+// exportDeployLabels sets the info series of the deployment.
+func exportDeployLabels(c *cluster, d *appsv1.Deployment) {
+	ownerKind, ownerName := ksmNone, ksmNone
+	if owner := metav1.GetControllerOf(d); owner != nil {
+		ownerKind, ownerName = owner.Kind, owner.Name
+	}
+	deployLabels.WithLabelValues(d.Name, d.Namespace, c.name, d.Name, string(d.UID), ownerKind, ownerName).Set(1)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// scanLimits bounds the resources the collector uses when it scans the task
+// root, so it fits in the resource limits of a DaemonSet on nodes with lots
+// of container dirs.
+type scanLimits struct {
+	// rate is the max number of bundles scanned per second, 0 means no limit
+	rate int
+	// memory is the max heap size in bytes before a scan is skipped, 0 means
+	// no limit
+	memory uint64
+	last   time.Time
+}
+
+var limits scanLimits
+
+// throttle blocks until the next bundle is allowed to be scanned.
+func (l *scanLimits) throttle() {
+	if l.rate <= 0 {
+		return
+	}
+	interval := time.Second / time.Duration(l.rate)
+	if wait := l.last.Add(interval).Sub(clk.Now()); wait > 0 {
+		clk.Sleep(wait)
+	}
+	l.last = clk.Now()
+}
+
+// overMemory reports whether the heap exceeds the memory limit after
+// returning as much memory as possible to the OS.
+func (l *scanLimits) overMemory() bool {
+	if l.memory == 0 {
+		return false
+	}
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc <= l.memory {
+		return false
+	}
+	debug.FreeOSMemory()
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc <= l.memory {
+		return false
+	}
+	logrus.Warnf("heap size %d exceeds the memory limit %d", stats.HeapAlloc, l.memory)
+	return true
+}
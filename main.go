@@ -15,17 +15,49 @@ func main() {
 	app := cli.NewApp()
 	app.Name = "startup-exporter"
 	app.Usage = "A tool to collect and export container startup time"
+	app.Version = version + "-" + commit
 	app.Commands = []cli.Command{
 		collectCmd,
 		exportCmd,
+		manifestCmd,
+		soakCmd,
 	}
 	app.Flags = []cli.Flag{
 		cli.BoolFlag{
 			Name:  "debug",
 			Usage: "enable debug output",
 		},
+		cli.IntFlag{
+			Name:  "name-length",
+			Usage: "the length which container IDs are truncated to in logs",
+			Value: defaultContainerNameLength,
+		},
+		cli.BoolFlag{
+			Name:  "full-id",
+			Usage: "log full container IDs instead of truncating them",
+		},
 	}
 	if err := app.Run(os.Args); err != nil {
 		logrus.Fatal(err)
 	}
 }
+
+const defaultContainerNameLength = 10
+
+// containerNameLength is the length of container IDs in logs, a non-positive
+// value disables the truncation.
+var containerNameLength = defaultContainerNameLength
+
+func setContainerNameLength(context *cli.Context) {
+	containerNameLength = context.GlobalInt("name-length")
+	if context.GlobalBool("full-id") {
+		containerNameLength = 0
+	}
+}
+
+func containerShortName(name string) string {
+	if containerNameLength > 0 && len(name) > containerNameLength {
+		return name[:containerNameLength]
+	}
+	return name
+}
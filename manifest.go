@@ -0,0 +1,533 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+const defaultImage = "ylonely/startup-exporter:latest"
+
+var manifestCmd = cli.Command{
+	Name:  "manifest",
+	Usage: "print the Kubernetes manifests to deploy the exporter and the collectors",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "namespace,n",
+			Usage: "namespace to deploy to",
+			Value: "kube-system",
+		},
+		cli.StringFlag{
+			Name:  "image",
+			Usage: "image of startup-exporter",
+			Value: defaultImage,
+		},
+		cli.IntFlag{
+			Name:  "port",
+			Usage: "port the exporter listens on",
+			Value: 9090,
+		},
+		cli.BoolFlag{
+			Name:  "host-network",
+			Usage: "run the exporter and the collectors in the host network namespace",
+		},
+		cli.BoolFlag{
+			Name:  "openshift",
+			Usage: "let the exporter measure the deployment configs of OpenShift",
+		},
+		cli.BoolFlag{
+			Name:  "argo-rollouts",
+			Usage: "let the exporter measure the rollouts of Argo Rollouts",
+		},
+		cli.BoolFlag{
+			Name:  "pull",
+			Usage: "make the exporter pull from the collectors, which are discovered through a headless service, instead of the collectors pushing",
+		},
+		cli.BoolFlag{
+			Name:  "custom-metrics",
+			Usage: "register the exporter as the custom metrics API so horizontal pod autoscalers can use the startup latency, it replaces the APIService v1beta1.custom.metrics.k8s.io of any other adapter like prometheus-adapter",
+		},
+		cli.BoolFlag{
+			Name:  "reports",
+			Usage: "let the exporter keep a DeploymentStartupReport per measured deployment",
+		},
+		cli.BoolFlag{
+			Name:  "node-local",
+			Usage: "make the collectors push to the exporter port on their own node, resolved from the downward API",
+		},
+		cli.StringFlag{
+			Name:  "profile",
+			Usage: "\"dev\" detects the kind or minikube cluster of the kubeconfig and renders manifests for it, with debug logs and an image loaded into the nodes",
+		},
+		cli.StringFlag{
+			Name:  "kubeconfig,c",
+			Usage: "path to the kubeconfig of the cluster detected by the dev profile",
+		},
+		cli.StringFlag{
+			Name:  "context",
+			Usage: "kubeconfig context of the cluster detected by the dev profile",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		t, err := template.New("manifest").Parse(manifestTemplate)
+		if err != nil {
+			return err
+		}
+		var (
+			image      = context.String("image")
+			taskRoot   = defaultContainerdRoot
+			pullPolicy string
+			debug      bool
+		)
+		var collectorToken string
+		if context.Bool("pull") {
+			bs := make([]byte, 32)
+			if _, err := rand.Read(bs); err != nil {
+				return errors.Wrap(err, "failed to generate the token of the collectors")
+			}
+			collectorToken = hex.EncodeToString(bs)
+		}
+		var customCert, customKey []byte
+		if context.Bool("custom-metrics") {
+			host := fmt.Sprintf("startup-exporter.%s.svc", context.String("namespace"))
+			if customCert, customKey, err = servingCertificate([]string{host}, time.Now().AddDate(10, 0, 0)); err != nil {
+				return errors.Wrap(err, "failed to create the certificate of the custom metrics API")
+			}
+			fmt.Fprintln(os.Stderr, "# the APIService v1beta1.custom.metrics.k8s.io replaces the one of any other custom metrics adapter, like prometheus-adapter, check first with:\n#   kubectl get apiservice v1beta1.custom.metrics.k8s.io")
+		}
+		switch profile := context.String("profile"); profile {
+		case "":
+		case profileDev:
+			d, err := detectDevCluster(context.String("kubeconfig"), context.String("context"))
+			if err != nil {
+				return errors.Wrap(err, "failed to detect the dev cluster")
+			}
+			taskRoot = d.taskRoot
+			pullPolicy = "IfNotPresent"
+			debug = true
+			fmt.Fprintf(os.Stderr, "# %s cluster %s detected, load the image first with:\n#   %s\n", d.provider, d.name, d.loadCommand(image))
+		default:
+			return errors.Errorf("unknown profile %q", profile)
+		}
+		if err := t.Execute(os.Stdout, struct {
+			Namespace   string
+			Image       string
+			Port        int
+			HostNetwork bool
+			NodeLocal   bool
+			OpenShift   bool
+			Argo        bool
+			Pull        bool
+			Custom      bool
+			Reports     bool
+			// TaskRoot is the task root on the nodes, it's mounted at
+			// the default one in the collectors
+			TaskRoot   string
+			PullPolicy string
+			Debug      bool
+			// PullPort is the port collectors serve on when pulled
+			// from, it differs from the exporter port so both fit on a
+			// node in the host network
+			PullPort int
+			// CollectorToken is what the exporter pulls from the
+			// collectors with
+			CollectorToken string
+			// CustomCert and CustomKey are the serving certificate of
+			// the custom metrics API, base64 encoded, the certificate
+			// is also the caBundle of the APIService
+			CustomCert string
+			CustomKey  string
+		}{
+			Namespace:      context.String("namespace"),
+			Image:          image,
+			Port:           context.Int("port"),
+			HostNetwork:    context.Bool("host-network"),
+			NodeLocal:      context.Bool("node-local"),
+			OpenShift:      context.Bool("openshift"),
+			Argo:           context.Bool("argo-rollouts"),
+			Pull:           context.Bool("pull"),
+			PullPort:       context.Int("port") + 1,
+			Custom:         context.Bool("custom-metrics"),
+			Reports:        context.Bool("reports"),
+			TaskRoot:       taskRoot,
+			PullPolicy:     pullPolicy,
+			Debug:          debug,
+			CollectorToken: collectorToken,
+			CustomCert:     base64.StdEncoding.EncodeToString(customCert),
+			CustomKey:      base64.StdEncoding.EncodeToString(customKey),
+		}); err != nil {
+			return errors.Wrap(err, "failed to render the manifests")
+		}
+		return nil
+	},
+}
+
+const manifestTemplate = `
+{{- if .Reports -}}
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: deploymentstartupreports.startup-exporter.io
+spec:
+  group: startup-exporter.io
+  names:
+    kind: DeploymentStartupReport
+    listKind: DeploymentStartupReportList
+    plural: deploymentstartupreports
+    singular: deploymentstartupreport
+    shortNames: ["dsr"]
+  scope: Namespaced
+  versions:
+  - name: v1alpha1
+    served: true
+    storage: true
+    subresources:
+      status: {}
+    additionalPrinterColumns:
+    - name: Avg(ms)
+      type: number
+      jsonPath: .status.avgLatencyMs
+    - name: Scale(ms)
+      type: number
+      jsonPath: .status.scaleLatencyMs
+    - name: Updated
+      type: date
+      jsonPath: .status.updated
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          status:
+            type: object
+            x-kubernetes-preserve-unknown-fields: true
+---
+{{ end -}}
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: startup-exporter
+  namespace: {{ .Namespace }}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: startup-exporter
+rules:
+- apiGroups: [""]
+  resources: ["pods", "nodes", "events", "persistentvolumeclaims"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: ["apps"]
+  resources: ["deployments", "replicasets", "statefulsets", "daemonsets"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: ["batch"]
+  resources: ["jobs", "cronjobs"]
+  verbs: ["get", "list", "watch"]
+{{- if .OpenShift }}
+- apiGroups: ["apps.openshift.io"]
+  resources: ["deploymentconfigs"]
+  verbs: ["get", "list", "watch"]
+{{- end }}
+{{- if .Pull }}
+- apiGroups: [""]
+  resources: ["endpoints"]
+  verbs: ["get", "list", "watch"]
+{{- end }}
+{{- if .Reports }}
+- apiGroups: ["startup-exporter.io"]
+  resources: ["deploymentstartupreports"]
+  verbs: ["get", "create"]
+- apiGroups: ["startup-exporter.io"]
+  resources: ["deploymentstartupreports/status"]
+  verbs: ["update"]
+{{- end }}
+{{- if .Argo }}
+- apiGroups: ["argoproj.io"]
+  resources: ["rollouts"]
+  verbs: ["get", "list", "watch"]
+{{- end }}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: startup-exporter
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: startup-exporter
+subjects:
+- kind: ServiceAccount
+  name: startup-exporter
+  namespace: {{ .Namespace }}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: startup-exporter
+  namespace: {{ .Namespace }}
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: startup-exporter
+  template:
+    metadata:
+      labels:
+        app: startup-exporter
+    spec:
+      serviceAccountName: startup-exporter
+{{- if .HostNetwork }}
+      hostNetwork: true
+      dnsPolicy: ClusterFirstWithHostNet
+{{- end }}
+      containers:
+      - name: exporter
+        image: {{ .Image }}
+{{- if .PullPolicy }}
+        imagePullPolicy: {{ .PullPolicy }}
+{{- end }}
+{{- if .Pull }}
+        env:
+        - name: STARTUP_COLLECTOR_TOKEN
+          valueFrom:
+            secretKeyRef:
+              name: startup-collector-token
+              key: token
+{{- end }}
+        args: [{{ if .Debug }}"--debug", {{ end }}"export",{{ if .OpenShift }} "--openshift",{{ end }}{{ if .Argo }} "--argo-rollouts",{{ end }}{{ if .Pull }} "--collector-service", "{{ .Namespace }}/startup-collector",{{ end }}{{ if .Custom }} "--custom-metrics-addr", ":6443", "--custom-metrics-cert", "/etc/startup-exporter/custom-metrics/tls.crt", "--custom-metrics-key", "/etc/startup-exporter/custom-metrics/tls.key",{{ end }}{{ if .Reports }} "--reports",{{ end }} "{{ .Port }}"]
+        ports:
+        - name: http
+          containerPort: {{ .Port }}
+{{- if .HostNetwork }}
+          hostPort: {{ .Port }}
+{{- end }}
+{{- if .Custom }}
+        - name: custom-metrics
+          containerPort: 6443
+{{- end }}
+        livenessProbe:
+          httpGet:
+            path: /healthz
+            port: http
+          periodSeconds: 10
+          failureThreshold: 6
+        readinessProbe:
+          httpGet:
+            path: /readyz
+            port: http
+          periodSeconds: 10
+{{- if .Custom }}
+        volumeMounts:
+        - name: custom-metrics-tls
+          mountPath: /etc/startup-exporter/custom-metrics
+          readOnly: true
+      volumes:
+      - name: custom-metrics-tls
+        secret:
+          secretName: startup-exporter-custom-metrics-tls
+{{- end }}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: startup-exporter
+  namespace: {{ .Namespace }}
+spec:
+  selector:
+    app: startup-exporter
+  ports:
+  - name: http
+    port: {{ .Port }}
+    targetPort: http
+{{- if .Custom }}
+  - name: custom-metrics
+    port: 443
+    targetPort: custom-metrics
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: startup-exporter-custom-metrics-tls
+  namespace: {{ .Namespace }}
+type: kubernetes.io/tls
+data:
+  tls.crt: {{ .CustomCert }}
+  tls.key: {{ .CustomKey }}
+---
+# There's only one APIService per group version, this replaces the one of any
+# other custom metrics adapter, like prometheus-adapter, and breaks the
+# autoscalers using its metrics.
+apiVersion: apiregistration.k8s.io/v1
+kind: APIService
+metadata:
+  name: v1beta1.custom.metrics.k8s.io
+spec:
+  group: custom.metrics.k8s.io
+  version: v1beta1
+  service:
+    name: startup-exporter
+    namespace: {{ .Namespace }}
+    port: 443
+  caBundle: {{ .CustomCert }}
+  groupPriorityMinimum: 100
+  versionPriority: 100
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: startup-exporter-custom-metrics
+rules:
+- apiGroups: ["custom.metrics.k8s.io"]
+  resources: ["*"]
+  verbs: ["get", "list"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: startup-exporter-custom-metrics
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: startup-exporter-custom-metrics
+subjects:
+- kind: ServiceAccount
+  name: horizontal-pod-autoscaler
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: startup-exporter-auth-reader
+  namespace: kube-system
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: extension-apiserver-authentication-reader
+subjects:
+- kind: ServiceAccount
+  name: startup-exporter
+  namespace: {{ .Namespace }}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: startup-exporter-auth-delegator
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: system:auth-delegator
+subjects:
+- kind: ServiceAccount
+  name: startup-exporter
+  namespace: {{ .Namespace }}
+{{- end }}
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: startup-collector
+  namespace: {{ .Namespace }}
+spec:
+  selector:
+    matchLabels:
+      app: startup-collector
+  template:
+    metadata:
+      labels:
+        app: startup-collector
+    spec:
+{{- if .HostNetwork }}
+      hostNetwork: true
+      dnsPolicy: ClusterFirstWithHostNet
+{{- end }}
+      containers:
+      - name: collector
+        image: {{ .Image }}
+{{- if .PullPolicy }}
+        imagePullPolicy: {{ .PullPolicy }}
+{{- end }}
+{{- if .Pull }}
+        args: [{{ if .Debug }}"--debug", {{ end }}"collect", "--listen", ":{{ .PullPort }}"]
+        ports:
+        - name: http
+          containerPort: {{ .PullPort }}
+{{- else if .NodeLocal }}
+        args: [{{ if .Debug }}"--debug", {{ end }}"collect", "$(HOST_IP):{{ .Port }}"]
+{{- else }}
+        args: [{{ if .Debug }}"--debug", {{ end }}"collect", "startup-exporter.{{ .Namespace }}.svc:{{ .Port }}"]
+{{- end }}
+        env:
+        - name: NODE_NAME
+          valueFrom:
+            fieldRef:
+              fieldPath: spec.nodeName
+        - name: HOST_IP
+          valueFrom:
+            fieldRef:
+              fieldPath: status.hostIP
+        - name: POD_IP
+          valueFrom:
+            fieldRef:
+              fieldPath: status.podIP
+{{- if .Pull }}
+        - name: STARTUP_COLLECTOR_TOKEN
+          valueFrom:
+            secretKeyRef:
+              name: startup-collector-token
+              key: token
+{{- end }}
+        # the task root under the state dir set in the config of containerd
+        # is found through the same paths as on the node, the state dir is
+        # expected under /run
+        volumeMounts:
+        - name: run
+          mountPath: /run
+          readOnly: true
+          mountPropagation: HostToContainer
+        - name: tasks
+          mountPath: /run/containerd/io.containerd.runtime.v2.task
+          readOnly: true
+        - name: containerd-config
+          mountPath: /etc/containerd
+          readOnly: true
+      volumes:
+      - name: run
+        hostPath:
+          path: /run
+      - name: tasks
+        hostPath:
+          path: {{ .TaskRoot }}
+      - name: containerd-config
+        hostPath:
+          path: /etc/containerd
+{{- if .Pull }}
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: startup-collector-token
+  namespace: {{ .Namespace }}
+stringData:
+  token: {{ .CollectorToken }}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: startup-collector
+  namespace: {{ .Namespace }}
+spec:
+  clusterIP: None
+  selector:
+    app: startup-collector
+  ports:
+  - name: http
+    port: {{ .PullPort }}
+    targetPort: http
+{{- end }}
+`
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// measurementLogSchema is the version of the schema of measurement log lines,
+// it changes only if a field is removed or changes its meaning. Lines of v1
+// carried the last scale latency on every startup measurement, v2 has a line
+// of its own for every scale event.
+const (
+	measurementLogSchema   = "v2"
+	measurementLogSchemaV1 = "v1"
+)
+
+// measurementLogLine is a published measurement of a deployment, either of
+// its startup latency or, if ScaleLatencyMs is set, of a scale event.
+type measurementLogLine struct {
+	Schema         string    `json:"schema"`
+	RunID          string    `json:"run_id"`
+	Time           time.Time `json:"time"`
+	Cluster        string    `json:"cluster"`
+	Namespace      string    `json:"namespace"`
+	Name           string    `json:"name"`
+	Samples        int       `json:"samples"`
+	AvgMs          float64   `json:"avg_ms"`
+	ScaleLatencyMs *float64  `json:"scale_latency_ms,omitempty"`
+}
+
+// measurementLogger writes a JSON line for every measurement published for a
+// deployment, so results can be captured from logs without scraping.
+type measurementLogger struct {
+	sync.Mutex
+	w     io.Writer
+	runID string
+	last  map[deployKey]measurementLogLine
+}
+
+var measurements = measurementLogger{
+	last: map[deployKey]measurementLogLine{},
+}
+
+// newID returns a random ID, e.g. of this run of the exporter.
+func newID() string {
+	bs := make([]byte, 8)
+	if _, err := rand.Read(bs); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(bs)
+}
+
+// open sets where the lines are written to, "-" means stdout and an empty
+// path disables the log.
+func (l *measurementLogger) open(path, runID string) error {
+	if runID == "" {
+		runID = newID()
+	}
+	l.runID = runID
+	switch path {
+	case "":
+		return nil
+	case "-":
+		l.w = os.Stdout
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	l.w = f
+	return nil
+}
+
+// log writes the measurement of the deployment and adds it to the history if
+// it differs from the last one.
+func (l *measurementLogger) log(k deployKey, samples int, avg float64) {
+	l.Lock()
+	defer l.Unlock()
+	if l.w == nil && history.retention <= 0 {
+		return
+	}
+	line := measurementLogLine{
+		Schema:    measurementLogSchema,
+		RunID:     l.runID,
+		Cluster:   k.cluster,
+		Namespace: k.namespace,
+		Name:      k.name,
+		Samples:   samples,
+		AvgMs:     avg,
+	}
+	if last, exists := l.last[k]; exists && last.Samples == line.Samples && last.AvgMs == line.AvgMs {
+		return
+	}
+	l.last[k] = line
+	l.write(line)
+}
+
+// logScale writes a scale event of the deployment and adds it to the
+// history, once per event.
+func (l *measurementLogger) logScale(k deployKey, latency float64) {
+	l.Lock()
+	defer l.Unlock()
+	if l.w == nil && history.retention <= 0 {
+		return
+	}
+	l.write(measurementLogLine{
+		Schema:         measurementLogSchema,
+		RunID:          l.runID,
+		Cluster:        k.cluster,
+		Namespace:      k.namespace,
+		Name:           k.name,
+		ScaleLatencyMs: &latency,
+	})
+}
+
+// sync commits the lines written to the log file to the disk.
+func (l *measurementLogger) sync() error {
+	l.Lock()
+	defer l.Unlock()
+	if f, ok := l.w.(*os.File); ok && f != os.Stdout {
+		return f.Sync()
+	}
+	return nil
+}
+
+func (l *measurementLogger) write(line measurementLogLine) {
+	line.Time = clk.Now()
+	if history.retention > 0 {
+		history.add(line)
+	}
+	if l.w == nil {
+		return
+	}
+	bs, err := json.Marshal(line)
+	if err != nil {
+		logrus.WithError(err).Error("failed to encode the measurement")
+		return
+	}
+	if _, err := l.w.Write(append(bs, '\n')); err != nil {
+		logrus.WithError(err).Error("failed to write the measurement")
+	}
+}
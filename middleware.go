@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+		},
+		[]string{
+			"route",
+			"method",
+			"code",
+		},
+	)
+	httpRequestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{
+			"route",
+			"method",
+		},
+	)
+
+	// accessLog writes a JSON line per request if it's set, apart from the
+	// log level of the exporter
+	accessLog *logrus.Logger
+)
+
+func enableAccessLog() {
+	accessLog = logrus.New()
+	accessLog.SetOutput(os.Stdout)
+	accessLog.SetFormatter(&logrus.JSONFormatter{})
+}
+
+// statusRecorder records the status and the size of a response, it's still a
+// Flusher for the stream endpoint.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(bs []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(bs)
+	r.bytes += n
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// instrument counts and times the requests served by h per route, the
+// pattern the request is routed by in the mux, and writes the access log.
+func instrument(mux *http.ServeMux, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		began := clk.Now()
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		elapsed := clk.Since(began)
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpRequestDuration.WithLabelValues(route, r.Method).Observe(elapsed.Seconds())
+		if accessLog != nil {
+			accessLog.WithFields(logrus.Fields{
+				"method":      r.Method,
+				"route":       route,
+				"path":        r.URL.Path,
+				"status":      rec.status,
+				"bytes":       rec.bytes,
+				"duration_ms": float64(elapsed) / float64(time.Millisecond),
+				"remote":      r.RemoteAddr,
+				"collector":   r.Header.Get(nodeHeader),
+				"request_id":  rec.Header().Get(requestIDHeader),
+			}).Info("request")
+		}
+	})
+}
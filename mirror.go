@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMirrorSpool = 100000
+
+	// mirrorInterval is how often the spooled records are forwarded
+	mirrorInterval   = time.Second
+	mirrorBatchSize  = 500
+	mirrorMaxBackoff = 30 * time.Second
+	mirrorTimeout    = 10 * time.Second
+)
+
+var mirrorDroppedRecords = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "mirror_dropped_records_total",
+	},
+)
+
+// recordMirror forwards every accepted record to a standby exporter, so the
+// standby holds the same records if the exporter is lost. Records are
+// spooled while the standby is unreachable and retried with a backoff, the
+// oldest ones are dropped once the spool is full.
+type recordMirror struct {
+	sync.Mutex
+	url   string
+	token string
+	max   int
+	spool []startupRecord
+	// dropped counts the records dropped from the full spool
+	dropped int
+	client  *http.Client
+	backoff time.Duration
+	retry   time.Time
+}
+
+var mirror = recordMirror{
+	max:    defaultMirrorSpool,
+	client: &http.Client{Timeout: mirrorTimeout},
+}
+
+// add spools a record to be forwarded.
+func (m *recordMirror) add(r startupRecord) {
+	m.Lock()
+	defer m.Unlock()
+	if m.url == "" {
+		return
+	}
+	if len(m.spool) >= m.max {
+		m.spool = m.spool[1:]
+		m.dropped++
+		mirrorDroppedRecords.Inc()
+	}
+	m.spool = append(m.spool, r)
+}
+
+func (m *recordMirror) len() int {
+	m.Lock()
+	defer m.Unlock()
+	return len(m.spool)
+}
+
+// run forwards the spooled records until done.
+func (m *recordMirror) run(done <-chan struct{}) {
+	ticker := clk.NewTicker(mirrorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C():
+			m.forward()
+		}
+	}
+}
+
+// forward sends the spooled records in batches until the spool is empty or
+// a batch fails.
+func (m *recordMirror) forward() {
+	for {
+		m.Lock()
+		if len(m.spool) == 0 || clk.Now().Before(m.retry) {
+			m.Unlock()
+			return
+		}
+		n := len(m.spool)
+		if n > mirrorBatchSize {
+			n = mirrorBatchSize
+		}
+		batch := append([]startupRecord(nil), m.spool[:n]...)
+		dropped := m.dropped
+		m.Unlock()
+		err := m.send(batch)
+		m.Lock()
+		if err != nil {
+			if m.backoff == 0 {
+				m.backoff = mirrorInterval
+			} else if m.backoff *= 2; m.backoff > mirrorMaxBackoff {
+				m.backoff = mirrorMaxBackoff
+			}
+			m.retry = clk.Now().Add(m.backoff)
+			backoff := m.backoff
+			m.Unlock()
+			logrus.WithError(err).Warnf("failed to mirror %d records to %s, retrying in %v", len(batch), m.url, backoff)
+			return
+		}
+		m.backoff = 0
+		// the records dropped from the full spool while sending were the
+		// first ones, which are of the batch
+		sent := n - (m.dropped - dropped)
+		if sent < 0 {
+			sent = 0
+		}
+		m.spool = m.spool[sent:]
+		m.Unlock()
+	}
+}
+
+func (m *recordMirror) send(records []startupRecord) error {
+	infos := make([]wireStartupInfo, 0, len(records))
+	for _, r := range records {
+		received := r.Received
+		infos = append(infos, wireStartupInfo{
+			Name:         r.Name,
+			Namespace:    r.Namespace,
+			Start:        json.RawMessage(strconv.FormatInt(r.Start, 10)),
+			End:          json.RawMessage(strconv.FormatInt(r.End, 10)),
+			Type:         r.Type,
+			Attempt:      r.Attempt,
+			Unit:         "ns",
+			Extras:       r.Extras,
+			Pod:          r.Pod,
+			PodNamespace: r.PodNamespace,
+			Image:        r.Image,
+			Snapshot:     r.Snapshot,
+			Received:     &received,
+			Node:         r.Node,
+			RequestID:    r.RequestID,
+		})
+	}
+	body, err := json.Marshal(infos)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(m.url, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.token != "" {
+		req.Header.Set("Authorization", "Bearer "+m.token)
+	}
+	id := newID()
+	req.Header.Set(requestIDHeader, id)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "request %s failed", id)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("standby returned %d for request %s", resp.StatusCode, id)
+	}
+	logrus.WithField("request_id", id).Debugf("mirrored %d records", len(records))
+	return nil
+}
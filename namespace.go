@@ -0,0 +1,94 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var (
+	namespaceContainers = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemNamespace,
+			Name:      "containers",
+		},
+		[]string{
+			"namespace",
+			"cluster",
+		},
+	)
+	namespaceAvgStartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemNamespace,
+			Name:      "average_startup_latency_milliseconds",
+		},
+		[]string{
+			"namespace",
+			"cluster",
+		},
+	)
+	namespaceMaxStartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemNamespace,
+			Name:      "max_startup_latency_milliseconds",
+		},
+		[]string{
+			"namespace",
+			"cluster",
+		},
+	)
+)
+
+// exportNamespaceLatency sets the number, the average and the max startup
+// latency of the received containers of the pods of every namespace,
+// sidecars are left out. The containers are observed by the cluster-wide
+// aggregates along the way.
+func exportNamespaceLatency(clusters []*cluster) {
+	type aggregate struct {
+		count      int
+		total, max float64
+	}
+	namespaceContainers.Reset()
+	namespaceAvgStartupLatency.Reset()
+	namespaceMaxStartupLatency.Reset()
+	for _, c := range clusters {
+		pods, err := c.podLister.List(labels.Everything())
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to list pods in the cluster %s", c.name)
+			continue
+		}
+		namespaces := map[string]*aggregate{}
+		for _, p := range pods {
+			if p == nil {
+				continue
+			}
+			records, _ := podStartupRecords(p)
+			if len(records) == 0 {
+				continue
+			}
+			a, exists := namespaces[p.Namespace]
+			if !exists {
+				a = &aggregate{}
+				namespaces[p.Namespace] = a
+			}
+			for _, r := range records {
+				clusterWide.observe(c.name, r)
+				latency := r.milliseconds()
+				a.count++
+				a.total += latency
+				if latency > a.max {
+					a.max = latency
+				}
+			}
+		}
+		for ns, a := range namespaces {
+			namespaceContainers.WithLabelValues(ns, c.name).Set(float64(a.count))
+			namespaceAvgStartupLatency.WithLabelValues(ns, c.name).Set(a.total / float64(a.count))
+			namespaceMaxStartupLatency.WithLabelValues(ns, c.name).Set(a.max)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	networkModeHost    = "host"
+	networkModePod     = "pod"
+	networkModeUnknown = "unknown"
+
+	networkModeHeader = "X-Collector-Network"
+
+	// collectorNetworkTTL is how long the network mode of a collector which
+	// doesn't push anymore is exported, e.g. of a node scaled in
+	collectorNetworkTTL = 10 * time.Minute
+)
+
+// networkMode is the network mode the collector runs in.
+var networkMode = networkModeUnknown
+
+// collectorNetworkMode detects whether the collector runs with hostNetwork
+// by comparing the host and pod IPs exposed through the downward API.
+func collectorNetworkMode() string {
+	hostIP, podIP := os.Getenv("HOST_IP"), os.Getenv("POD_IP")
+	switch {
+	case hostIP == "" || podIP == "":
+		return networkModeUnknown
+	case hostIP == podIP:
+		return networkModeHost
+	default:
+		return networkModePod
+	}
+}
+
+// collectorNetworks holds when the network mode of the collectors was last
+// reported, so the series of collectors gone are deleted.
+type collectorNetworks struct {
+	sync.Mutex
+	// seen is keyed by the labels of the series
+	seen map[[2]string]time.Time
+}
+
+var collectors = collectorNetworks{seen: map[[2]string]time.Time{}}
+
+// recordCollectorNetworkMode exposes the network mode of the collector which
+// sends the request, a collector is told by its node, or by its address if
+// it doesn't send its node.
+func recordCollectorNetworkMode(r *http.Request) {
+	mode := r.Header.Get(networkModeHeader)
+	if mode == "" {
+		return
+	}
+	collector := r.Header.Get(nodeHeader)
+	if collector == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		collector = host
+	}
+	collectors.Lock()
+	collectors.seen[[2]string{collector, mode}] = clk.Now()
+	collectors.Unlock()
+	collectorNetwork.WithLabelValues(collector, mode).Set(1)
+}
+
+// prune deletes the series of the collectors which haven't reported their
+// network mode for the TTL.
+func (c *collectorNetworks) prune() {
+	c.Lock()
+	defer c.Unlock()
+	for labels, seen := range c.seen {
+		if clk.Since(seen) > collectorNetworkTTL {
+			collectorNetwork.DeleteLabelValues(labels[0], labels[1])
+			delete(c.seen, labels)
+		}
+	}
+}
+
+// pushClient is the client the collector pushes with.
+var pushClient = http.DefaultClient
+
+// newPushClient returns a client which pushes through the proxy, which may be
+// an http, https or socks5 URL. HTTP_PROXY, HTTPS_PROXY and NO_PROXY are
+// honored if no proxy is given.
+func newPushClient(proxy string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy %q", proxy)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, errors.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// exporterURL validates the address of the exporter and turns it into a URL,
+// a literal IPv6 address must be in brackets, e.g. [fd00::1]:9090.
+func exporterURL(addr string) (string, error) {
+	if !strings.HasPrefix(addr, "http") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid exporter address %q", addr)
+	}
+	host := u.Host
+	if h, _, err := net.SplitHostPort(u.Host); err == nil {
+		host = h
+	} else if strings.Count(u.Host, ":") > 1 && !strings.HasPrefix(u.Host, "[") {
+		return "", errors.Errorf("IPv6 address %q of the exporter must be in brackets", u.Host)
+	}
+	host = strings.Trim(host, "[]")
+	if host == "" {
+		return "", errors.Errorf("no host in exporter address %q", addr)
+	}
+	if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+		return "", errors.Errorf("invalid IPv6 address %q of the exporter", host)
+	}
+	return u.String(), nil
+}
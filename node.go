@@ -0,0 +1,132 @@
+package main
+
+import (
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	nodeHeader = "X-Collector-Node"
+
+	defaultNodeWindow = 10 * time.Minute
+)
+
+var (
+	nodeAvgStartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemNode,
+			Name:      "average_startup_latency_milliseconds",
+		},
+		[]string{
+			"node",
+		},
+	)
+	nodeP95StartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemNode,
+			Name:      "p95_startup_latency_milliseconds",
+		},
+		[]string{
+			"node",
+		},
+	)
+	nodeStartups = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemNode,
+			Name:      "startups",
+		},
+		[]string{
+			"node",
+		},
+	)
+)
+
+// nodeName is the name of the node the collector runs on.
+var nodeName string
+
+// collectorNode returns the node name exposed through the downward API, or
+// the hostname if it's not.
+func collectorNode() string {
+	if name := os.Getenv("NODE_NAME"); name != "" {
+		return name
+	}
+	name, _ := os.Hostname()
+	return name
+}
+
+type nodeSample struct {
+	received time.Time
+	latency  float64
+}
+
+// nodeTracker aggregates the startup latency of the containers of every node
+// over a rolling window, so a degrading node stands out.
+type nodeTracker struct {
+	sync.Mutex
+	window  time.Duration
+	samples map[string][]nodeSample
+}
+
+var nodes = nodeTracker{
+	window:  defaultNodeWindow,
+	samples: map[string][]nodeSample{},
+}
+
+// add adds the startup record of a container of the node.
+func (n *nodeTracker) add(r startupRecord) {
+	if r.Node == "" {
+		return
+	}
+	n.Lock()
+	defer n.Unlock()
+	n.samples[r.Node] = append(n.samples[r.Node], nodeSample{received: r.Received, latency: r.milliseconds()})
+}
+
+// export drops the samples out of the window and sets the aggregates of the
+// nodes.
+func (n *nodeTracker) export() {
+	n.Lock()
+	defer n.Unlock()
+	nodeAvgStartupLatency.Reset()
+	nodeP95StartupLatency.Reset()
+	nodeStartups.Reset()
+	now := clk.Now()
+	for node, samples := range n.samples {
+		i := 0
+		for i < len(samples) && now.Sub(samples[i].received) > n.window {
+			i++
+		}
+		samples = samples[i:]
+		if len(samples) == 0 {
+			delete(n.samples, node)
+			continue
+		}
+		n.samples[node] = samples
+		latencies := make([]float64, len(samples))
+		var total float64
+		for i, s := range samples {
+			latencies[i] = s.latency
+			total += s.latency
+		}
+		sort.Float64s(latencies)
+		p95 := latencies[int(math.Ceil(0.95*float64(len(latencies))))-1]
+		nodeAvgStartupLatency.WithLabelValues(node).Set(total / float64(len(samples)))
+		nodeP95StartupLatency.WithLabelValues(node).Set(p95)
+		nodeStartups.WithLabelValues(node).Set(float64(len(samples)))
+	}
+}
+
+func (n *nodeTracker) reset() {
+	n.Lock()
+	defer n.Unlock()
+	n.samples = map[string][]nodeSample{}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	degradedReasonCordoned       = "cordoned"
+	degradedReasonDiskPressure   = "disk-pressure"
+	degradedReasonMemoryPressure = "memory-pressure"
+	degradedReasonRebooted       = "rebooted"
+
+	// nodeRebootWindow is how long after a reboot a node is considered
+	// degraded, its images and page cache are cold
+	nodeRebootWindow = 10 * time.Minute
+)
+
+// excludeDegradedNodes is true if pods on degraded nodes are excluded from
+// the deployment aggregation rather than only reported.
+var excludeDegradedNodes bool
+
+// nodeStates tells whether nodes were in a known degraded condition when a
+// pod started on them, which skews the startup latency of the pod. A node
+// which recovers or degrades later doesn't change what's told about the pods
+// started before.
+type nodeStates struct {
+	sync.Mutex
+	nodeLister corelisters.NodeLister
+	// reboots holds when the boot ID of the nodes was seen changing
+	reboots map[string]time.Time
+	// cordons holds the last time the nodes were cordoned
+	cordons map[string]cordonSpan
+}
+
+// cordonSpan is when a node was cordoned and uncordoned, from is zero if it
+// was cordoned before the exporter started and to is zero while it's still
+// cordoned.
+type cordonSpan struct {
+	from, to time.Time
+}
+
+func (s cordonSpan) covers(t time.Time) bool {
+	return !s.from.After(t) && (s.to.IsZero() || t.Before(s.to))
+}
+
+// newNodeStates registers the event handlers which notice node reboots and
+// cordons on the informers.
+func newNodeStates(factory informers.SharedInformerFactory) *nodeStates {
+	n := &nodeStates{
+		nodeLister: factory.Core().V1().Nodes().Lister(),
+		reboots:    map[string]time.Time{},
+		cordons:    map[string]cordonSpan{},
+	}
+	factory.Core().V1().Nodes().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*corev1.Node); ok && node.Spec.Unschedulable {
+				n.Lock()
+				n.cordons[node.Name] = cordonSpan{}
+				n.Unlock()
+			}
+		},
+		UpdateFunc: func(old, obj interface{}) {
+			oldNode, ok1 := old.(*corev1.Node)
+			newNode, ok2 := obj.(*corev1.Node)
+			if !ok1 || !ok2 {
+				return
+			}
+			n.Lock()
+			defer n.Unlock()
+			if oldNode.Status.NodeInfo.BootID != "" && oldNode.Status.NodeInfo.BootID != newNode.Status.NodeInfo.BootID {
+				n.reboots[newNode.Name] = clk.Now()
+			}
+			switch {
+			case !oldNode.Spec.Unschedulable && newNode.Spec.Unschedulable:
+				n.cordons[newNode.Name] = cordonSpan{from: clk.Now()}
+			case oldNode.Spec.Unschedulable && !newNode.Spec.Unschedulable:
+				if span, exists := n.cordons[newNode.Name]; exists {
+					span.to = clk.Now()
+					n.cordons[newNode.Name] = span
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if node, ok := obj.(*corev1.Node); ok {
+				n.Lock()
+				delete(n.reboots, node.Name)
+				delete(n.cordons, node.Name)
+				n.Unlock()
+			}
+		},
+	})
+	return n
+}
+
+// podStarted returns when the pod was started by the kubelet, or now if it
+// isn't yet.
+func podStarted(p *corev1.Pod) time.Time {
+	if p.Status.StartTime == nil {
+		return clk.Now()
+	}
+	return p.Status.StartTime.Time
+}
+
+// conditionAt tells whether the condition was true at the time, a condition
+// which changed since is taken to be in the opposite state before.
+func conditionAt(c corev1.NodeCondition, t time.Time) bool {
+	if !c.LastTransitionTime.Time.After(t) {
+		return c.Status == corev1.ConditionTrue
+	}
+	return c.Status == corev1.ConditionFalse
+}
+
+// degradedReason returns why the node was degraded at the time, e.g. when a
+// pod started on it, or an empty string if it wasn't. A node counts as
+// rebooted for nodeRebootWindow after its boot ID changed or it became ready
+// again, a new node becoming ready for the first time doesn't.
+func (n *nodeStates) degradedReason(name string, at time.Time) string {
+	if name == "" {
+		return ""
+	}
+	node, err := n.nodeLister.Get(name)
+	if err != nil {
+		return ""
+	}
+	n.Lock()
+	cordon, cordoned := n.cordons[name]
+	rebooted, hasRebooted := n.reboots[name]
+	n.Unlock()
+	if cordoned && cordon.covers(at) {
+		return degradedReasonCordoned
+	}
+	readyAgain := false
+	for _, c := range node.Status.Conditions {
+		switch c.Type {
+		case corev1.NodeDiskPressure:
+			if conditionAt(c, at) {
+				return degradedReasonDiskPressure
+			}
+		case corev1.NodeMemoryPressure:
+			if conditionAt(c, at) {
+				return degradedReasonMemoryPressure
+			}
+		case corev1.NodeReady:
+			ready := c.LastTransitionTime.Time
+			readyAgain = c.Status == corev1.ConditionTrue && !ready.After(at) && at.Sub(ready) < nodeRebootWindow && ready.Sub(node.CreationTimestamp.Time) > nodeRebootWindow
+		}
+	}
+	if readyAgain || hasRebooted && !rebooted.After(at) && at.Sub(rebooted) < nodeRebootWindow {
+		return degradedReasonRebooted
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestDegradedReasonAtPodStart(t *testing.T) {
+	c := fakeClock(t)
+	now := c.Now()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	node := func(name string, created time.Time, conditions ...corev1.NodeCondition) {
+		indexer.Add(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)},
+			Status:     corev1.NodeStatus{Conditions: conditions},
+		})
+	}
+	condition := func(t corev1.NodeConditionType, status corev1.ConditionStatus, since time.Time) corev1.NodeCondition {
+		return corev1.NodeCondition{Type: t, Status: status, LastTransitionTime: metav1.NewTime(since)}
+	}
+	old := now.Add(-24 * time.Hour)
+	node("pressured", old, condition(corev1.NodeDiskPressure, corev1.ConditionTrue, now.Add(-time.Minute)))
+	node("recovered", old, condition(corev1.NodeMemoryPressure, corev1.ConditionFalse, now.Add(-time.Minute)))
+	node("rebooted", old, condition(corev1.NodeReady, corev1.ConditionTrue, now.Add(-2*time.Minute)))
+	node("new", now.Add(-3*time.Minute), condition(corev1.NodeReady, corev1.ConditionTrue, now.Add(-2*time.Minute)))
+	node("cordoned", old)
+	n := &nodeStates{
+		nodeLister: corelisters.NewNodeLister(indexer),
+		reboots:    map[string]time.Time{},
+		cordons:    map[string]cordonSpan{"cordoned": {from: now.Add(-time.Minute)}},
+	}
+	for _, tc := range []struct {
+		node string
+		at   time.Time
+		want string
+	}{
+		{"pressured", now.Add(-2 * time.Minute), ""},
+		{"pressured", now, degradedReasonDiskPressure},
+		{"recovered", now.Add(-2 * time.Minute), degradedReasonMemoryPressure},
+		{"recovered", now, ""},
+		{"rebooted", now.Add(-3 * time.Minute), ""},
+		{"rebooted", now, degradedReasonRebooted},
+		{"rebooted", now.Add(nodeRebootWindow), ""},
+		{"new", now, ""},
+		{"cordoned", now.Add(-2 * time.Minute), ""},
+		{"cordoned", now, degradedReasonCordoned},
+	} {
+		if got := n.degradedReason(tc.node, tc.at); got != tc.want {
+			t.Errorf("%s at %v is %q, want %q", tc.node, tc.at.Sub(now), got, tc.want)
+		}
+	}
+}
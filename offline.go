@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// offlineCluster is the cluster label of the aggregates of the offline mode,
+// the records don't tell which cluster they came from
+const offlineCluster = ""
+
+// offline is true if the exporter serves the records loaded from files only.
+var offline bool
+
+// loadRecords ingests the startup records in a JSON lines file, each line is
+// the startup info sent by a collector or a record dumped by the exporter.
+func loadRecords(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	n, line := 0, 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var info wireStartupInfo
+		if err := json.Unmarshal(scanner.Bytes(), &info); err != nil {
+			return n, errors.Wrapf(err, "invalid record at line %d", line)
+		}
+		record, err := normalize(info)
+		if err != nil {
+			return n, errors.Wrapf(err, "invalid record at line %d", line)
+		}
+		ingest(record)
+		n++
+	}
+	return n, scanner.Err()
+}
+
+// exportOffline aggregates the loaded records by the pods and the namespaces
+// the collectors found their containers in, as there are no clusters to
+// resolve them with. Records without a pod are left out. The pods are
+// exported with neither a node nor a runtime class.
+func exportOffline() {
+	type aggregate struct {
+		count      int
+		total, max float64
+	}
+	type podKey struct {
+		name, namespace string
+	}
+	pods := map[podKey]*startupRecord{}
+	namespaces := map[string]*aggregate{}
+	mu.Lock()
+	allInfo.each(func(_ meta, r startupRecord) {
+		if r.Pod == "" || r.PodNamespace == "" {
+			return
+		}
+		k := podKey{name: r.Pod, namespace: r.PodNamespace}
+		p, exists := pods[k]
+		if !exists {
+			p = &startupRecord{Start: r.Start, End: r.End}
+			pods[k] = p
+		}
+		if r.Start < p.Start {
+			p.Start = r.Start
+		}
+		if r.End > p.End {
+			p.End = r.End
+		}
+		a, exists := namespaces[r.PodNamespace]
+		if !exists {
+			a = &aggregate{}
+			namespaces[r.PodNamespace] = a
+		}
+		latency := r.milliseconds()
+		a.count++
+		a.total += latency
+		if latency > a.max {
+			a.max = latency
+		}
+	})
+	mu.Unlock()
+	podStartupLatency.Reset()
+	namespaceContainers.Reset()
+	namespaceAvgStartupLatency.Reset()
+	namespaceMaxStartupLatency.Reset()
+	for k, p := range pods {
+		podStartupLatency.WithLabelValues(k.name, k.namespace, offlineCluster, "", "").Set(p.milliseconds())
+	}
+	for ns, a := range namespaces {
+		namespaceContainers.WithLabelValues(ns, offlineCluster).Set(float64(a.count))
+		namespaceAvgStartupLatency.WithLabelValues(ns, offlineCluster).Set(a.total / float64(a.count))
+		namespaceMaxStartupLatency.WithLabelValues(ns, offlineCluster).Set(a.max)
+	}
+}
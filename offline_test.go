@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestOfflineAggregatesByPod(t *testing.T) {
+	resetRecords()
+	defer resetRecords()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	put := func(name, pod string, offset, latency time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		allInfo.put(meta{name: name, namespace: defaultContainerdK8sNamespace}, startupRecord{
+			Name:         name,
+			Namespace:    defaultContainerdK8sNamespace,
+			Pod:          pod,
+			PodNamespace: "default",
+			Start:        start.Add(offset).UnixNano(),
+			End:          start.Add(offset + latency).UnixNano(),
+		})
+	}
+	put("a", "web-0", 0, time.Second)
+	put("b", "web-0", 500*time.Millisecond, 2*time.Second)
+	put("c", "", 0, time.Hour)
+	exportOffline()
+	if v := testutil.ToFloat64(podStartupLatency.WithLabelValues("web-0", "default", offlineCluster, "", "")); v != 2500 {
+		t.Errorf("got pod latency %v, want 2500", v)
+	}
+	if v := testutil.ToFloat64(namespaceAvgStartupLatency.WithLabelValues("default", offlineCluster)); v != 1500 {
+		t.Errorf("got namespace average %v, want 1500 without the record missing its pod", v)
+	}
+	podStartupLatency.Reset()
+	namespaceContainers.Reset()
+	namespaceAvgStartupLatency.Reset()
+	namespaceMaxStartupLatency.Reset()
+}
@@ -0,0 +1,784 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// openAPISpec describes the ingest and query APIs of the exporter, it must be
+// updated with them.
+const openAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "startup-exporter",
+    "version": "dev"
+  },
+  "paths": {
+    "/": {
+      "post": {
+        "summary": "Submit the startup info of containers",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "oneOf": [
+                  {"$ref": "#/components/schemas/StartupInfo"},
+                  {"type": "array", "items": {"$ref": "#/components/schemas/StartupInfo"}}
+                ]
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "Accepted, the invalid records of the batch are rejected",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "accepted": {"type": "integer"},
+                    "rejected": {"type": "integer"}
+                  }
+                }
+              }
+            }
+          },
+          "400": {"description": "The body isn't JSON"},
+          "503": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/drain": {
+      "get": {
+        "summary": "Get the drain status",
+        "responses": {"200": {"$ref": "#/components/responses/DrainStatus"}}
+      },
+      "post": {
+        "summary": "Start draining and flush the state file, the measurement log and the startup events",
+        "responses": {"200": {"$ref": "#/components/responses/DrainStatus"}}
+      }
+    },
+    "/api/v1/deployments": {
+      "get": {
+        "summary": "List the deployments with a published measurement",
+        "parameters": [
+          {"$ref": "#/components/parameters/limit"},
+          {"$ref": "#/components/parameters/continue"},
+          {"$ref": "#/components/parameters/sort"},
+          {"$ref": "#/components/parameters/fields"}
+        ],
+        "responses": {
+          "200": {
+            "description": "A page of deployments",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DeploymentPage"}}}
+          }
+        }
+      }
+    },
+    "/api/v1/deployments/{namespace}/{name}": {
+      "get": {
+        "summary": "Get the measurement of a deployment with the startups of the containers of its pods",
+        "parameters": [
+          {"name": "namespace", "in": "path", "required": true, "schema": {"type": "string"}},
+          {"$ref": "#/components/parameters/name"},
+          {"name": "cluster", "in": "query", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {
+            "description": "The deployment",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DeploymentDetail"}}}
+          },
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/reset": {
+      "post": {
+        "summary": "Forget the startup records and measurements",
+        "security": [{"bearer": []}],
+        "responses": {
+          "204": {"description": "Reset"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/heatmap": {
+      "get": {
+        "summary": "Count the retained records per namespace by the step they started in and their startup latency bucket",
+        "parameters": [
+          {"name": "namespace", "in": "query", "schema": {"type": "string"}},
+          {"name": "step", "in": "query", "schema": {"type": "string", "default": "1m"}},
+          {"name": "range", "in": "query", "schema": {"type": "string", "default": "1h"}},
+          {"name": "buckets", "in": "query", "description": "comma separated upper bounds in milliseconds", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {
+            "description": "The heatmap, every step counts the buckets and the latencies over the last bucket",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Heatmap"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/analysis": {
+      "get": {
+        "summary": "Judge the startup latency of a deployment, for the web metric provider of Argo Rollouts",
+        "parameters": [
+          {"name": "namespace", "in": "query", "required": true, "schema": {"type": "string"}},
+          {"name": "name", "in": "query", "required": true, "schema": {"type": "string"}},
+          {"name": "cluster", "in": "query", "schema": {"type": "string"}},
+          {"name": "maxLatencyMs", "in": "query", "schema": {"type": "number"}}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/AnalysisResult"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Judge the startup latency of a deployment as a webhook of Flagger, maxLatencyMs and cluster are read from the metadata",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/FlaggerWebhook"}}}
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/AnalysisResult"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "412": {"$ref": "#/components/responses/AnalysisResult"}
+        }
+      }
+    },
+    "/api/v1/history": {
+      "get": {
+        "summary": "Aggregate the published measurements of a deployment in every step of the range",
+        "parameters": [
+          {"name": "deployment", "in": "query", "required": true, "schema": {"type": "string"}},
+          {"name": "namespace", "in": "query", "schema": {"type": "string"}},
+          {"name": "cluster", "in": "query", "schema": {"type": "string"}},
+          {"name": "metric", "in": "query", "schema": {"type": "string", "enum": ["startup", "scale"], "default": "startup"}},
+          {"name": "agg", "in": "query", "description": "avg, min, max, count or a percentile like p95", "schema": {"type": "string", "default": "avg"}},
+          {"name": "step", "in": "query", "description": "a duration, days like 1d are allowed", "schema": {"type": "string", "default": "1h"}},
+          {"name": "range", "in": "query", "description": "a duration, days like 7d are allowed", "schema": {"type": "string", "default": "24h"}}
+        ],
+        "responses": {
+          "200": {
+            "description": "The aggregates of the steps with measurements",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/History"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/events": {
+      "get": {
+        "summary": "List the startups of containers recorded in the event store within a time range",
+        "parameters": [
+          {"name": "since", "in": "query", "description": "a duration before now, days like 7d are allowed", "schema": {"type": "string", "default": "1h"}},
+          {"name": "from", "in": "query", "schema": {"type": "string", "format": "date-time"}},
+          {"name": "to", "in": "query", "schema": {"type": "string", "format": "date-time"}},
+          {"name": "namespace", "in": "query", "description": "namespace of the pods", "schema": {"type": "string"}},
+          {"name": "pod", "in": "query", "schema": {"type": "string"}},
+          {"name": "node", "in": "query", "schema": {"type": "string"}},
+          {"name": "type", "in": "query", "schema": {"type": "string"}},
+          {"$ref": "#/components/parameters/limit"},
+          {"$ref": "#/components/parameters/continue"},
+          {"$ref": "#/components/parameters/sort"},
+          {"$ref": "#/components/parameters/fields"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/RecordPage"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/state": {
+      "get": {
+        "summary": "Get the startup records and the published measurements of deployments, which a new replica warms up from",
+        "responses": {
+          "200": {
+            "description": "The state of the exporter",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/State"}}}
+          }
+        }
+      }
+    },
+    "/api/v1/priorities": {
+      "get": {
+        "summary": "List the deployments marked as benchmark targets",
+        "security": [{"bearer": []}],
+        "parameters": [
+          {"$ref": "#/components/parameters/limit"},
+          {"$ref": "#/components/parameters/continue"},
+          {"$ref": "#/components/parameters/fields"}
+        ],
+        "responses": {
+          "200": {
+            "description": "A page of deployments",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DeploymentRefPage"}}}
+          },
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/priorities/{namespace}/{name}": {
+      "parameters": [
+        {"name": "namespace", "in": "path", "required": true, "schema": {"type": "string"}},
+        {"$ref": "#/components/parameters/name"},
+        {"name": "cluster", "in": "query", "schema": {"type": "string"}}
+      ],
+      "put": {
+        "summary": "Mark a deployment as a benchmark target, which is aggregated first",
+        "security": [{"bearer": []}],
+        "responses": {
+          "204": {"description": "Marked"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Unmark a deployment",
+        "security": [{"bearer": []}],
+        "responses": {
+          "204": {"description": "Unmarked"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/export": {
+      "get": {
+        "summary": "Export startup records or measurements as typed JSON lines or CSV",
+        "parameters": [
+          {"name": "kind", "in": "query", "schema": {"type": "string", "enum": ["records", "measurements"], "default": "records"}},
+          {"name": "session", "in": "query", "schema": {"type": "string"}},
+          {"name": "format", "in": "query", "schema": {"type": "string", "enum": ["json", "csv"], "default": "json"}}
+        ],
+        "responses": {
+          "200": {"description": "One row per line as described by /api/v1/export/schema, CSV has a header of the columns", "content": {"application/x-ndjson": {}, "text/csv": {}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/export/schema": {
+      "get": {
+        "summary": "Get the columns of the exports with their pandas dtypes",
+        "responses": {"200": {"description": "Schemas of the exports", "content": {"application/json": {}}}}
+      }
+    },
+    "/api/v1/records": {
+      "get": {
+        "summary": "List the retained startup records",
+        "parameters": [
+          {"name": "namespace", "in": "query", "schema": {"type": "string"}},
+          {"name": "type", "in": "query", "schema": {"type": "string"}},
+          {"$ref": "#/components/parameters/limit"},
+          {"$ref": "#/components/parameters/continue"},
+          {"$ref": "#/components/parameters/sort"},
+          {"$ref": "#/components/parameters/fields"}
+        ],
+        "responses": {"200": {"$ref": "#/components/responses/RecordPage"}}
+      }
+    },
+    "/api/v1/sessions": {
+      "get": {
+        "summary": "List the sessions",
+        "responses": {
+          "200": {
+            "description": "Sessions",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/SessionSummary"}}}}
+          }
+        }
+      },
+      "post": {
+        "summary": "Start a session",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "required": ["name"],
+                "properties": {
+                  "name": {"type": "string"},
+                  "namespaces": {"type": "array", "items": {"type": "string"}}
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "201": {"description": "Started", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SessionSummary"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/sessions/{name}": {
+      "parameters": [{"$ref": "#/components/parameters/name"}],
+      "get": {
+        "summary": "Get a session",
+        "responses": {
+          "200": {"description": "Session", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Session"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Delete a session",
+        "responses": {
+          "204": {"description": "Deleted"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/sessions/{name}/stop": {
+      "parameters": [{"$ref": "#/components/parameters/name"}],
+      "post": {
+        "summary": "Stop a session",
+        "responses": {
+          "200": {"description": "Stopped", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SessionSummary"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/sessions/{name}/records": {
+      "parameters": [{"$ref": "#/components/parameters/name"}],
+      "get": {
+        "summary": "List the startup records of a session",
+        "parameters": [
+          {"$ref": "#/components/parameters/limit"},
+          {"$ref": "#/components/parameters/continue"},
+          {"$ref": "#/components/parameters/sort"},
+          {"$ref": "#/components/parameters/fields"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/RecordPage"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/sessions/{name}/measurements": {
+      "parameters": [{"$ref": "#/components/parameters/name"}],
+      "get": {
+        "summary": "List the measurements of a session",
+        "parameters": [
+          {"$ref": "#/components/parameters/limit"},
+          {"$ref": "#/components/parameters/continue"},
+          {"$ref": "#/components/parameters/sort"},
+          {"$ref": "#/components/parameters/fields"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/MeasurementPage"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/stream": {
+      "get": {
+        "summary": "Stream records, measurements and aggregates of deployments as server-sent events",
+        "responses": {"200": {"description": "Events named record, measurement or aggregate", "content": {"text/event-stream": {}}}}
+      }
+    },
+    "/api/v1/experiments": {
+      "get": {
+        "summary": "List the experiments",
+        "parameters": [
+          {"$ref": "#/components/parameters/limit"},
+          {"$ref": "#/components/parameters/continue"},
+          {"$ref": "#/components/parameters/sort"},
+          {"$ref": "#/components/parameters/fields"}
+        ],
+        "responses": {
+          "200": {
+            "description": "A page of experiments",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ExperimentPage"}}}
+          }
+        }
+      }
+    },
+    "/api/v1/experiments/{id}": {
+      "get": {
+        "summary": "Get an experiment",
+        "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}],
+        "responses": {
+          "200": {"description": "Experiment", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Experiment"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/experiments/pod-kill": {
+      "post": {
+        "summary": "Kill a random pod of a deployment and measure its self-healing latency",
+        "security": [{"bearer": []}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ExperimentRequest"}}}},
+        "responses": {
+          "202": {"$ref": "#/components/responses/Experiment"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/experiments/scale": {
+      "post": {
+        "summary": "Scale up a deployment and measure its scale latency",
+        "security": [{"bearer": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "allOf": [
+                  {"$ref": "#/components/schemas/ExperimentRequest"},
+                  {"type": "object", "required": ["replicas"], "properties": {"replicas": {"type": "integer", "format": "int32"}}}
+                ]
+              }
+            }
+          }
+        },
+        "responses": {
+          "202": {"$ref": "#/components/responses/Experiment"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "bearer": {"type": "http", "scheme": "bearer"}
+    },
+    "parameters": {
+      "name": {"name": "name", "in": "path", "required": true, "schema": {"type": "string"}},
+      "limit": {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 0}},
+      "continue": {"name": "continue", "in": "query", "schema": {"type": "string"}},
+      "sort": {"name": "sort", "in": "query", "schema": {"type": "string", "enum": ["latency", "-latency", "time", "-time"]}},
+      "fields": {"name": "fields", "in": "query", "description": "comma separated JSON fields of the items", "schema": {"type": "string"}}
+    },
+    "responses": {
+      "Error": {"description": "Error", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "DrainStatus": {"description": "Drain status", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DrainStatus"}}}},
+      "Experiment": {"description": "Started experiment", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Experiment"}}}},
+      "RecordPage": {"description": "A page of startup records", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RecordPage"}}}},
+      "MeasurementPage": {"description": "A page of measurements", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/MeasurementPage"}}}},
+      "AnalysisResult": {"description": "The judged startup latency", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AnalysisResult"}}}}
+    },
+    "schemas": {
+      "Error": {
+        "type": "object",
+        "properties": {"error": {"type": "string"}}
+      },
+      "AnalysisResult": {
+        "type": "object",
+        "properties": {
+          "cluster": {"type": "string"},
+          "namespace": {"type": "string"},
+          "name": {"type": "string"},
+          "avgLatencyMs": {"type": "number"},
+          "samples": {"type": "integer"},
+          "scaleLatencyMs": {"type": "number"},
+          "maxLatencyMs": {"type": "number"},
+          "passed": {"type": "boolean"},
+          "updated": {"type": "string", "format": "date-time"}
+        }
+      },
+      "History": {
+        "type": "object",
+        "properties": {
+          "deployment": {"type": "string"},
+          "namespace": {"type": "string"},
+          "cluster": {"type": "string"},
+          "metric": {"type": "string"},
+          "agg": {"type": "string"},
+          "start": {"type": "string", "format": "date-time"},
+          "step": {"type": "string"},
+          "points": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "time": {"type": "string", "format": "date-time"},
+                "value": {"type": "number"},
+                "samples": {"type": "integer"}
+              }
+            }
+          }
+        }
+      },
+      "FlaggerWebhook": {
+        "type": "object",
+        "required": ["name", "namespace"],
+        "properties": {
+          "name": {"type": "string"},
+          "namespace": {"type": "string"},
+          "phase": {"type": "string"},
+          "metadata": {"type": "object", "additionalProperties": {"type": "string"}}
+        }
+      },
+      "StartupInfo": {
+        "type": "object",
+        "required": ["name", "namespace", "start", "end"],
+        "properties": {
+          "name": {"type": "string"},
+          "namespace": {"type": "string"},
+          "start": {"oneOf": [{"type": "integer", "format": "int64"}, {"type": "string", "format": "date-time"}]},
+          "end": {"oneOf": [{"type": "integer", "format": "int64"}, {"type": "string", "format": "date-time"}]},
+          "type": {"type": "string", "enum": ["default", "checkpoint", "wasm"]},
+          "attempt": {"type": "integer"},
+          "unit": {"type": "string", "enum": ["s", "ms", "us", "ns"]},
+          "extras": {"type": "object", "additionalProperties": {"type": "string"}},
+          "pod": {"type": "string"},
+          "podNamespace": {"type": "string"},
+          "image": {"type": "string"},
+          "snapshot": {"type": "string", "enum": ["reused", "new", "unknown"]},
+          "requestId": {"type": "string", "description": "set by an exporter mirroring the record, the X-Request-ID header is used otherwise"}
+        }
+      },
+      "Record": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "namespace": {"type": "string"},
+          "type": {"type": "string"},
+          "attempt": {"type": "integer"},
+          "start": {"type": "integer", "format": "int64", "description": "unix nanoseconds"},
+          "end": {"type": "integer", "format": "int64", "description": "unix nanoseconds"},
+          "received": {"type": "string", "format": "date-time"},
+          "extras": {"type": "object", "additionalProperties": {"type": "string"}},
+          "node": {"type": "string"},
+          "pod": {"type": "string"},
+          "podNamespace": {"type": "string"},
+          "image": {"type": "string"},
+          "snapshot": {"type": "string", "enum": ["reused", "new", "unknown"]},
+          "requestId": {"type": "string", "description": "ID of the push or pull the record was received with"}
+        }
+      },
+      "Measurement": {
+        "type": "object",
+        "properties": {
+          "kind": {"type": "string", "enum": ["scale", "self-healing"]},
+          "workload": {"type": "string", "description": "kind of the workload if it's not a deployment"},
+          "cluster": {"type": "string"},
+          "namespace": {"type": "string"},
+          "deployment": {"type": "string"},
+          "replicas": {"type": "integer", "format": "int32"},
+          "pods": {"type": "integer"},
+          "latencyMs": {"type": "number"},
+          "time": {"type": "string", "format": "date-time"},
+          "tags": {"type": "object", "additionalProperties": {"type": "string"}},
+          "strategy": {"type": "string", "enum": ["RollingUpdate", "Recreate"], "description": "strategy of the deployment of a scale measurement"},
+          "maxSurge": {"type": "string"},
+          "maxUnavailable": {"type": "string"}
+        }
+      },
+      "DrainStatus": {
+        "type": "object",
+        "properties": {
+          "draining": {"type": "boolean"},
+          "pending": {"type": "integer"},
+          "ready": {"type": "boolean"},
+          "flushed": {"type": "object", "additionalProperties": {"type": "string"}}
+        }
+      },
+      "SessionSummary": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "started": {"type": "string", "format": "date-time"},
+          "stopped": {"type": "string", "format": "date-time"},
+          "records": {"type": "integer"},
+          "droppedRecords": {"type": "integer"},
+          "avgLatencyMs": {"type": "number"},
+          "maxLatencyMs": {"type": "number"},
+          "measurements": {"type": "integer"}
+        }
+      },
+      "Session": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "namespaces": {"type": "array", "items": {"type": "string"}},
+          "started": {"type": "string", "format": "date-time"},
+          "stopped": {"type": "string", "format": "date-time"},
+          "records": {"type": "array", "items": {"$ref": "#/components/schemas/Record"}},
+          "droppedRecords": {"type": "integer"},
+          "measurements": {"type": "array", "items": {"$ref": "#/components/schemas/Measurement"}}
+        }
+      },
+      "ExperimentRequest": {
+        "type": "object",
+        "required": ["namespace", "deployment"],
+        "properties": {
+          "cluster": {"type": "string"},
+          "namespace": {"type": "string"},
+          "deployment": {"type": "string"},
+          "tags": {"type": "object", "additionalProperties": {"type": "string"}}
+        }
+      },
+      "Experiment": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "kind": {"type": "string", "enum": ["pod-kill", "scale"]},
+          "cluster": {"type": "string"},
+          "namespace": {"type": "string"},
+          "deployment": {"type": "string"},
+          "pod": {"type": "string"},
+          "replicas": {"type": "integer", "format": "int32"},
+          "tags": {"type": "object", "additionalProperties": {"type": "string"}},
+          "started": {"type": "string", "format": "date-time"},
+          "status": {"type": "string", "enum": ["running", "measured", "failed"]},
+          "error": {"type": "string"},
+          "finished": {"type": "string", "format": "date-time"},
+          "measurement": {"$ref": "#/components/schemas/Measurement"}
+        }
+      },
+      "RecordPage": {
+        "type": "object",
+        "properties": {
+          "items": {"type": "array", "items": {"$ref": "#/components/schemas/Record"}},
+          "continue": {"type": "string"}
+        }
+      },
+      "MeasurementPage": {
+        "type": "object",
+        "properties": {
+          "items": {"type": "array", "items": {"$ref": "#/components/schemas/Measurement"}},
+          "continue": {"type": "string"}
+        }
+      },
+      "Deployment": {
+        "type": "object",
+        "properties": {
+          "cluster": {"type": "string"},
+          "namespace": {"type": "string"},
+          "name": {"type": "string"},
+          "avgLatencyMs": {"type": "number"},
+          "samples": {"type": "integer"},
+          "scaleLatencyMs": {"type": "number"},
+          "updated": {"type": "string", "format": "date-time"}
+        }
+      },
+      "State": {
+        "type": "object",
+        "properties": {
+          "records": {"type": "array", "items": {"$ref": "#/components/schemas/Record"}},
+          "deployments": {"type": "array", "items": {"$ref": "#/components/schemas/Deployment"}}
+        }
+      },
+      "DeploymentDetail": {
+        "type": "object",
+        "properties": {
+          "cluster": {"type": "string"},
+          "namespace": {"type": "string"},
+          "name": {"type": "string"},
+          "avgLatencyMs": {"type": "number"},
+          "samples": {"type": "integer"},
+          "scaleLatencyMs": {"type": "number"},
+          "updated": {"type": "string", "format": "date-time"},
+          "measured": {"type": "boolean"},
+          "missingContainers": {"type": "integer"},
+          "pods": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "name": {"type": "string"},
+                "node": {"type": "string"},
+                "phase": {"type": "string"},
+                "containers": {
+                  "type": "array",
+                  "items": {
+                    "type": "object",
+                    "properties": {
+                      "name": {"type": "string"},
+                      "sidecar": {"type": "boolean"},
+                      "type": {"type": "string"},
+                      "latencyMs": {"type": "number"},
+                      "missing": {"type": "boolean"},
+                      "reason": {"type": "string"}
+                    }
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "DeploymentPage": {
+        "type": "object",
+        "properties": {
+          "items": {"type": "array", "items": {"$ref": "#/components/schemas/Deployment"}},
+          "continue": {"type": "string"}
+        }
+      },
+      "Heatmap": {
+        "type": "object",
+        "properties": {
+          "start": {"type": "string", "format": "date-time"},
+          "step": {"type": "string"},
+          "buckets": {"type": "array", "items": {"type": "number"}},
+          "times": {"type": "array", "items": {"type": "string", "format": "date-time"}},
+          "namespaces": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "namespace": {"type": "string"},
+                "counts": {"type": "array", "items": {"type": "array", "items": {"type": "integer"}}}
+              }
+            }
+          }
+        }
+      },
+      "DeploymentRef": {
+        "type": "object",
+        "properties": {
+          "cluster": {"type": "string"},
+          "namespace": {"type": "string"},
+          "name": {"type": "string"}
+        }
+      },
+      "DeploymentRefPage": {
+        "type": "object",
+        "properties": {
+          "items": {"type": "array", "items": {"$ref": "#/components/schemas/DeploymentRef"}},
+          "continue": {"type": "string"}
+        }
+      },
+      "ExperimentPage": {
+        "type": "object",
+        "properties": {
+          "items": {"type": "array", "items": {"$ref": "#/components/schemas/Experiment"}},
+          "continue": {"type": "string"}
+        }
+      }
+    }
+  }
+}`
+
+// handleOpenAPI serves the OpenAPI document of the exporter.
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal([]byte(openAPISpec), &spec); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	spec["info"].(map[string]interface{})["version"] = version
+	writeJSON(w, http.StatusOK, spec)
+}
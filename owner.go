@@ -0,0 +1,143 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ownerCache caches which deployment a pod belongs to through the owner
+// references of the pod and its replica set, the entries are invalidated when
+// the owner references change.
+type ownerCache struct {
+	sync.RWMutex
+	rsLister appslisters.ReplicaSetLister
+	pods     map[types.UID]ownerEntry
+}
+
+type ownerEntry struct {
+	rs     types.UID
+	deploy meta
+	// owned is false if the pod doesn't belong to any deployment
+	owned bool
+}
+
+// newOwnerCache registers the event handlers which invalidate the cache on
+// the informers.
+func newOwnerCache(factory informers.SharedInformerFactory) *ownerCache {
+	o := &ownerCache{
+		rsLister: factory.Apps().V1().ReplicaSets().Lister(),
+		pods:     map[types.UID]ownerEntry{},
+	}
+	factory.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, obj interface{}) {
+			oldPod, ok1 := old.(*corev1.Pod)
+			newPod, ok2 := obj.(*corev1.Pod)
+			if ok1 && ok2 && !reflect.DeepEqual(oldPod.OwnerReferences, newPod.OwnerReferences) {
+				o.forgetPod(newPod.UID)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if p, ok := obj.(*corev1.Pod); ok {
+				o.forgetPod(p.UID)
+			}
+		},
+	})
+	factory.Apps().V1().ReplicaSets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, obj interface{}) {
+			oldRS, ok1 := old.(*appsv1.ReplicaSet)
+			newRS, ok2 := obj.(*appsv1.ReplicaSet)
+			if ok1 && ok2 && !reflect.DeepEqual(oldRS.OwnerReferences, newRS.OwnerReferences) {
+				o.forgetReplicaSet(newRS.UID)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if rs, ok := obj.(*appsv1.ReplicaSet); ok {
+				o.forgetReplicaSet(rs.UID)
+			}
+		},
+	})
+	return o
+}
+
+func (o *ownerCache) forgetPod(uid types.UID) {
+	o.Lock()
+	defer o.Unlock()
+	delete(o.pods, uid)
+}
+
+func (o *ownerCache) forgetReplicaSet(uid types.UID) {
+	o.Lock()
+	defer o.Unlock()
+	for pod, e := range o.pods {
+		if e.rs == uid {
+			delete(o.pods, pod)
+		}
+	}
+}
+
+// deployment returns the deployment which owns the pod.
+func (o *ownerCache) deployment(p *corev1.Pod) (meta, bool) {
+	o.RLock()
+	e, cached := o.pods[p.UID]
+	o.RUnlock()
+	if cached {
+		return e.deploy, e.owned
+	}
+	e, resolved := o.resolve(p)
+	if resolved {
+		o.Lock()
+		o.pods[p.UID] = e
+		o.Unlock()
+	}
+	return e.deploy, e.owned
+}
+
+// resolve walks the owner references of the pod, the result is not resolved
+// if the replica set of the pod isn't in the informer cache yet.
+func (o *ownerCache) resolve(p *corev1.Pod) (ownerEntry, bool) {
+	ref := metav1.GetControllerOf(p)
+	if ref == nil || ref.Kind != "ReplicaSet" {
+		return ownerEntry{}, true
+	}
+	e := ownerEntry{rs: ref.UID}
+	rs, err := o.rsLister.ReplicaSets(p.Namespace).Get(ref.Name)
+	if err != nil || rs.UID != ref.UID {
+		return ownerEntry{}, false
+	}
+	ref = metav1.GetControllerOf(rs)
+	if ref == nil || ref.Kind != "Deployment" {
+		return e, true
+	}
+	e.deploy = meta{name: ref.Name, namespace: rs.Namespace}
+	e.owned = true
+	return e, true
+}
+
+// ownedBy returns the pods which belong to the deployment, pods selected by
+// the labels of a deployment may belong to another one.
+func (o *ownerCache) ownedBy(m meta, pods []*corev1.Pod) []*corev1.Pod {
+	var owned []*corev1.Pod
+	for _, p := range pods {
+		if p == nil {
+			continue
+		}
+		if d, ok := o.deployment(p); ok && d == m {
+			owned = append(owned, p)
+		}
+	}
+	return owned
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	sortByLatency = "latency"
+	sortByTime    = "time"
+)
+
+// listItem is an item of a list API with the keys it can be sorted by.
+type listItem struct {
+	value interface{}
+	// name identifies the item, items are ordered by it after the sort
+	// key, so the order of items kept in a map is stable
+	name    string
+	latency float64
+	time    time.Time
+}
+
+// listCursor is the sort key of the last item of a page, which is encoded in
+// the continue token, so the next page starts after it even if items are
+// added or removed in between.
+type listCursor struct {
+	Sort    string    `json:"s,omitempty"`
+	Latency float64   `json:"l,omitempty"`
+	Time    time.Time `json:"t"`
+	Name    string    `json:"n"`
+}
+
+// listPage is a page of a list API, Continue is passed as the continue
+// parameter to get the next page and is empty on the last one.
+type listPage struct {
+	Items    []interface{} `json:"items"`
+	Continue string        `json:"continue,omitempty"`
+}
+
+// listQuery is how the items of a list API are paged, sorted and selected.
+// The parameters are limit, continue, sort as latency or time with a "-"
+// prefix for descending order, and fields as a comma separated list of the
+// JSON fields of the items.
+type listQuery struct {
+	limit  int
+	after  *listCursor
+	sort   string
+	desc   bool
+	fields []string
+}
+
+func parseListQuery(r *http.Request) (listQuery, error) {
+	var q listQuery
+	values := r.URL.Query()
+	if s := values.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 0 {
+			return q, errors.Errorf("invalid limit %q", s)
+		}
+		q.limit = limit
+	}
+	if s := values.Get("sort"); s != "" {
+		q.desc = strings.HasPrefix(s, "-")
+		q.sort = strings.TrimPrefix(s, "-")
+		if q.sort != sortByLatency && q.sort != sortByTime {
+			return q, errors.Errorf("unknown sort key %q", q.sort)
+		}
+	}
+	if s := values.Get("continue"); s != "" {
+		bs, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return q, errors.New("invalid continue token")
+		}
+		q.after = &listCursor{}
+		if err := json.Unmarshal(bs, q.after); err != nil {
+			return q, errors.New("invalid continue token")
+		}
+		if q.after.Sort != values.Get("sort") {
+			return q, errors.New("the continue token is of another sort")
+		}
+	}
+	if s := values.Get("fields"); s != "" {
+		q.fields = strings.Split(s, ",")
+	}
+	return q, nil
+}
+
+// less orders the items by the sort key and then by their names.
+func (q listQuery) less(a, b listItem) bool {
+	switch q.sort {
+	case sortByLatency:
+		if a.latency != b.latency {
+			return a.latency < b.latency != q.desc
+		}
+	case sortByTime:
+		if !a.time.Equal(b.time) {
+			return a.time.Before(b.time) != q.desc
+		}
+	}
+	return a.name < b.name
+}
+
+// page sorts the items and returns the page of them the query asks for.
+func (q listQuery) page(items []listItem) (listPage, error) {
+	sort.Slice(items, func(i, j int) bool {
+		return q.less(items[i], items[j])
+	})
+	if q.after != nil {
+		last := listItem{name: q.after.Name, latency: q.after.Latency, time: q.after.Time}
+		items = items[sort.Search(len(items), func(i int) bool {
+			return q.less(last, items[i])
+		}):]
+	}
+	page := listPage{Items: []interface{}{}}
+	if q.limit > 0 && q.limit < len(items) {
+		items = items[:q.limit]
+		last := items[len(items)-1]
+		sortParam := q.sort
+		if q.desc {
+			sortParam = "-" + sortParam
+		}
+		bs, err := json.Marshal(listCursor{Sort: sortParam, Latency: last.latency, Time: last.time, Name: last.name})
+		if err != nil {
+			return page, err
+		}
+		page.Continue = base64.RawURLEncoding.EncodeToString(bs)
+	}
+	for _, item := range items {
+		v, err := q.selectFields(item.value)
+		if err != nil {
+			return page, err
+		}
+		page.Items = append(page.Items, v)
+	}
+	return page, nil
+}
+
+// selectFields returns the value with only the selected JSON fields.
+func (q listQuery) selectFields(v interface{}) (interface{}, error) {
+	if len(q.fields) == 0 {
+		return v, nil
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(bs, &all); err != nil {
+		return nil, err
+	}
+	selected := map[string]json.RawMessage{}
+	for _, f := range q.fields {
+		if raw, ok := all[f]; ok {
+			selected[f] = raw
+		}
+	}
+	return selected, nil
+}
+
+// writeList writes the page of the items the request asks for.
+func writeList(w http.ResponseWriter, r *http.Request, items []listItem) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := q.page(items)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func listNames(t *testing.T, query string, items []listItem) ([]string, string) {
+	q, err := parseListQuery(httptest.NewRequest("GET", "/?"+query, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := q.page(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, v := range page.Items {
+		names = append(names, v.(string))
+	}
+	return names, page.Continue
+}
+
+func TestListContinuesAfterLastItem(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	item := func(name string, seconds int) listItem {
+		return listItem{value: name, name: name, time: start.Add(time.Duration(seconds) * time.Second)}
+	}
+	items := []listItem{item("d", 3), item("a", 1), item("c", 2), item("b", 1)}
+	names, token := listNames(t, "sort=time&limit=2", items)
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" || token == "" {
+		t.Fatalf("got %v, %q", names, token)
+	}
+	// an item before the cursor is removed and one is added between pages
+	items = []listItem{item("d", 3), item("c", 2), item("b", 1), item("e", 0)}
+	names, token = listNames(t, "sort=time&limit=2&continue="+token, items)
+	if len(names) != 2 || names[0] != "c" || names[1] != "d" || token != "" {
+		t.Errorf("got %v, %q, want the items after b", names, token)
+	}
+
+	_, token = listNames(t, "sort=latency&limit=1", items)
+	if _, err := parseListQuery(httptest.NewRequest("GET", "/?sort=time&continue="+token, nil)); err == nil {
+		t.Errorf("a token of another sort is accepted")
+	}
+}
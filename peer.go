@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultWarmUpTimeout = 30 * time.Second
+
+// handleState writes the state of the exporter with GET on /api/v1/state, a
+// new replica warms up from it before serving.
+func handleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, currentState())
+}
+
+// warmUp restores the state of the first of the peers which serves it, so a
+// new replica doesn't expose empty metrics until the collectors send startup
+// info again. A replica without reachable peers starts cold.
+func warmUp(peers []string, token string, timeout time.Duration) {
+	client := &http.Client{Timeout: timeout}
+	for _, peer := range peers {
+		st, err := fetchState(client, peer, token)
+		if err != nil {
+			logrus.WithError(err).Warnf("failed to warm up from %s", peer)
+			continue
+		}
+		st.restore()
+		logrus.Infof("warmed up with %d records and %d deployments from %s", len(st.Records), len(st.Deployments), peer)
+		return
+	}
+	if len(peers) > 0 {
+		logrus.Warn("no peer to warm up from, starting cold")
+	}
+}
+
+func fetchState(client *http.Client, peer, token string) (*exporterState, error) {
+	addr, err := exporterURL(peer)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(addr, "/")+"/api/v1/state", nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("peer returned %d", resp.StatusCode)
+	}
+	st := &exporterState{}
+	if err := json.NewDecoder(resp.Body).Decode(st); err != nil {
+		return nil, errors.Wrap(err, "invalid state")
+	}
+	return st, nil
+}
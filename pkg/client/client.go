@@ -0,0 +1,350 @@
+// Package client is a Go client of the startup-exporter API, so benchmark
+// harnesses can submit startup info and measure deployments without
+// hand-rolling HTTP calls.
+//
+// Requests failing with a network error or a 502, 503 or 504 status are
+// retried with a backoff, except scaling a deployment, which would scale it
+// again if the first request went through. APIs which change the clusters need the API token
+// of the exporter, which is set with WithToken.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/YLonely/startup-exporter/pkg/clock"
+)
+
+const (
+	defaultRetries      = 3
+	defaultBackoff      = 500 * time.Millisecond
+	defaultPollInterval = 2 * time.Second
+	// defaultMeasureTimeout is how long the exporter waits for the pods of
+	// a scale event
+	defaultMeasureTimeout = 30 * time.Minute
+)
+
+// Interface is the API of a startup-exporter, Client implements it and
+// package testing of startup-exporter has a fake of it.
+type Interface interface {
+	SubmitStartupInfo(ctx context.Context, info ...StartupInfo) error
+	ListDeployments(ctx context.Context) ([]Deployment, error)
+	Measure(ctx context.Context, req ScaleRequest) (*Measurement, error)
+	Reset(ctx context.Context) error
+}
+
+var _ Interface = (*Client)(nil)
+
+// Client talks to a startup-exporter.
+type Client struct {
+	addr           string
+	token          string
+	http           *http.Client
+	retries        int
+	backoff        time.Duration
+	pollInterval   time.Duration
+	measureTimeout time.Duration
+	clock          clock.Clock
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithToken sets the bearer token sent to the exporter.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient sets the HTTP client requests are sent with.
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) {
+		c.http = h
+	}
+}
+
+// WithRetries sets how many times a failed request is retried and the
+// backoff before the first retry, which doubles on every retry.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithPollInterval sets how often Measure polls for the result.
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		c.pollInterval = interval
+	}
+}
+
+// WithMeasureTimeout sets how long Measure waits for the result, 0 means
+// until the context is done.
+func WithMeasureTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.measureTimeout = timeout
+	}
+}
+
+// WithClock sets the clock the backoffs and polls wait on, a clock.Fake makes
+// them wait for the test.
+func WithClock(c clock.Clock) Option {
+	return func(cl *Client) {
+		cl.clock = c
+	}
+}
+
+// New returns a client of the exporter at the address, e.g.
+// http://startup-exporter.monitoring.svc:9090.
+func New(addr string, opts ...Option) *Client {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	c := &Client{
+		addr:           strings.TrimSuffix(addr, "/"),
+		http:           http.DefaultClient,
+		retries:        defaultRetries,
+		backoff:        defaultBackoff,
+		pollInterval:   defaultPollInterval,
+		measureTimeout: defaultMeasureTimeout,
+		clock:          clock.Real{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// StartupInfo is the startup info of a container as collectors send it.
+type StartupInfo struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// Start and End are unix timestamps in Unit
+	Start        int64             `json:"start"`
+	End          int64             `json:"end"`
+	Type         string            `json:"type,omitempty"`
+	Attempt      int               `json:"attempt"`
+	Unit         string            `json:"unit,omitempty"`
+	Extras       map[string]string `json:"extras,omitempty"`
+	Pod          string            `json:"pod,omitempty"`
+	PodNamespace string            `json:"podNamespace,omitempty"`
+	Image        string            `json:"image,omitempty"`
+	Snapshot     string            `json:"snapshot,omitempty"`
+}
+
+// Deployment is the last published measurement of a deployment.
+type Deployment struct {
+	Cluster        string    `json:"cluster,omitempty"`
+	Namespace      string    `json:"namespace"`
+	Name           string    `json:"name"`
+	AvgLatencyMs   float64   `json:"avgLatencyMs"`
+	Samples        int       `json:"samples"`
+	ScaleLatencyMs *float64  `json:"scaleLatencyMs,omitempty"`
+	Updated        time.Time `json:"updated"`
+}
+
+// Measurement is a completed scale event or the recovery of a deployment.
+type Measurement struct {
+	Kind       string            `json:"kind"`
+	Workload   string            `json:"workload,omitempty"`
+	Cluster    string            `json:"cluster,omitempty"`
+	Namespace  string            `json:"namespace"`
+	Deployment string            `json:"deployment"`
+	Replicas   int32             `json:"replicas"`
+	Pods       int               `json:"pods"`
+	LatencyMs  float64           `json:"latencyMs"`
+	Time       time.Time         `json:"time"`
+	Tags       map[string]string `json:"tags,omitempty"`
+}
+
+// Experiment is a disruption of a deployment triggered through the API, its
+// status is running until it's measured or failed.
+type Experiment struct {
+	ID          string            `json:"id"`
+	Kind        string            `json:"kind"`
+	Cluster     string            `json:"cluster,omitempty"`
+	Namespace   string            `json:"namespace"`
+	Deployment  string            `json:"deployment"`
+	Pod         string            `json:"pod,omitempty"`
+	Replicas    int32             `json:"replicas,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Started     time.Time         `json:"started"`
+	Status      string            `json:"status"`
+	Error       string            `json:"error,omitempty"`
+	Finished    *time.Time        `json:"finished,omitempty"`
+	Measurement *Measurement      `json:"measurement,omitempty"`
+}
+
+// ScaleRequest asks to scale a deployment up to the replicas.
+type ScaleRequest struct {
+	Cluster    string            `json:"cluster,omitempty"`
+	Namespace  string            `json:"namespace"`
+	Deployment string            `json:"deployment"`
+	Replicas   int32             `json:"replicas"`
+	Tags       map[string]string `json:"tags,omitempty"`
+}
+
+// Error is an error response of the exporter.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("exporter returned %d: %s", e.StatusCode, e.Message)
+}
+
+// SubmitStartupInfo sends the startup info of containers in one request.
+func (c *Client) SubmitStartupInfo(ctx context.Context, info ...StartupInfo) error {
+	if len(info) == 0 {
+		return nil
+	}
+	return c.do(ctx, http.MethodPost, "/", info, nil)
+}
+
+// ListDeployments returns all the deployments with a published measurement.
+func (c *Client) ListDeployments(ctx context.Context) ([]Deployment, error) {
+	var (
+		deployments []Deployment
+		token       string
+	)
+	for {
+		var page struct {
+			Items    []Deployment `json:"items"`
+			Continue string       `json:"continue"`
+		}
+		path := "/api/v1/deployments?limit=500"
+		if token != "" {
+			path += "&continue=" + url.QueryEscape(token)
+		}
+		if err := c.do(ctx, http.MethodGet, path, nil, &page); err != nil {
+			return nil, err
+		}
+		deployments = append(deployments, page.Items...)
+		if page.Continue == "" {
+			return deployments, nil
+		}
+		token = page.Continue
+	}
+}
+
+// Measure scales a deployment up and waits until its scale latency is
+// measured, the measure timeout passes or the context is done. The scale
+// request isn't retried.
+func (c *Client) Measure(ctx context.Context, req ScaleRequest) (*Measurement, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var e Experiment
+	if err := c.send(ctx, http.MethodPost, "/api/v1/experiments/scale", body, &e); err != nil {
+		return nil, err
+	}
+	var timeout <-chan time.Time
+	if c.measureTimeout > 0 {
+		timeout = c.clock.After(c.measureTimeout)
+	}
+	ticker := c.clock.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+	for e.Measurement == nil {
+		if e.Status == "failed" {
+			return nil, fmt.Errorf("experiment %s failed: %s", e.ID, e.Error)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout:
+			return nil, fmt.Errorf("experiment %s isn't measured in %v", e.ID, c.measureTimeout)
+		case <-ticker.C():
+		}
+		if err := c.do(ctx, http.MethodGet, "/api/v1/experiments/"+url.PathEscape(e.ID), nil, &e); err != nil {
+			return nil, err
+		}
+	}
+	return e.Measurement, nil
+}
+
+// Reset makes the exporter forget its startup records and measurements.
+func (c *Client) Reset(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/api/v1/reset", nil, nil)
+}
+
+func retryable(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// do sends the request with in as the JSON body, retrying it if it fails,
+// which must be safe for the request, and decodes the JSON response into out if it's not nil.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		err := c.send(ctx, method, path, body, out)
+		e, isStatus := err.(*Error)
+		if err == nil || attempt >= c.retries || (isStatus && !retryable(e.StatusCode)) || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.clock.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.addr+path, r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(bs, &msg) != nil || msg.Error == "" {
+			msg.Error = http.StatusText(resp.StatusCode)
+		}
+		return &Error{StatusCode: resp.StatusCode, Message: msg.Error}
+	}
+	if out == nil || len(bs) == 0 {
+		return nil
+	}
+	return json.Unmarshal(bs, out)
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/YLonely/startup-exporter/pkg/clock"
+)
+
+func TestRetriesIdempotentRequests(t *testing.T) {
+	var calls int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": []Deployment{{Name: "web"}}})
+	}))
+	defer svr.Close()
+	c := New(svr.URL, WithRetries(3, time.Millisecond))
+	deployments, err := c.ListDeployments(context.Background())
+	if err != nil || len(deployments) != 1 {
+		t.Fatalf("got %v, %v", deployments, err)
+	}
+	if calls != 2 {
+		t.Errorf("sent %d requests, want the one failing retried once", calls)
+	}
+}
+
+func TestMeasureDoesNotRetryScale(t *testing.T) {
+	var calls int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer svr.Close()
+	c := New(svr.URL, WithRetries(3, time.Millisecond))
+	if _, err := c.Measure(context.Background(), ScaleRequest{Namespace: "default", Deployment: "web", Replicas: 2}); err == nil {
+		t.Fatal("the scale succeeded")
+	}
+	if calls != 1 {
+		t.Errorf("sent the scale request %d times", calls)
+	}
+}
+
+func TestMeasureTimesOut(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Experiment{ID: "e1"})
+	}))
+	defer svr.Close()
+	fake := clock.NewFake(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := New(svr.URL, WithClock(fake), WithPollInterval(time.Second), WithMeasureTimeout(time.Minute))
+	errs := make(chan error, 1)
+	go func() {
+		_, err := c.Measure(context.Background(), ScaleRequest{Namespace: "default", Deployment: "web", Replicas: 2})
+		errs <- err
+	}()
+	for fake.Waiters() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(time.Minute)
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("measured an experiment which never completes")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Measure doesn't time out")
+	}
+}
+
+func TestMeasureReturnsFailure(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := Experiment{ID: "e1", Status: "running"}
+		if r.Method == http.MethodGet {
+			e.Status, e.Error = "failed", "the pods didn't start in 30m0s"
+		}
+		json.NewEncoder(w).Encode(e)
+	}))
+	defer svr.Close()
+	c := New(svr.URL, WithPollInterval(time.Millisecond))
+	if _, err := c.Measure(context.Background(), ScaleRequest{Namespace: "default", Deployment: "web", Replicas: 2}); err == nil {
+		t.Error("measured a failed experiment")
+	}
+}
@@ -0,0 +1,90 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeAdvance(t *testing.T) {
+	c := NewFake(epoch)
+	start := c.Now()
+	c.Advance(time.Minute)
+	if got := c.Since(start); got != time.Minute {
+		t.Errorf("Since = %v, want 1m", got)
+	}
+}
+
+func TestFakeAfter(t *testing.T) {
+	c := NewFake(epoch)
+	after := c.After(time.Second)
+	c.Advance(999 * time.Millisecond)
+	select {
+	case <-after:
+		t.Fatal("fired before it was due")
+	default:
+	}
+	c.Advance(time.Millisecond)
+	select {
+	case now := <-after:
+		if !now.Equal(epoch.Add(time.Second)) {
+			t.Errorf("fired at %v", now)
+		}
+	default:
+		t.Fatal("didn't fire when it was due")
+	}
+	if c.Waiters() != 0 {
+		t.Errorf("%d waiters left", c.Waiters())
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	c := NewFake(epoch)
+	ticker := c.NewTicker(2 * time.Second)
+	ticks := 0
+	for i := 0; i < 10; i++ {
+		c.Advance(time.Second)
+		select {
+		case <-ticker.C():
+			ticks++
+		default:
+		}
+	}
+	if ticks != 5 {
+		t.Errorf("ticked %d times in 10s, want 5", ticks)
+	}
+	// the ticks of a slow receiver are dropped
+	c.Advance(10 * time.Second)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Error("ticked more than once for a single advance")
+	default:
+	}
+	ticker.Stop()
+	c.Advance(time.Minute)
+	select {
+	case <-ticker.C():
+		t.Error("ticked after being stopped")
+	default:
+	}
+}
+
+func TestFakeSleep(t *testing.T) {
+	c := NewFake(epoch)
+	woke := make(chan struct{})
+	go func() {
+		c.Sleep(time.Second)
+		close(woke)
+	}()
+	for c.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Advance(time.Second)
+	select {
+	case <-woke:
+	case <-time.After(time.Second):
+		t.Fatal("sleep didn't return")
+	}
+}
@@ -0,0 +1,122 @@
+// Package shimhook is used by containerd shims to record the startup time of
+// containers in a way the collector of startup-exporter understands.
+//
+// The startup time of a container is stored in a file named "startup" in the
+// bundle dir of its task, e.g.
+// /run/containerd/io.containerd.runtime.v2.task/<namespace>/<id>/startup.
+// The file contains two lines, the first one is the time the container starts
+// to be created and the second one is the time the container process starts,
+// both are unix timestamps in milliseconds. An end time of 0 means the
+// container hasn't started yet.
+//
+// A shim which starts a container more than once stores one record per start
+// attempt in files named "startup.1", "startup.2" and so on, the plain
+// "startup" file is reported as attempt 0.
+//
+// Any line after the two timestamps in the form of key=value is extra
+// metadata of the container, it's carried along with the startup time and may
+// be exported as metric labels, so experimental instrumentation in a shim
+// doesn't need changes of startup-exporter.
+//
+// The collector may read the file at any time, so the file must never be
+// observed half-written. Writers create the content in a temporary file in the
+// same dir and rename it over the startup file, which is atomic on the same
+// filesystem. Collectors still treat a file with a missing or zero end time as
+// partial and re-read it a few times before giving up for the current scan,
+// so shims which write the file in place keep working.
+package shimhook
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// StartupFileName is the name of the file holding the startup time in a bundle.
+const StartupFileName = "startup"
+
+// ExtraSnapshot is the key of the extra telling whether the snapshot of the
+// image of the container existed before the container was created, its value
+// is SnapshotReused or SnapshotNew. The collector guesses it from the other
+// containers of the image on the node if a shim doesn't know.
+const (
+	ExtraSnapshot  = "snapshot"
+	SnapshotReused = "reused"
+	SnapshotNew    = "new"
+)
+
+// ExtraSandboxBootStart and ExtraSandboxBootEnd are the keys of the extras
+// holding when the shim of a VM-based runtime, e.g. Kata Containers or
+// Firecracker, started to boot the sandbox VM of the container and when the
+// VM was ready to create containers, both are unix timestamps in
+// milliseconds. The boot is reported as a phase of its own since it often
+// takes longer than starting the container.
+const (
+	ExtraSandboxBootStart = "sandbox_boot_start"
+	ExtraSandboxBootEnd   = "sandbox_boot_end"
+)
+
+// SandboxBootExtras returns the extras recording the boot of the sandbox VM,
+// to be passed to WriteStartupExtras.
+func SandboxBootExtras(start, end int64) map[string]string {
+	return map[string]string{
+		ExtraSandboxBootStart: strconv.FormatInt(start, 10),
+		ExtraSandboxBootEnd:   strconv.FormatInt(end, 10),
+	}
+}
+
+// AttemptFileName returns the name of the file holding the startup time of
+// a start attempt.
+func AttemptFileName(attempt int) string {
+	if attempt == 0 {
+		return StartupFileName
+	}
+	return StartupFileName + "." + strconv.Itoa(attempt)
+}
+
+// WriteStartup atomically writes the startup time of the container in bundle.
+func WriteStartup(bundle string, start, end int64) error {
+	return WriteStartupAttempt(bundle, 0, start, end)
+}
+
+// WriteStartupAttempt atomically writes the startup time of a start attempt
+// of the container in bundle.
+func WriteStartupAttempt(bundle string, attempt int, start, end int64) error {
+	return WriteStartupExtras(bundle, attempt, start, end, nil)
+}
+
+// WriteStartupExtras atomically writes the startup time of a start attempt of
+// the container in bundle along with extra metadata.
+func WriteStartupExtras(bundle string, attempt int, start, end int64, extras map[string]string) error {
+	f, err := ioutil.TempFile(bundle, "."+StartupFileName)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := fmt.Fprintf(f, "%d\n%d\n", start, end); err != nil {
+		f.Close()
+		return err
+	}
+	keys := make([]string, 0, len(extras))
+	for k := range extras {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, err := fmt.Fprintf(f, "%s=%s\n", k, extras[k]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(bundle, AttemptFileName(attempt)))
+}
@@ -0,0 +1,32 @@
+// Package startup has the interfaces the startup-exporter is built on, so
+// code embedding it can plug in its own collectors, sinks and stores, or the
+// fakes of package testing.
+package startup
+
+import (
+	"context"
+
+	"github.com/YLonely/startup-exporter/pkg/client"
+)
+
+// Collector finds the containers which have started on a node.
+type Collector interface {
+	Collect(ctx context.Context) ([]client.StartupInfo, error)
+}
+
+// Sink receives the startup info of containers, e.g. an exporter through a
+// client.Client.
+type Sink interface {
+	SubmitStartupInfo(ctx context.Context, info ...client.StartupInfo) error
+}
+
+// Store keeps the startup info of containers by their namespace and name, a
+// container put again replaces the one stored.
+type Store interface {
+	Put(ctx context.Context, info ...client.StartupInfo) error
+	Get(ctx context.Context, namespace, name string) (client.StartupInfo, bool, error)
+	List(ctx context.Context) ([]client.StartupInfo, error)
+	Delete(ctx context.Context, namespace, name string) error
+}
+
+var _ Sink = (*client.Client)(nil)
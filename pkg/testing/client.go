@@ -0,0 +1,121 @@
+// Package testing has fakes of the startup-exporter client and of the
+// collectors, sinks and stores of package startup, so code embedding them can
+// be tested without a cluster or containerd.
+package testing
+
+import (
+	"context"
+	"sync"
+
+	"github.com/YLonely/startup-exporter/pkg/client"
+	"github.com/YLonely/startup-exporter/pkg/clock"
+)
+
+// FakeClient is an in-memory client.Interface. Submitted startup info and
+// scale requests are recorded, deployments and measurements are returned
+// from what's set on it.
+type FakeClient struct {
+	mu sync.Mutex
+
+	// Deployments is returned by ListDeployments.
+	Deployments []client.Deployment
+	// Measurements maps namespace/deployment to the measurement returned by
+	// Measure, a missing one is answered with a 404 client.Error.
+	Measurements map[string]client.Measurement
+	// Err is returned by every call if set.
+	Err error
+	// Clock stamps the measurements without a time, it's the real clock if
+	// nil.
+	Clock clock.Clock
+
+	// Submitted is the startup info sent with SubmitStartupInfo.
+	Submitted []client.StartupInfo
+	// Requests are the scale requests sent with Measure.
+	Requests []client.ScaleRequest
+	// Resets counts the calls of Reset.
+	Resets int
+}
+
+var _ client.Interface = (*FakeClient)(nil)
+
+// NewFakeClient returns a fake client listing the deployments.
+func NewFakeClient(deployments ...client.Deployment) *FakeClient {
+	return &FakeClient{
+		Deployments:  deployments,
+		Measurements: map[string]client.Measurement{},
+	}
+}
+
+// SetMeasurement sets the measurement Measure returns for the deployment.
+func (f *FakeClient) SetMeasurement(m client.Measurement) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Measurements == nil {
+		f.Measurements = map[string]client.Measurement{}
+	}
+	f.Measurements[m.Namespace+"/"+m.Deployment] = m
+}
+
+// SubmitStartupInfo records the startup info.
+func (f *FakeClient) SubmitStartupInfo(ctx context.Context, info ...client.StartupInfo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	f.Submitted = append(f.Submitted, info...)
+	return nil
+}
+
+// ListDeployments returns a copy of Deployments.
+func (f *FakeClient) ListDeployments(ctx context.Context) ([]client.Deployment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return append([]client.Deployment(nil), f.Deployments...), nil
+}
+
+// Measure records the request and returns the measurement set for the
+// deployment, with Replicas and Tags taken from the request.
+func (f *FakeClient) Measure(ctx context.Context, req client.ScaleRequest) (*client.Measurement, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.Requests = append(f.Requests, req)
+	m, exists := f.Measurements[req.Namespace+"/"+req.Deployment]
+	if !exists {
+		return nil, &client.Error{StatusCode: 404, Message: "deployment not found"}
+	}
+	if m.Kind == "" {
+		m.Kind = "scale"
+	}
+	m.Replicas = req.Replicas
+	m.Tags = req.Tags
+	if m.Time.IsZero() {
+		c := f.Clock
+		if c == nil {
+			c = clock.Real{}
+		}
+		m.Time = c.Now()
+	}
+	return &m, nil
+}
+
+// Reset forgets the submitted startup info and counts the call.
+func (f *FakeClient) Reset(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	f.Submitted = nil
+	f.Resets++
+	return nil
+}
@@ -0,0 +1,146 @@
+package testing
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/YLonely/startup-exporter/pkg/client"
+	"github.com/YLonely/startup-exporter/pkg/startup"
+)
+
+// FakeCollector is a startup.Collector returning the containers set on it.
+type FakeCollector struct {
+	mu sync.Mutex
+
+	// Info is returned by every Collect.
+	Info []client.StartupInfo
+	// Err is returned by Collect if set.
+	Err error
+	// Calls counts the calls of Collect.
+	Calls int
+}
+
+var _ startup.Collector = (*FakeCollector)(nil)
+
+// NewFakeCollector returns a fake collector finding the containers.
+func NewFakeCollector(info ...client.StartupInfo) *FakeCollector {
+	return &FakeCollector{Info: info}
+}
+
+// Collect returns a copy of Info.
+func (f *FakeCollector) Collect(ctx context.Context) ([]client.StartupInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Calls++
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return append([]client.StartupInfo(nil), f.Info...), nil
+}
+
+// FakeSink is a startup.Sink recording the startup info submitted to it.
+type FakeSink struct {
+	mu sync.Mutex
+
+	// Err is returned by SubmitStartupInfo if set, nothing is recorded
+	// then.
+	Err error
+	// Submitted is the startup info sent with SubmitStartupInfo.
+	Submitted []client.StartupInfo
+}
+
+var _ startup.Sink = (*FakeSink)(nil)
+
+// SubmitStartupInfo records the startup info.
+func (f *FakeSink) SubmitStartupInfo(ctx context.Context, info ...client.StartupInfo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	f.Submitted = append(f.Submitted, info...)
+	return nil
+}
+
+// FakeStore is an in-memory startup.Store.
+type FakeStore struct {
+	mu   sync.Mutex
+	info map[string]client.StartupInfo
+
+	// Err is returned by every call if set.
+	Err error
+}
+
+var _ startup.Store = (*FakeStore)(nil)
+
+// NewFakeStore returns a fake store holding the containers.
+func NewFakeStore(info ...client.StartupInfo) *FakeStore {
+	f := &FakeStore{info: map[string]client.StartupInfo{}}
+	for _, i := range info {
+		f.info[i.Namespace+"/"+i.Name] = i
+	}
+	return f
+}
+
+// Put stores the containers, replacing the ones with the same namespace and
+// name.
+func (f *FakeStore) Put(ctx context.Context, info ...client.StartupInfo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	if f.info == nil {
+		f.info = map[string]client.StartupInfo{}
+	}
+	for _, i := range info {
+		f.info[i.Namespace+"/"+i.Name] = i
+	}
+	return nil
+}
+
+// Get returns the container if it's stored.
+func (f *FakeStore) Get(ctx context.Context, namespace, name string) (client.StartupInfo, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return client.StartupInfo{}, false, f.Err
+	}
+	i, exists := f.info[namespace+"/"+name]
+	return i, exists, nil
+}
+
+// List returns the stored containers sorted by namespace and name.
+func (f *FakeStore) List(ctx context.Context) ([]client.StartupInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	info := make([]client.StartupInfo, 0, len(f.info))
+	for _, i := range f.info {
+		info = append(info, i)
+	}
+	sort.Slice(info, func(a, b int) bool {
+		if info[a].Namespace != info[b].Namespace {
+			return info[a].Namespace < info[b].Namespace
+		}
+		return info[a].Name < info[b].Name
+	})
+	return info, nil
+}
+
+// Delete removes the container, deleting a missing one isn't an error.
+func (f *FakeStore) Delete(ctx context.Context, namespace, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	delete(f.info, namespace+"/"+name)
+	return nil
+}
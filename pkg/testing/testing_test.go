@@ -0,0 +1,90 @@
+package testing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/YLonely/startup-exporter/pkg/client"
+	"github.com/YLonely/startup-exporter/pkg/clock"
+	"github.com/YLonely/startup-exporter/pkg/startup"
+	fake "github.com/YLonely/startup-exporter/pkg/testing"
+)
+
+// forward is what code embedding the collector does, it stores what's
+// collected and sends what wasn't stored yet.
+func forward(ctx context.Context, c startup.Collector, store startup.Store, sink startup.Sink) error {
+	info, err := c.Collect(ctx)
+	if err != nil {
+		return err
+	}
+	var fresh []client.StartupInfo
+	for _, i := range info {
+		if _, exists, err := store.Get(ctx, i.Namespace, i.Name); err != nil {
+			return err
+		} else if !exists {
+			fresh = append(fresh, i)
+		}
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+	if err := sink.SubmitStartupInfo(ctx, fresh...); err != nil {
+		return err
+	}
+	return store.Put(ctx, fresh...)
+}
+
+func TestForwardWithFakes(t *testing.T) {
+	ctx := context.Background()
+	a := client.StartupInfo{Name: "a", Namespace: "k8s.io", Start: 1, End: 2}
+	b := client.StartupInfo{Name: "b", Namespace: "k8s.io", Start: 1, End: 3}
+	collector := fake.NewFakeCollector(a)
+	store := fake.NewFakeStore()
+	sink := &fake.FakeSink{}
+	if err := forward(ctx, collector, store, sink); err != nil {
+		t.Fatal(err)
+	}
+	collector.Info = append(collector.Info, b)
+	if err := forward(ctx, collector, store, sink); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.Submitted) != 2 || sink.Submitted[0].Name != "a" || sink.Submitted[1].Name != "b" {
+		t.Errorf("submitted %+v, want a then b once", sink.Submitted)
+	}
+	stored, _ := store.List(ctx)
+	if len(stored) != 2 {
+		t.Errorf("stored %d containers, want 2", len(stored))
+	}
+
+	// a failing sink leaves the containers to be sent again
+	sink.Err = errors.New("unavailable")
+	if err := store.Delete(ctx, "k8s.io", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := forward(ctx, collector, store, sink); err == nil {
+		t.Error("the failure of the sink wasn't returned")
+	}
+	if _, exists, _ := store.Get(ctx, "k8s.io", "b"); exists {
+		t.Error("stored a container the sink failed to receive")
+	}
+}
+
+func TestFakeClientMeasure(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := fake.NewFakeClient()
+	c.Clock = clock.NewFake(now)
+	c.SetMeasurement(client.Measurement{Namespace: "default", Deployment: "web", LatencyMs: 1200})
+	m, err := c.Measure(context.Background(), client.ScaleRequest{Namespace: "default", Deployment: "web", Replicas: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Replicas != 3 || m.LatencyMs != 1200 || !m.Time.Equal(now) {
+		t.Errorf("measured %+v", m)
+	}
+	_, err = c.Measure(context.Background(), client.ScaleRequest{Namespace: "default", Deployment: "missing"})
+	if e, ok := err.(*client.Error); !ok || e.StatusCode != 404 {
+		t.Errorf("measured a missing deployment with %v", err)
+	}
+}
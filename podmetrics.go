@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var (
+	// podMetrics enables the startup latency of every pod, a series per pod
+	// may be too many for large clusters
+	podMetrics bool
+
+	podStartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemPod,
+			Name:      "startup_latency_milliseconds",
+		},
+		[]string{
+			"pod",
+			"namespace",
+			"cluster",
+			"node",
+			"runtime_class",
+		},
+	)
+)
+
+// exportPodLatency sets the startup latency of the pods whose containers have
+// all been received, from the first of them being created to the last of
+// them starting, sidecars are left out. The node is the one the pod is
+// scheduled to, or the one the collector reported if it's not set.
+func exportPodLatency(clusters []*cluster) {
+	for _, c := range clusters {
+		pods, err := c.podLister.List(labels.Everything())
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to list pods in the cluster %s", c.name)
+			continue
+		}
+		for _, p := range pods {
+			if p == nil {
+				continue
+			}
+			records, ok := podStartupRecords(p)
+			if !ok {
+				continue
+			}
+			var start, end int64
+			node := p.Spec.NodeName
+			for _, r := range records {
+				if node == "" {
+					node = r.Node
+				}
+				if start == 0 || r.Start < start {
+					start = r.Start
+				}
+				if r.End > end {
+					end = r.End
+				}
+			}
+			podStartupLatency.WithLabelValues(p.Name, p.Namespace, c.name, node, runtimeClass(p.Spec)).Set(startupRecord{Start: start, End: end}.milliseconds())
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// scaleHistoryLength is the number of the last scale events of a deployment
+// the prediction is based on.
+const scaleHistoryLength = 50
+
+var (
+	deployPredictedScaleLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "predicted_scale_latency_milliseconds",
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+			"pods",
+		},
+	)
+	// predictedSteps are the numbers of pods added by a scale-up the latency
+	// is predicted for, no prediction is exported if it's empty
+	predictedSteps []int
+)
+
+// scaleSample is the latency of a completed scale event.
+type scaleSample struct {
+	pods    int
+	latency float64
+}
+
+// predict fits a line through the latency of the past scale events by the
+// number of pods they added, and returns the latency of adding the pods. If
+// all the events added the same number of pods their average is returned.
+func predict(history []scaleSample, pods int) (float64, bool) {
+	if len(history) == 0 {
+		return 0, false
+	}
+	n := float64(len(history))
+	var sumX, sumY, sumXX, sumXY float64
+	for _, s := range history {
+		x := float64(s.pods)
+		sumX += x
+		sumY += s.latency
+		sumXX += x * x
+		sumXY += x * s.latency
+	}
+	slope := 0.0
+	if d := n*sumXX - sumX*sumX; d != 0 {
+		slope = (n*sumXY - sumX*sumY) / d
+	}
+	intercept := (sumY - slope*sumX) / n
+	latency := intercept + slope*float64(pods)
+	if latency < 0 {
+		latency = 0
+	}
+	return latency, true
+}
+
+// exportPredictions sets the predicted scale latency of the deployment, it's
+// called with the scale tracker locked.
+func exportPredictions(k deployKey, history []scaleSample) {
+	for _, pods := range predictedSteps {
+		if latency, ok := predict(history, pods); ok {
+			deployPredictedScaleLatency.WithLabelValues(k.name, k.namespace, k.cluster, strconv.Itoa(pods)).Set(latency)
+		}
+	}
+}
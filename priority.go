@@ -0,0 +1,252 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+const (
+	// benchmarkAnnotation marks a deployment as a benchmark target, which
+	// is aggregated before the others.
+	benchmarkAnnotation = "startup-exporter.io/benchmark"
+	// markTTL is how long a deployment marked by the API is kept marked
+	// while it doesn't exist, so it can be marked before it's created
+	markTTL = time.Hour
+)
+
+var (
+	priorities = priorityState{
+		marked: map[deployKey]time.Time{},
+	}
+
+	// deployGauges are the gauges an update sets for a deployment, they're
+	// reset before every update
+	deployGauges = []*prometheus.GaugeVec{
+		deployPodsAvgStartupLatency,
+		deploySidecarsAvgStartupLatency,
+		deployContainersAvgStartupLatency,
+		deployTypesAvgStartupLatency,
+		deployStuckContainers,
+		deploySkipped,
+		deployExcludedPods,
+		deployDegradedNodePods,
+		deployPrestartLatency,
+		deployAdmissionToStartLatency,
+		deployStartupProbeLatency,
+		deployLabels,
+		deployStrategyInfo,
+		deployRevisionLatencyDelta,
+		deployRevisionLatencyRatio,
+	}
+
+	deployDeferred = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "deferred",
+		},
+	)
+)
+
+// priorityState orders the deployments aggregated in an update, benchmark
+// targets go first. If the update runs over its budget, e.g. during a pod
+// storm, the deployments left are deferred to the next update, which starts
+// from them, and their gauges are set again to the values before the update.
+type priorityState struct {
+	sync.Mutex
+	// budget is how long the deployments of an update may take, 0 means
+	// no limit
+	budget time.Duration
+	// marked holds the deployments marked as benchmark targets by the API
+	// and when they were last seen
+	marked map[deployKey]time.Time
+	// gauges set the gauges of every deployment to the values before the
+	// update
+	gauges map[deployKey][]func()
+	// next is the index of the first deployment deferred by the last
+	// update among the ones which aren't benchmark targets
+	next int
+}
+
+// isTarget reports whether the deployment is a benchmark target.
+func (s *priorityState) isTarget(k deployKey, d *appsv1.Deployment) bool {
+	if d.Annotations[benchmarkAnnotation] == "true" {
+		return true
+	}
+	s.Lock()
+	defer s.Unlock()
+	_, marked := s.marked[k]
+	return marked
+}
+
+// prioritizedDeployment is a deployment to aggregate in an update.
+type prioritizedDeployment struct {
+	c *cluster
+	d *appsv1.Deployment
+}
+
+// update aggregates the deployments, the benchmark targets first and the
+// others starting from the first one deferred by the last update.
+func (s *priorityState) update(deployments map[*cluster][]*appsv1.Deployment) {
+	began := clk.Now()
+	var targets, others []prioritizedDeployment
+	for c, ds := range deployments {
+		for _, d := range ds {
+			if s.isTarget(deployKey{cluster: c.name, meta: meta{name: d.Name, namespace: d.Namespace}}, d) {
+				targets = append(targets, prioritizedDeployment{c: c, d: d})
+			} else {
+				others = append(others, prioritizedDeployment{c: c, d: d})
+			}
+		}
+	}
+	for _, t := range targets {
+		t.c.updateDeployment(t.d)
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].c.name+"/"+others[i].d.Namespace+"/"+others[i].d.Name < others[j].c.name+"/"+others[j].d.Namespace+"/"+others[j].d.Name
+	})
+	s.Lock()
+	next := s.next
+	s.Unlock()
+	if next >= len(others) {
+		next = 0
+	}
+	deferred := 0
+	for i := range others {
+		o := others[(next+i)%len(others)]
+		if s.budget > 0 && clk.Since(began) > s.budget {
+			if deferred == 0 {
+				s.Lock()
+				s.next = (next + i) % len(others)
+				s.Unlock()
+			}
+			deferred++
+			s.republish(deployKey{cluster: o.c.name, meta: meta{name: o.d.Name, namespace: o.d.Namespace}})
+			continue
+		}
+		o.c.updateDeployment(o.d)
+	}
+	if deferred == 0 {
+		s.Lock()
+		s.next = 0
+		s.Unlock()
+	}
+	deployDeferred.Set(float64(deferred))
+}
+
+// snapshot keeps the values of the gauges of the deployments before they're
+// reset for an update, so the deferred ones can be set again. It does nothing
+// without a budget, as nothing is deferred.
+func (s *priorityState) snapshot() {
+	if s.budget <= 0 {
+		return
+	}
+	gauges := map[deployKey][]func(){}
+	for _, vec := range deployGauges {
+		vec := vec
+		ch := make(chan prometheus.Metric)
+		go func() {
+			vec.Collect(ch)
+			close(ch)
+		}()
+		for m := range ch {
+			var pb dto.Metric
+			if err := m.Write(&pb); err != nil {
+				continue
+			}
+			labels := prometheus.Labels{}
+			for _, l := range pb.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			k := deployKey{cluster: labels["cluster"], meta: meta{name: labels["deploy_name"], namespace: labels["namespace"]}}
+			v := pb.GetGauge().GetValue()
+			gauges[k] = append(gauges[k], func() {
+				vec.With(labels).Set(v)
+			})
+		}
+	}
+	s.Lock()
+	s.gauges = gauges
+	s.Unlock()
+}
+
+// republish sets the gauges of the deferred deployment to the values before
+// the update.
+func (s *priorityState) republish(k deployKey) {
+	s.Lock()
+	set := s.gauges[k]
+	s.Unlock()
+	for _, f := range set {
+		f()
+	}
+}
+
+// handlePriorities lists the deployments marked as benchmark targets with
+// GET on /api/v1/priorities, and marks or unmarks one with PUT or DELETE on
+// /api/v1/priorities/NAMESPACE/NAME, the cluster parameter chooses the
+// cluster. A deployment may be marked before it's created.
+func handlePriorities(w http.ResponseWriter, r *http.Request) {
+	p := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/priorities"), "/")
+	if p == "" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "only GET is allowed")
+			return
+		}
+		priorities.Lock()
+		var items []listItem
+		for k := range priorities.marked {
+			items = append(items, listItem{value: deploymentRef{Cluster: k.cluster, Namespace: k.namespace, Name: k.name}, name: k.cluster + "/" + k.namespace + "/" + k.name})
+		}
+		priorities.Unlock()
+		writeList(w, r, items)
+		return
+	}
+	parts := strings.Split(p, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		writeError(w, http.StatusNotFound, "unknown route")
+		return
+	}
+	k := deployKey{cluster: r.URL.Query().Get("cluster"), meta: meta{namespace: parts[0], name: parts[1]}}
+	priorities.Lock()
+	defer priorities.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		priorities.marked[k] = clk.Now()
+	case http.MethodDelete:
+		delete(priorities.marked, k)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "only PUT and DELETE are allowed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deploymentRef refers to a deployment in the API.
+type deploymentRef struct {
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// prune forgets the marks of the deployments which haven't existed for
+// markTTL.
+func (s *priorityState) prune(existing map[deployKey]struct{}) {
+	s.Lock()
+	defer s.Unlock()
+	now := clk.Now()
+	for k, seen := range s.marked {
+		if _, exists := existing[k]; exists {
+			s.marked[k] = now
+		} else if now.Sub(seen) > markTTL {
+			delete(s.marked, k)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMarkBeforeDeploymentExists(t *testing.T) {
+	c := fakeClock(t)
+	s := priorityState{marked: map[deployKey]time.Time{}}
+	k := deployKey{meta: meta{name: "web", namespace: "bench"}}
+	s.marked[k] = c.Now()
+	c.Advance(markTTL / 2)
+	s.prune(map[deployKey]struct{}{})
+	if _, marked := s.marked[k]; !marked {
+		t.Fatal("the mark of a deployment not created yet is dropped")
+	}
+	s.prune(map[deployKey]struct{}{k: {}})
+	c.Advance(markTTL / 2)
+	s.prune(map[deployKey]struct{}{})
+	if _, marked := s.marked[k]; !marked {
+		t.Fatal("the mark is dropped before the deployment is gone for the TTL")
+	}
+	c.Advance(markTTL)
+	s.prune(map[deployKey]struct{}{})
+	if _, marked := s.marked[k]; marked {
+		t.Error("the mark of a deployment gone for the TTL is kept")
+	}
+}
+
+func TestRepublishDeferredGauges(t *testing.T) {
+	defer deployStuckContainers.Reset()
+	defer deployLabels.Reset()
+	s := priorityState{budget: time.Second}
+	k := deployKey{cluster: "c1", meta: meta{name: "web", namespace: "bench"}}
+	deployStuckContainers.WithLabelValues(k.name, k.namespace, k.cluster, "ImagePullBackOff").Set(2)
+	deployLabels.WithLabelValues(k.name, k.namespace, k.cluster, k.name, "uid", "", "").Set(1)
+	s.snapshot()
+	deployStuckContainers.Reset()
+	deployLabels.Reset()
+	s.republish(k)
+	if v := testutil.ToFloat64(deployStuckContainers.WithLabelValues(k.name, k.namespace, k.cluster, "ImagePullBackOff")); v != 2 {
+		t.Errorf("stuck containers are %v after republishing, want 2", v)
+	}
+	if n := testutil.CollectAndCount(deployLabels); n != 1 {
+		t.Errorf("got %d label series after republishing, want 1", n)
+	}
+}
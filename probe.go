@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var deployStartupProbeLatency = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystemDeploy,
+		Name:      "startup_probe_latency_milliseconds",
+	},
+	[]string{
+		"deploy_name",
+		"namespace",
+		"cluster",
+		"probe",
+	},
+)
+
+// probeType returns how the probe checks the container.
+func probeType(p *corev1.Probe) string {
+	switch {
+	case p.Exec != nil:
+		return "exec"
+	case p.HTTPGet != nil:
+		return "http"
+	case p.TCPSocket != nil:
+		return "tcp"
+	default:
+		return "unknown"
+	}
+}
+
+// exportStartupProbeLatency sets the average time the containers with a
+// startup probe spend from their process starting to the pod becoming ready,
+// by the type of the probe. The kubelet doesn't record when a single
+// container becomes ready, so the ready time is the one of the containers of
+// the pod, which is in seconds.
+func exportStartupProbeLatency(c *cluster, d *appsv1.Deployment, pods []*corev1.Pod) {
+	var (
+		total = map[string]float64{}
+		count = map[string]int{}
+	)
+	for _, p := range pods {
+		var ready *corev1.PodCondition
+		for i, cond := range p.Status.Conditions {
+			if cond.Type == corev1.ContainersReady && cond.Status == corev1.ConditionTrue {
+				ready = &p.Status.Conditions[i]
+			}
+		}
+		if ready == nil {
+			continue
+		}
+		probes := map[string]string{}
+		for _, container := range p.Spec.Containers {
+			if container.StartupProbe != nil {
+				probes[container.Name] = probeType(container.StartupProbe)
+			}
+		}
+		if len(probes) == 0 {
+			continue
+		}
+		mu.Lock()
+		for _, status := range p.Status.ContainerStatuses {
+			probe, exists := probes[status.Name]
+			if !exists || !strings.HasPrefix(status.ContainerID, containerNamePrefix) {
+				continue
+			}
+			name := strings.TrimPrefix(status.ContainerID, containerNamePrefix)
+			info, exists := podContainer(name)
+			if !exists {
+				continue
+			}
+			latency := float64(ready.LastTransitionTime.UnixNano()-info.End) / 1e6
+			if latency < 0 {
+				// the pod became ready before the container restarted
+				continue
+			}
+			total[probe] += latency
+			count[probe]++
+		}
+		mu.Unlock()
+	}
+	for probe, n := range count {
+		deployStartupProbeLatency.WithLabelValues(d.Name, d.Namespace, c.name, probe).Set(total[probe] / float64(n))
+	}
+}
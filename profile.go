@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"runtime/trace"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	profileTypeCPU   = "cpu"
+	profileTypeTrace = "trace"
+
+	// profileCooldown is the min interval between two captures, so a
+	// cluster which is always slow doesn't fill the disk
+	profileCooldown = 10 * time.Minute
+)
+
+var slowUpdateLoops = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "slow_update_loops_total",
+	},
+)
+
+// loopProfiler captures a CPU profile or an execution trace of the update
+// loop after an iteration is slower than the threshold. The iteration after
+// the slow one is captured, since a profile can't be taken in hindsight.
+type loopProfiler struct {
+	threshold time.Duration
+	dir       string
+	kind      string
+
+	armed    bool
+	file     *os.File
+	captured time.Time
+}
+
+var profiler loopProfiler
+
+// begin starts a capture if the last iteration was slow.
+func (p *loopProfiler) begin() {
+	if !p.armed {
+		return
+	}
+	p.armed = false
+	name := filepath.Join(p.dir, fmt.Sprintf("update-loop-%s-%d.out", p.kind, clk.Now().Unix()))
+	f, err := os.Create(name)
+	if err != nil {
+		logrus.WithError(err).Error("failed to create the profile")
+		return
+	}
+	if p.kind == profileTypeTrace {
+		err = trace.Start(f)
+	} else {
+		err = pprof.StartCPUProfile(f)
+	}
+	if err != nil {
+		f.Close()
+		logrus.WithError(err).Error("failed to start profiling")
+		return
+	}
+	p.file = f
+	p.captured = clk.Now()
+}
+
+// end stops the running capture and arms one if the iteration took longer
+// than the threshold.
+func (p *loopProfiler) end(elapsed time.Duration) {
+	if p.file != nil {
+		if p.kind == profileTypeTrace {
+			trace.Stop()
+		} else {
+			pprof.StopCPUProfile()
+		}
+		logrus.Infof("captured the %s profile of the update loop to %s", p.kind, p.file.Name())
+		p.file.Close()
+		p.file = nil
+	}
+	if p.threshold <= 0 || elapsed <= p.threshold {
+		return
+	}
+	slowUpdateLoops.Inc()
+	logrus.Warnf("update loop took %v which exceeds %v", elapsed, p.threshold)
+	if p.dir != "" && clk.Since(p.captured) > profileCooldown {
+		p.armed = true
+	}
+}
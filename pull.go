@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// collectorRecordsPath is where a collector serves the containers of its
+	// last scan to be pulled by the exporter
+	collectorRecordsPath = "/records"
+	// collectorPortName is the port of the collector service the exporter
+	// pulls from, the first port is used if no port has the name
+	collectorPortName   = "http"
+	defaultPullInterval = 5 * time.Second
+	// collectorTokenEnv is the environment variable of the token the
+	// collectors serve their containers with
+	collectorTokenEnv = "STARTUP_COLLECTOR_TOKEN"
+)
+
+// scanned holds the containers of the last scan of the collector.
+var scanned = struct {
+	sync.Mutex
+	info []containerStartupInfo
+}{}
+
+func setScanned(info []containerStartupInfo) {
+	scanned.Lock()
+	defer scanned.Unlock()
+	scanned.info = info
+}
+
+// scannedToken is the bearer token the exporter pulls the containers of the
+// last scan with.
+var scannedToken string
+
+// serveScanned serves the containers of the last scan as an array in the
+// format collectors push.
+func serveScanned(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(scannedToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+	scanned.Lock()
+	info := scanned.info
+	scanned.Unlock()
+	logrus.WithField("request_id", r.Header.Get(requestIDHeader)).Debugf("serving %d containers", len(info))
+	if info == nil {
+		info = []containerStartupInfo{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(versionHeader, version)
+	w.Header().Set(nodeHeader, nodeName)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		logrus.WithError(err).Error("failed to serve the scanned containers")
+	}
+}
+
+// collectorPuller pulls the containers from the collectors behind a headless
+// service, the collectors are discovered from the endpoints of the service,
+// so collectors added or removed with the nodes are followed. Endpoints are
+// served by every Kubernetes version, unlike the beta endpoint slices.
+type collectorPuller struct {
+	service  meta
+	interval time.Duration
+	client   *http.Client
+	token    string
+	lister   corelisters.EndpointsLister
+}
+
+// parseService parses a service in the form of NAMESPACE/NAME.
+func parseService(s string) (meta, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return meta{}, errors.Errorf("service %q is not in the form of NAMESPACE/NAME", s)
+	}
+	return meta{namespace: parts[0], name: parts[1]}, nil
+}
+
+// watchCollectors makes the cluster watch the endpoints of the service, it's
+// called before the informers start.
+func watchCollectors(c *cluster, service meta, interval time.Duration, token string) *collectorPuller {
+	return &collectorPuller{
+		service:  service,
+		interval: interval,
+		client:   &http.Client{Timeout: interval},
+		token:    token,
+		lister:   c.factory.Core().V1().Endpoints().Lister(),
+	}
+}
+
+// collectorEndpoint is a collector to pull from.
+type collectorEndpoint struct {
+	addr string
+	node string
+}
+
+// endpoints returns the ready collectors behind the service.
+func (p *collectorPuller) endpoints() ([]collectorEndpoint, error) {
+	eps, err := p.lister.Endpoints(p.service.namespace).Get(p.service.name)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var endpoints []collectorEndpoint
+	for _, s := range eps.Subsets {
+		port := int32(-1)
+		for i, sp := range s.Ports {
+			if i == 0 || sp.Name == collectorPortName {
+				port = sp.Port
+			}
+		}
+		if port < 0 {
+			continue
+		}
+		// the addresses which aren't ready are in NotReadyAddresses
+		for _, a := range s.Addresses {
+			ep := collectorEndpoint{addr: net.JoinHostPort(a.IP, strconv.Itoa(int(port)))}
+			if a.NodeName != nil {
+				ep.node = *a.NodeName
+			}
+			endpoints = append(endpoints, ep)
+		}
+	}
+	return endpoints, nil
+}
+
+// pull ingests the containers of a collector.
+func (p *collectorPuller) pull(e collectorEndpoint) error {
+	req, err := http.NewRequest(http.MethodGet, "http://"+e.addr+collectorRecordsPath, nil)
+	if err != nil {
+		return err
+	}
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	id := newID()
+	req.Header.Set(requestIDHeader, id)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "request %s failed", id)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("received status %s from the collector", resp.Status)
+	}
+	records, rejected, err := decodeStartupRecords(resp.Body)
+	if err != nil {
+		return err
+	}
+	if rejected > 0 {
+		logrus.WithField("request_id", id).Warnf("rejected %d invalid records from %s", rejected, e.addr)
+	}
+	node := resp.Header.Get(nodeHeader)
+	if node == "" {
+		node = e.node
+	}
+	logrus.WithField("request_id", id).Debugf("pulled %d records from %s", len(records), e.addr)
+	for _, info := range records {
+		if node != "" {
+			info.Node = node
+		}
+		info.RequestID = id
+		ingest(info)
+	}
+	return nil
+}
+
+// run pulls from the collectors every interval until done is closed.
+func (p *collectorPuller) run(done <-chan struct{}) {
+	ticker := clk.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		endpoints, err := p.endpoints()
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to list the endpoints of %s(%s)", p.service.name, p.service.namespace)
+		}
+		var wg sync.WaitGroup
+		for _, e := range endpoints {
+			wg.Add(1)
+			go func(e collectorEndpoint) {
+				defer wg.Done()
+				if err := p.pull(e); err != nil {
+					logrus.WithError(err).Errorf("failed to pull from the collector %s", e.addr)
+				}
+			}(e)
+		}
+		wg.Wait()
+		select {
+		case <-done:
+			return
+		case <-ticker.C():
+		}
+	}
+}
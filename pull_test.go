@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestCollectorEndpoints(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	node := "node-a"
+	indexer.Add(&corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "startup-collector", Namespace: "kube-system"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses:         []corev1.EndpointAddress{{IP: "10.0.0.1", NodeName: &node}},
+			NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.2"}},
+			Ports:             []corev1.EndpointPort{{Name: "metrics", Port: 9000}, {Name: collectorPortName, Port: 9091}},
+		}},
+	})
+	p := &collectorPuller{service: meta{name: "startup-collector", namespace: "kube-system"}, lister: corelisters.NewEndpointsLister(indexer)}
+	endpoints, err := p.endpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].addr != "10.0.0.1:9091" || endpoints[0].node != node {
+		t.Errorf("found %+v, want the ready collector on the http port", endpoints)
+	}
+	p.service.name = "missing"
+	if endpoints, err := p.endpoints(); err != nil || len(endpoints) != 0 {
+		t.Errorf("found %+v, %v for a missing service", endpoints, err)
+	}
+}
+
+func TestServeScannedNeedsToken(t *testing.T) {
+	defer func(token string) { scannedToken = token }(scannedToken)
+	scannedToken = "s3cr3t"
+	for token, code := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "s3cr3t": http.StatusOK} {
+		r := httptest.NewRequest(http.MethodGet, collectorRecordsPath, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		serveScanned(w, r)
+		if w.Code != code {
+			t.Errorf("token %q got %d, want %d", token, w.Code, code)
+		}
+	}
+}
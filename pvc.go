@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const prestartComponentPVCBinding = "pvc-binding"
+
+var deployPrestartLatency = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystemDeploy,
+		Name:      "prestart_latency_milliseconds",
+	},
+	[]string{
+		"deploy_name",
+		"namespace",
+		"cluster",
+		"component",
+	},
+)
+
+// pvcTracker measures how long persistent volume claims take from being
+// created to being bound, dynamic provisioning often takes longer than
+// starting the containers of the first pod using the volume.
+type pvcTracker struct {
+	sync.Mutex
+	pvcLister corelisters.PersistentVolumeClaimLister
+	// latency holds the binding latency of the claims seen being bound
+	latency map[types.UID]float64
+}
+
+// newPVCTracker registers the event handlers which notice claims being bound
+// on the informers.
+func newPVCTracker(factory informers.SharedInformerFactory) *pvcTracker {
+	t := &pvcTracker{
+		pvcLister: factory.Core().V1().PersistentVolumeClaims().Lister(),
+		latency:   map[types.UID]float64{},
+	}
+	factory.Core().V1().PersistentVolumeClaims().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, obj interface{}) {
+			oldPVC, ok1 := old.(*corev1.PersistentVolumeClaim)
+			newPVC, ok2 := obj.(*corev1.PersistentVolumeClaim)
+			// claims bound before the exporter started can't be measured
+			if ok1 && ok2 && oldPVC.Status.Phase != corev1.ClaimBound && newPVC.Status.Phase == corev1.ClaimBound {
+				t.Lock()
+				t.latency[newPVC.UID] = float64(clk.Since(newPVC.CreationTimestamp.Time).Milliseconds())
+				t.Unlock()
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pvc, ok := obj.(*corev1.PersistentVolumeClaim); ok {
+				t.Lock()
+				delete(t.latency, pvc.UID)
+				t.Unlock()
+			}
+		},
+	})
+	return t
+}
+
+// export sets the average binding latency of the claims the pods of the
+// deployment use.
+func (t *pvcTracker) export(c *cluster, d *appsv1.Deployment, pods []*corev1.Pod) {
+	var (
+		total float64
+		n     int
+		seen  = map[types.UID]struct{}{}
+	)
+	t.Lock()
+	defer t.Unlock()
+	for _, p := range pods {
+		for _, v := range p.Spec.Volumes {
+			if v.PersistentVolumeClaim == nil {
+				continue
+			}
+			pvc, err := t.pvcLister.PersistentVolumeClaims(p.Namespace).Get(v.PersistentVolumeClaim.ClaimName)
+			if err != nil {
+				continue
+			}
+			if _, exists := seen[pvc.UID]; exists {
+				continue
+			}
+			seen[pvc.UID] = struct{}{}
+			if latency, measured := t.latency[pvc.UID]; measured {
+				total += latency
+				n++
+			}
+		}
+	}
+	if n > 0 {
+		deployPrestartLatency.WithLabelValues(d.Name, d.Namespace, c.name, prestartComponentPVCBinding).Set(total / float64(n))
+	}
+}
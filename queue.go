@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	queueRecords = "records"
+	queuePending = "pending"
+	queueStream  = "stream"
+	queueMirror  = "mirror"
+)
+
+// queueLength is the size of the state the exporter holds on to, which
+// should stay bounded however long it runs.
+var queueLength = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "queue_length",
+	},
+	[]string{
+		"queue",
+	},
+)
+
+// exportQueueLengths sets the number of startup records held, the
+// deployments waiting for startup records and the events buffered for the
+// subscribers of the stream.
+func exportQueueLengths() {
+	mu.Lock()
+	records := allInfo.len()
+	mu.Unlock()
+	queueLength.WithLabelValues(queueRecords).Set(float64(records))
+	queueLength.WithLabelValues(queuePending).Set(float64(drain.status().Pending))
+	queueLength.WithLabelValues(queueMirror).Set(float64(mirror.len()))
+	stream.Lock()
+	buffered := 0
+	for ch := range stream.subscribers {
+		buffered += len(ch)
+	}
+	stream.Unlock()
+	queueLength.WithLabelValues(queueStream).Set(float64(buffered))
+}
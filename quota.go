@@ -0,0 +1,105 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	quotaReasonRate      = "rate"
+	quotaReasonRetention = "retention"
+)
+
+var quotaRejectedRecords = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "quota_rejected_records_total",
+	},
+	[]string{
+		"namespace",
+		"reason",
+	},
+)
+
+// namespaceQuota bounds the records of every namespace the exporter accepts
+// and retains, so a namespace churning lots of containers can't take over
+// the memory of the exporter. A record counts against the namespace of its
+// pod, or its containerd namespace if it has no pod, as every pod shares the
+// containerd namespace k8s.io. It's guarded by mu.
+type namespaceQuota struct {
+	// rate is the max number of records of a namespace accepted per minute,
+	// 0 means no limit
+	rate int
+	// retain is the max number of containers of a namespace retained, 0
+	// means no limit
+	retain   int
+	window   time.Time
+	accepted map[string]int
+	retained map[string]int
+	// owners holds the namespace every retained container counts against
+	owners map[meta]string
+}
+
+var quotas = namespaceQuota{
+	accepted: map[string]int{},
+	retained: map[string]int{},
+	owners:   map[meta]string{},
+}
+
+// quotaNamespace returns the namespace the record counts against.
+func quotaNamespace(r startupRecord) string {
+	if r.PodNamespace != "" {
+		return r.PodNamespace
+	}
+	return r.Namespace
+}
+
+// admit reports whether a record of the container m is accepted, isNew is
+// true if the container isn't retained yet.
+func (q *namespaceQuota) admit(m meta, r startupRecord, isNew bool) bool {
+	namespace := quotaNamespace(r)
+	now := clk.Now()
+	if now.Sub(q.window) >= time.Minute {
+		q.window = now
+		q.accepted = map[string]int{}
+	}
+	if q.rate > 0 && q.accepted[namespace] >= q.rate {
+		quotaRejectedRecords.WithLabelValues(namespace, quotaReasonRate).Inc()
+		return false
+	}
+	if isNew && q.retain > 0 && q.retained[namespace] >= q.retain {
+		quotaRejectedRecords.WithLabelValues(namespace, quotaReasonRetention).Inc()
+		return false
+	}
+	q.accepted[namespace]++
+	if isNew {
+		q.hold(m, namespace)
+	}
+	return true
+}
+
+// hold retains the container m against the namespace.
+func (q *namespaceQuota) hold(m meta, namespace string) {
+	q.owners[m] = namespace
+	q.retained[namespace]++
+}
+
+// release gives back the retention of a removed container.
+func (q *namespaceQuota) release(m meta) {
+	namespace, held := q.owners[m]
+	if !held {
+		return
+	}
+	delete(q.owners, m)
+	if q.retained[namespace] > 0 {
+		q.retained[namespace]--
+	}
+}
+
+// reset forgets the retained containers.
+func (q *namespaceQuota) reset() {
+	q.retained = map[string]int{}
+	q.owners = map[meta]string{}
+}
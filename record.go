@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YLonely/startup-exporter/pkg/client"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+// startupRecord is the normalized startup info of a container the exporter
+// aggregates. Timestamps are always unix nanoseconds, whatever the collector
+// sent.
+type startupRecord struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+	Attempt   int    `json:"attempt"`
+	// Start and End are unix timestamps in nanoseconds
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	// Received is when the exporter received the record
+	Received time.Time `json:"received"`
+	// Extras is metadata provided by the shim
+	Extras map[string]string `json:"extras,omitempty"`
+	// Node is the node the collector which sent the record runs on
+	Node string `json:"node,omitempty"`
+	// Pod and PodNamespace are the pod the collector found the container
+	// belongs to
+	Pod          string `json:"pod,omitempty"`
+	PodNamespace string `json:"podNamespace,omitempty"`
+	Image        string `json:"image,omitempty"`
+	// Snapshot tells whether the snapshot of the image existed before the
+	// container was created
+	Snapshot string `json:"snapshot,omitempty"`
+	// RequestID is the ID of the push or pull the record was received with
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// latency returns the startup latency of the container.
+func (r startupRecord) latency() time.Duration {
+	return time.Duration(r.End - r.Start)
+}
+
+// milliseconds returns the startup latency in milliseconds as metrics use.
+func (r startupRecord) milliseconds() float64 {
+	return float64(r.latency()) / float64(time.Millisecond)
+}
+
+// public returns the record as the client sends it, with timestamps in
+// nanoseconds.
+func (r startupRecord) public() client.StartupInfo {
+	if r.Name == "" {
+		return client.StartupInfo{}
+	}
+	return client.StartupInfo{
+		Name:         r.Name,
+		Namespace:    r.Namespace,
+		Start:        r.Start,
+		End:          r.End,
+		Type:         r.Type,
+		Attempt:      r.Attempt,
+		Unit:         unitNanosecond,
+		Extras:       r.Extras,
+		Pod:          r.Pod,
+		PodNamespace: r.PodNamespace,
+		Image:        r.Image,
+		Snapshot:     r.Snapshot,
+	}
+}
+
+// wireStartupInfo is containerStartupInfo as it's sent by any collector,
+// timestamps may be numbers in any unit or RFC 3339 strings.
+type wireStartupInfo struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Start     json.RawMessage   `json:"start"`
+	End       json.RawMessage   `json:"end"`
+	Type      string            `json:"type"`
+	Attempt   int               `json:"attempt"`
+	Unit      string            `json:"unit"`
+	Extras    map[string]string `json:"extras"`
+	// Pod and PodNamespace are sent by collectors which read CRI
+	// annotations
+	Pod          string `json:"pod"`
+	PodNamespace string `json:"podNamespace"`
+	Image        string `json:"image"`
+	Snapshot     string `json:"snapshot"`
+	// Received and Node are set if the record is dumped by the exporter
+	Received  *time.Time `json:"received"`
+	Node      string     `json:"node"`
+	RequestID string     `json:"requestId"`
+}
+
+var rejectedRecords = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rejected_records_total",
+	},
+)
+
+// decodeStartupRecords decodes, validates and normalizes the startup info of
+// containers sent by a collector, either a single object or an array. The
+// invalid records of an array are skipped and counted, so they don't block
+// the valid ones from a collector which retries the whole batch, only a body
+// which isn't JSON at all fails.
+func decodeStartupRecords(r io.Reader) ([]startupRecord, int, error) {
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	var raws []json.RawMessage
+	if trimmed := bytes.TrimSpace(bs); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &raws); err != nil {
+			return nil, 0, err
+		}
+	} else {
+		if !json.Valid(trimmed) {
+			return nil, 0, errors.New("invalid JSON")
+		}
+		raws = append(raws, trimmed)
+	}
+	records := make([]startupRecord, 0, len(raws))
+	rejected := 0
+	for i, raw := range raws {
+		var info wireStartupInfo
+		err := json.Unmarshal(raw, &info)
+		var record startupRecord
+		if err == nil {
+			record, err = normalize(info)
+		}
+		if err != nil {
+			logrus.WithError(err).Debugf("rejected record %d of the batch", i)
+			rejected++
+			continue
+		}
+		records = append(records, record)
+	}
+	rejectedRecords.Add(float64(rejected))
+	return records, rejected, nil
+}
+
+func normalize(info wireStartupInfo) (startupRecord, error) {
+	if info.Name == "" || info.Namespace == "" {
+		return startupRecord{}, errors.New("name and namespace must be provided")
+	}
+	start, err := parseTimestamp(info.Start, info.Unit)
+	if err != nil {
+		return startupRecord{}, errors.Wrap(err, "invalid start time")
+	}
+	end, err := parseTimestamp(info.End, info.Unit)
+	if err != nil {
+		return startupRecord{}, errors.Wrap(err, "invalid end time")
+	}
+	if end < start {
+		return startupRecord{}, errors.Errorf("end time %d is before start time %d", end, start)
+	}
+	if info.Attempt < 0 {
+		return startupRecord{}, errors.Errorf("invalid attempt %d", info.Attempt)
+	}
+	t := info.Type
+	if t == "" {
+		t = typeDefault
+	}
+	received := clk.Now()
+	if info.Received != nil {
+		received = *info.Received
+	}
+	return startupRecord{
+		Name:         info.Name,
+		Namespace:    info.Namespace,
+		Type:         t,
+		Attempt:      info.Attempt,
+		Start:        start,
+		End:          end,
+		Received:     received,
+		Extras:       info.Extras,
+		Node:         info.Node,
+		Pod:          info.Pod,
+		PodNamespace: info.PodNamespace,
+		Image:        info.Image,
+		Snapshot:     info.Snapshot,
+		RequestID:    info.RequestID,
+	}, nil
+}
+
+// parseTimestamp converts a timestamp to unix nanoseconds. A number without a
+// unit is in the unit its magnitude suggests, which is right for any time
+// after 1973.
+func parseTimestamp(raw json.RawMessage, unit string) (int64, error) {
+	s := strings.TrimSpace(string(raw))
+	if s == "" || s == "null" {
+		return 0, errors.New("missing timestamp")
+	}
+	if strings.HasPrefix(s, `"`) {
+		var str string
+		if err := json.Unmarshal(raw, &str); err != nil {
+			return 0, err
+		}
+		if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+			return t.UnixNano(), nil
+		}
+		s = str
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if v <= 0 {
+		return 0, errors.Errorf("timestamp %d is not positive", v)
+	}
+	if unit == "" {
+		switch {
+		case v < 1e11:
+			unit = unitSecond
+		case v < 1e14:
+			unit = unitMillisecond
+		case v < 1e17:
+			unit = unitMicrosecond
+		default:
+			unit = unitNanosecond
+		}
+	}
+	var multiplier int64
+	switch unit {
+	case unitSecond:
+		multiplier = int64(time.Second)
+	case unitMillisecond:
+		multiplier = int64(time.Millisecond)
+	case unitMicrosecond:
+		multiplier = int64(time.Microsecond)
+	case unitNanosecond:
+		multiplier = 1
+	default:
+		return 0, errors.Errorf("unknown unit %q", unit)
+	}
+	if v > math.MaxInt64/multiplier || v < math.MinInt64/multiplier {
+		return 0, errors.Errorf("timestamp %d in %s overflows", v, unit)
+	}
+	return v * multiplier, nil
+}
+
+// maxAttemptLabel is the attempt the later attempts of crash-looping
+// containers are labeled with
+const maxAttemptLabel = 5
+
+// attemptLabel returns the attempt label of a start attempt, the label is
+// bounded so crash-looping containers don't add series forever.
+func attemptLabel(attempt int) string {
+	if attempt >= maxAttemptLabel {
+		return strconv.Itoa(maxAttemptLabel) + "+"
+	}
+	return strconv.Itoa(attempt)
+}
+
+// attemptSet is the start attempts of a container, a bit per attempt below
+// 64 and the later ones in a map as only crash-looping containers have them.
+type attemptSet struct {
+	low  uint64
+	high map[int]struct{}
+}
+
+func (s attemptSet) has(attempt int) bool {
+	if attempt < 64 {
+		return s.low&(1<<uint(attempt)) != 0
+	}
+	_, exists := s.high[attempt]
+	return exists
+}
+
+func (s attemptSet) add(attempt int) attemptSet {
+	if attempt < 64 {
+		s.low |= 1 << uint(attempt)
+		return s
+	}
+	if s.high == nil {
+		s.high = map[int]struct{}{}
+	}
+	s.high[attempt] = struct{}{}
+	return s
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeStartupRecordsSkipsInvalid(t *testing.T) {
+	body := `[
+		{"name": "a", "namespace": "ns", "start": 1, "end": 2},
+		{"name": "b", "namespace": "ns", "start": 3, "end": 2},
+		{"name": "c", "namespace": "ns", "start": 1, "end": 2, "attempt": "x"},
+		{"name": "d", "namespace": "ns", "start": 1, "end": 2}
+	]`
+	records, rejected, err := decodeStartupRecords(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejected != 2 {
+		t.Errorf("rejected %d records, want 2", rejected)
+	}
+	if len(records) != 2 || records[0].Name != "a" || records[1].Name != "d" {
+		t.Errorf("decoded %+v, want a and d", records)
+	}
+}
+
+func TestDecodeStartupRecordsInvalidBody(t *testing.T) {
+	if _, _, err := decodeStartupRecords(strings.NewReader(`{"name": `)); err == nil {
+		t.Error("decoded a body which isn't JSON")
+	}
+}
+
+func TestParseTimestampOverflow(t *testing.T) {
+	if v, err := parseTimestamp([]byte("1609459200"), unitSecond); err != nil || v != 1609459200000000000 {
+		t.Errorf("got %d, %v, want the time in nanoseconds", v, err)
+	}
+	if _, err := parseTimestamp([]byte("9300000000000000000"), unitNanosecond); err == nil {
+		t.Error("parsed a timestamp out of int64")
+	}
+	if v, err := parseTimestamp([]byte("9223372037"), unitSecond); err == nil {
+		t.Errorf("got %d, want an error for seconds which overflow in nanoseconds", v)
+	}
+	if v, err := parseTimestamp([]byte(`"9223372036855"`), unitMillisecond); err == nil {
+		t.Errorf("got %d, want an error for milliseconds which overflow in nanoseconds", v)
+	}
+}
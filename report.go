@@ -0,0 +1,243 @@
+package main
+
+import (
+	gocontext "context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	reportKind = "DeploymentStartupReport"
+	// reportHistoryLength is how many measurements a report keeps
+	reportHistoryLength = 10
+	// reportWriteTimeout bounds every request of a report write
+	reportWriteTimeout = 10 * time.Second
+
+	reportConditionMeasured      = "Measured"
+	reportConditionScaleMeasured = "ScaleMeasured"
+)
+
+var (
+	reportResource = schema.GroupVersionResource{Group: "startup-exporter.io", Version: "v1alpha1", Resource: "deploymentstartupreports"}
+
+	// writeReports enables a DeploymentStartupReport per measured deployment
+	writeReports bool
+	reports      = reportWriter{
+		written: map[deployKey]reportMeasurement{},
+		history: map[deployKey][]reportMeasurement{},
+	}
+)
+
+// reportStatus is the status of a DeploymentStartupReport.
+type reportStatus struct {
+	AvgLatencyMs   float64             `json:"avgLatencyMs"`
+	Samples        int                 `json:"samples"`
+	ScaleLatencyMs *float64            `json:"scaleLatencyMs,omitempty"`
+	Updated        metav1.Time         `json:"updated"`
+	History        []reportMeasurement `json:"history,omitempty"`
+	Conditions     []metav1.Condition  `json:"conditions,omitempty"`
+}
+
+type reportMeasurement struct {
+	Time           metav1.Time `json:"time"`
+	AvgLatencyMs   float64     `json:"avgLatencyMs"`
+	Samples        int         `json:"samples"`
+	ScaleLatencyMs *float64    `json:"scaleLatencyMs,omitempty"`
+}
+
+// reportWriter keeps a DeploymentStartupReport per measured deployment in
+// the namespace of the deployment, so the results can be read with kubectl
+// without a metrics stack. A report is owned by its deployment and is
+// deleted with it.
+type reportWriter struct {
+	sync.Mutex
+	// written holds the measurement last written to the report of a
+	// deployment
+	written map[deployKey]reportMeasurement
+	// history holds the measurements of a report, seeded from the report on
+	// its first write
+	history map[deployKey][]reportMeasurement
+	// syncing is set while a sync runs in the background
+	syncing bool
+}
+
+// start syncs the reports in the background unless a sync is still running,
+// so a slow apiserver doesn't hold up the export loop.
+func (w *reportWriter) start(clusters []*cluster) {
+	w.Lock()
+	defer w.Unlock()
+	if w.syncing {
+		return
+	}
+	w.syncing = true
+	go func() {
+		w.sync(clusters)
+		w.Lock()
+		w.syncing = false
+		w.Unlock()
+	}()
+}
+
+// sync writes the reports of the deployments with a measurement published
+// since their reports were written.
+func (w *reportWriter) sync(clusters []*cluster) {
+	deployStatuses.Lock()
+	statuses := make(map[deployKey]deploymentStatus, len(deployStatuses.deploys))
+	for k, s := range deployStatuses.deploys {
+		statuses[k] = s
+	}
+	deployStatuses.Unlock()
+	for _, c := range clusters {
+		for k, s := range statuses {
+			if k.cluster != c.name {
+				continue
+			}
+			if latency, ok := scales.last(k); ok {
+				s.ScaleLatencyMs = &latency
+			}
+			m := reportMeasurement{
+				Time:           metav1.NewTime(s.Updated),
+				AvgLatencyMs:   s.AvgLatencyMs,
+				Samples:        s.Samples,
+				ScaleLatencyMs: s.ScaleLatencyMs,
+			}
+			w.Lock()
+			written, exists := w.written[k]
+			history, seeded := w.history[k]
+			w.Unlock()
+			if exists && !m.Time.After(written.Time.Time) && sameLatency(m.ScaleLatencyMs, written.ScaleLatencyMs) {
+				continue
+			}
+			history, err := w.write(c, k, m, history, seeded)
+			if err != nil {
+				logrus.WithError(err).Errorf("failed to write the report of deployment %s(%s)", k.name, k.namespace)
+				continue
+			}
+			w.Lock()
+			w.written[k], w.history[k] = m, history
+			w.Unlock()
+		}
+	}
+}
+
+// sameLatency reports whether two optional latencies are the same.
+func sameLatency(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// write creates the report of the deployment if it doesn't exist and updates
+// its status with m appended to the history, which is read from the report
+// unless it is seeded. It returns the history written.
+func (w *reportWriter) write(c *cluster, k deployKey, m reportMeasurement, history []reportMeasurement, seeded bool) ([]reportMeasurement, error) {
+	d, err := c.deploymentLister.Deployments(k.namespace).Get(k.name)
+	if err != nil {
+		return nil, err
+	}
+	client := c.dynamicClient.Resource(reportResource).Namespace(k.namespace)
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), reportWriteTimeout)
+	defer cancel()
+	report, err := client.Get(ctx, k.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		report, err = client.Create(ctx, newReport(d), metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	previous := &reportStatus{}
+	if u, ok := report.Object["status"].(map[string]interface{}); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, previous); err != nil {
+			logrus.WithError(err).Warnf("failed to read the status of the report of deployment %s(%s)", k.name, k.namespace)
+			previous = &reportStatus{}
+		}
+	}
+	if !seeded {
+		history = previous.History
+	}
+	history = append(append([]reportMeasurement{}, history...), m)
+	if len(history) > reportHistoryLength {
+		history = history[len(history)-reportHistoryLength:]
+	}
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(newReportStatus(m, history, previous.Conditions))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert the status")
+	}
+	report.Object["status"] = u
+	if _, err = client.UpdateStatus(ctx, report, metav1.UpdateOptions{}); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// newReportStatus returns the status of a report whose last measurement is m,
+// the transition time of a condition in previous is kept unless its status
+// changes.
+func newReportStatus(m reportMeasurement, history []reportMeasurement, previous []metav1.Condition) *reportStatus {
+	status := &reportStatus{
+		AvgLatencyMs:   m.AvgLatencyMs,
+		Samples:        m.Samples,
+		ScaleLatencyMs: m.ScaleLatencyMs,
+		Updated:        m.Time,
+		History:        history,
+		Conditions:     append([]metav1.Condition{}, previous...),
+	}
+	apimeta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               reportConditionMeasured,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: m.Time,
+		Reason:             "Published",
+		Message:            "the average startup latency of the containers is published",
+	})
+	scaleCondition := metav1.Condition{
+		Type:               reportConditionScaleMeasured,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: m.Time,
+		Reason:             "NoScaleEvent",
+		Message:            "no scale event has completed since the exporter started",
+	}
+	if m.ScaleLatencyMs != nil {
+		scaleCondition.Status, scaleCondition.Reason = metav1.ConditionTrue, "Published"
+		scaleCondition.Message = "the latency of the last scale event is published"
+	}
+	apimeta.SetStatusCondition(&status.Conditions, scaleCondition)
+	return status
+}
+
+func newReport(d *appsv1.Deployment) *unstructured.Unstructured {
+	report := &unstructured.Unstructured{}
+	report.SetAPIVersion(reportResource.GroupVersion().String())
+	report.SetKind(reportKind)
+	report.SetName(d.Name)
+	report.SetNamespace(d.Namespace)
+	ref := metav1.NewControllerRef(d, appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	// blocking the deletion of the deployment needs more permissions
+	blockOwnerDeletion := false
+	ref.BlockOwnerDeletion = &blockOwnerDeletion
+	report.SetOwnerReferences([]metav1.OwnerReference{*ref})
+	return report
+}
+
+// prune forgets the deployments which don't exist anymore, their reports
+// are deleted by the garbage collector.
+func (w *reportWriter) prune(existing map[deployKey]struct{}) {
+	w.Lock()
+	defer w.Unlock()
+	for k := range w.written {
+		if _, exists := existing[k]; !exists {
+			delete(w.written, k)
+			delete(w.history, k)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	gocontext "context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestReportKeepsHistoryAndTransitionTime(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "d1"}}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(d); err != nil {
+		t.Fatal(err)
+	}
+	// the report written before the exporter restarted
+	report := newReport(d)
+	var history []reportMeasurement
+	for i := 0; i < 3; i++ {
+		history = append(history, reportMeasurement{Time: metav1.NewTime(start.Add(time.Duration(i) * time.Minute)), AvgLatencyMs: 100})
+	}
+	status, err := runtime.DefaultUnstructuredConverter.ToUnstructured(newReportStatus(history[2], history, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report.Object["status"] = status
+	c := &cluster{
+		deploymentLister: appslisters.NewDeploymentLister(indexer),
+		dynamicClient:    dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), report),
+	}
+	w := reportWriter{written: map[deployKey]reportMeasurement{}, history: map[deployKey][]reportMeasurement{}}
+	k := deployKey{meta: meta{name: "web", namespace: "default"}}
+
+	m := reportMeasurement{Time: metav1.NewTime(start.Add(time.Hour)), AvgLatencyMs: 120}
+	written, err := w.write(c, k, m, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 4 {
+		t.Errorf("wrote %d measurements, want the 3 of the report and the new one", len(written))
+	}
+	u, err := c.dynamicClient.Resource(reportResource).Namespace("default").Get(gocontext.Background(), "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &reportStatus{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object["status"].(map[string]interface{}), got); err != nil {
+		t.Fatal(err)
+	}
+	for _, condition := range got.Conditions {
+		if !condition.LastTransitionTime.Time.Equal(history[2].Time.Time) {
+			t.Errorf("condition %s moved to %v without changing its status", condition.Type, condition.LastTransitionTime)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import "net/http"
+
+// requestIDHeader carries the ID of a push of startup info from a collector
+// to the exporter and on to a standby, records keep the ID of the request
+// they were received with, so a lost or duplicated record can be traced in
+// the logs of both sides.
+const requestIDHeader = "X-Request-ID"
+
+// requestID returns the ID of the request, it's assigned if the sender
+// didn't and echoed in the response.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" {
+		id = newID()
+	}
+	w.Header().Set(requestIDHeader, id)
+	return id
+}
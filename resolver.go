@@ -0,0 +1,264 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	containerIDIndex = "containerID"
+
+	orphanReasonNoPod       = "no-pod"
+	orphanReasonPodMismatch = "pod-mismatch"
+
+	// orphanGracePeriod is how long a container may be unknown to the pod
+	// status after it's received, the status lags behind the collectors
+	orphanGracePeriod = time.Minute
+)
+
+var orphanContainers = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "orphan_containers",
+	},
+	[]string{
+		"namespace",
+		"reason",
+	},
+)
+
+// podRef identifies a pod across clusters.
+type podRef struct {
+	cluster   string
+	namespace string
+	name      string
+}
+
+// podResolver resolves which pod a container belongs to.
+type podResolver interface {
+	// resolve returns the pod the container with the ID belongs to
+	resolve(id string) (podRef, bool)
+	// exists reports whether the pod exists in any cluster
+	exists(namespace, name string) bool
+}
+
+// resolver verifies the received containers, it's nil if there is no cluster
+// to verify against.
+var resolver podResolver
+
+// containerIDs indexes pods by the IDs of their containers without the
+// runtime prefix.
+func containerIDs(obj interface{}) ([]string, error) {
+	p, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, nil
+	}
+	var ids []string
+	for _, statuses := range [][]corev1.ContainerStatus{p.Status.InitContainerStatuses, p.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if i := strings.Index(status.ContainerID, "://"); i >= 0 {
+				ids = append(ids, status.ContainerID[i+3:])
+			}
+		}
+	}
+	return ids, nil
+}
+
+// statusResolver resolves containers through the container statuses of the
+// pods in the informer caches.
+type statusResolver struct {
+	clusters []*cluster
+}
+
+func (s statusResolver) resolve(id string) (podRef, bool) {
+	for _, c := range s.clusters {
+		objs, err := c.factory.Core().V1().Pods().Informer().GetIndexer().ByIndex(containerIDIndex, id)
+		if err != nil || len(objs) == 0 {
+			continue
+		}
+		if p, ok := objs[0].(*corev1.Pod); ok {
+			return podRef{cluster: c.name, namespace: p.Namespace, name: p.Name}, true
+		}
+	}
+	return podRef{}, false
+}
+
+func (s statusResolver) exists(namespace, name string) bool {
+	for _, c := range s.clusters {
+		if _, err := c.podLister.Pods(namespace).Get(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// containerVerifier verifies every received container once it's past the
+// grace period, so a tick only walks the new containers and the orphans
+// rather than all of the records.
+type containerVerifier struct {
+	// pending holds the containers to verify, a container stays pending
+	// while it's an orphan. It's guarded by mu.
+	pending map[meta]struct{}
+	// orphans holds the reasons of the orphan containers, the ones which
+	// belong to another pod than their CRI annotations tell are left out of
+	// the aggregates. It's guarded by mu.
+	orphans map[meta]string
+
+	deletions sync.Mutex
+	// deletedPods and deletedContainers hold when pods and the containers of
+	// pods were seen deleted, their containers aren't orphans while they
+	// wait for the gc.
+	deletedPods       map[[2]string]time.Time
+	deletedContainers map[string]time.Time
+}
+
+var verifier = containerVerifier{
+	pending:           map[meta]struct{}{},
+	orphans:           map[meta]string{},
+	deletedPods:       map[[2]string]time.Time{},
+	deletedContainers: map[string]time.Time{},
+}
+
+// add queues a received container to be verified, it must be called with mu
+// held.
+func (v *containerVerifier) add(m meta) {
+	v.pending[m] = struct{}{}
+}
+
+// forget drops a container removed from the records, it must be called with
+// mu held.
+func (v *containerVerifier) forget(m meta) {
+	delete(v.pending, m)
+	delete(v.orphans, m)
+}
+
+// mismatched reports whether the container belongs to another pod than its
+// CRI annotations tell, it must be called with mu held.
+func (v *containerVerifier) mismatched(m meta) bool {
+	return v.orphans[m] == orphanReasonPodMismatch
+}
+
+// podDeleted remembers the deleted pod and its containers.
+func (v *containerVerifier) podDeleted(p *corev1.Pod) {
+	ids, _ := containerIDs(p)
+	now := clk.Now()
+	v.deletions.Lock()
+	defer v.deletions.Unlock()
+	v.deletedPods[[2]string{p.Namespace, p.Name}] = now
+	for _, id := range ids {
+		v.deletedContainers[id] = now
+	}
+}
+
+// deleted reports whether the container or its pod was seen deleted, and
+// forgets the deletions whose containers have been collected by now.
+func (v *containerVerifier) deleted(id, namespace, pod string) bool {
+	v.deletions.Lock()
+	defer v.deletions.Unlock()
+	_, deleted := v.deletedContainers[id]
+	if !deleted && pod != "" {
+		_, deleted = v.deletedPods[[2]string{namespace, pod}]
+	}
+	return deleted
+}
+
+func (v *containerVerifier) expireDeletions() {
+	v.deletions.Lock()
+	defer v.deletions.Unlock()
+	for k, at := range v.deletedPods {
+		if clk.Since(at) > gcGracePeriod+orphanGracePeriod {
+			delete(v.deletedPods, k)
+		}
+	}
+	for id, at := range v.deletedContainers {
+		if clk.Since(at) > gcGracePeriod+orphanGracePeriod {
+			delete(v.deletedContainers, id)
+		}
+	}
+}
+
+// verify returns why the container is an orphan, or an empty reason if it
+// isn't.
+func (v *containerVerifier) verify(m meta, r startupRecord) string {
+	ref, resolved := resolver.resolve(m.name)
+	switch {
+	case resolved && r.Pod != "" && (ref.name != r.Pod || ref.namespace != r.PodNamespace):
+		return orphanReasonPodMismatch
+	case resolved || v.deleted(m.name, r.PodNamespace, r.Pod):
+		return ""
+	case r.Pod != "" && resolver.exists(r.PodNamespace, r.Pod):
+		// a container not in the pod status may still be the sandbox of
+		// an existing pod
+		return ""
+	}
+	return orphanReasonNoPod
+}
+
+// podContainer returns the record of a container of a pod, a container
+// which belongs to another pod than its CRI annotations tell is left out. It
+// must be called with mu held.
+func podContainer(name string) (startupRecord, bool) {
+	m := meta{name: name, namespace: defaultContainerdK8sNamespace}
+	if verifier.mismatched(m) {
+		return startupRecord{}, false
+	}
+	return allInfo.get(m)
+}
+
+// verifyContainers counts the received containers which belong to no pod,
+// or to another pod than their CRI annotations tell, before the aggregation.
+// Lots of them usually mean the collectors watch the wrong containerd
+// namespace. The pods are resolved without holding mu.
+func verifyContainers() {
+	if resolver == nil {
+		return
+	}
+	type candidate struct {
+		m meta
+		r startupRecord
+	}
+	var candidates []candidate
+	mu.Lock()
+	for m := range verifier.pending {
+		r, exists := allInfo.get(m)
+		if !exists {
+			verifier.forget(m)
+			continue
+		}
+		if clk.Since(r.Received) >= orphanGracePeriod {
+			candidates = append(candidates, candidate{m: m, r: r})
+		}
+	}
+	mu.Unlock()
+	reasons := make(map[meta]string, len(candidates))
+	for _, c := range candidates {
+		reasons[c.m] = verifier.verify(c.m, c.r)
+	}
+	orphans := map[[2]string]int{}
+	mu.Lock()
+	for m, reason := range reasons {
+		if _, pending := verifier.pending[m]; !pending {
+			// removed while it was verified
+			continue
+		}
+		if reason == "" {
+			verifier.forget(m)
+		} else {
+			verifier.orphans[m] = reason
+		}
+	}
+	for m, reason := range verifier.orphans {
+		orphans[[2]string{m.namespace, reason}]++
+	}
+	mu.Unlock()
+	verifier.expireDeletions()
+	orphanContainers.Reset()
+	for k, n := range orphans {
+		orphanContainers.WithLabelValues(k[0], k[1]).Set(float64(n))
+	}
+}
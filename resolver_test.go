@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakeResolver struct {
+	pods     map[string]podRef
+	resolved int
+}
+
+func (f *fakeResolver) resolve(id string) (podRef, bool) {
+	f.resolved++
+	ref, ok := f.pods[id]
+	return ref, ok
+}
+
+func (f *fakeResolver) exists(namespace, name string) bool {
+	for _, ref := range f.pods {
+		if ref.namespace == namespace && ref.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestVerifyContainersBeforeAggregation(t *testing.T) {
+	c := fakeClock(t)
+	resetRecords()
+	defer resetRecords()
+	defer func(r podResolver) { resolver = r }(resolver)
+	f := &fakeResolver{pods: map[string]podRef{
+		"ok":       {namespace: "default", name: "web-0"},
+		"mismatch": {namespace: "default", name: "web-1"},
+	}}
+	resolver = f
+	verifier.podDeleted(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-2", Namespace: "default"},
+	})
+	for name, pod := range map[string]string{"ok": "web-0", "mismatch": "web-0", "deleted": "web-2", "lost": ""} {
+		r := startupRecord{Name: name, Namespace: defaultContainerdK8sNamespace, Pod: pod, PodNamespace: "default", Received: clk.Now()}
+		r.Start, r.End = 1, 2
+		ingest(r)
+	}
+	c.Advance(orphanGracePeriod)
+	verifyContainers()
+	mu.Lock()
+	if len(verifier.orphans) != 2 || verifier.orphans[meta{name: "mismatch", namespace: defaultContainerdK8sNamespace}] != orphanReasonPodMismatch ||
+		verifier.orphans[meta{name: "lost", namespace: defaultContainerdK8sNamespace}] != orphanReasonNoPod {
+		t.Errorf("got orphans %v, want the mismatched and the lost containers", verifier.orphans)
+	}
+	if _, ok := podContainer("mismatch"); ok {
+		t.Error("a container of another pod is aggregated")
+	}
+	if _, ok := podContainer("ok"); !ok {
+		t.Error("a verified container isn't aggregated")
+	}
+	mu.Unlock()
+
+	f.resolved = 0
+	verifyContainers()
+	if f.resolved != 2 {
+		t.Errorf("resolved %d containers again, want only the orphans", f.resolved)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+var (
+	deployRevisionLatencyDelta = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "revision_latency_delta_milliseconds",
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+			"revision",
+			"previous_revision",
+		},
+	)
+	deployRevisionLatencyRatio = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "revision_latency_ratio",
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+			"revision",
+			"previous_revision",
+		},
+	)
+)
+
+type revisionLatency struct {
+	revision string
+	avg      float64
+}
+
+// revisionTracker keeps the average startup latency of the current and the
+// previous revision of deployments, so a regression of a new image shows
+// right after its rollout.
+type revisionTracker struct {
+	sync.Mutex
+	current  map[deployKey]revisionLatency
+	previous map[deployKey]revisionLatency
+}
+
+var revisions = revisionTracker{
+	current:  map[deployKey]revisionLatency{},
+	previous: map[deployKey]revisionLatency{},
+}
+
+// record records the average startup latency of the deployment, only a
+// complete rollout is recorded so the pods are all of one revision.
+func (t *revisionTracker) record(k deployKey, d *appsv1.Deployment, avg float64) {
+	revision, ok := d.Annotations[revisionAnnotation]
+	if !ok || !rolloutComplete(d) {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	if current, exists := t.current[k]; exists && current.revision != revision {
+		t.previous[k] = current
+	}
+	t.current[k] = revisionLatency{revision: revision, avg: avg}
+}
+
+// export sets the delta and the ratio of the current revision of the
+// deployment against the previous one, if both are measured.
+func (t *revisionTracker) export(k deployKey) {
+	t.Lock()
+	defer t.Unlock()
+	current, exists := t.current[k]
+	if !exists {
+		return
+	}
+	previous, exists := t.previous[k]
+	if !exists {
+		return
+	}
+	deployRevisionLatencyDelta.WithLabelValues(k.name, k.namespace, k.cluster, current.revision, previous.revision).Set(current.avg - previous.avg)
+	if previous.avg > 0 {
+		deployRevisionLatencyRatio.WithLabelValues(k.name, k.namespace, k.cluster, current.revision, previous.revision).Set(current.avg / previous.avg)
+	}
+}
+
+// prune forgets the deployments which don't exist anymore.
+func (t *revisionTracker) prune(existing map[deployKey]struct{}) {
+	t.Lock()
+	defer t.Unlock()
+	for k := range t.current {
+		if _, exists := existing[k]; !exists {
+			delete(t.current, k)
+			delete(t.previous, k)
+		}
+	}
+}
+
+func (t *revisionTracker) reset() {
+	t.Lock()
+	defer t.Unlock()
+	t.current = map[deployKey]revisionLatency{}
+	t.previous = map[deployKey]revisionLatency{}
+}
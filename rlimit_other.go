@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// setMaxOpenFiles isn't supported on this platform.
+func setMaxOpenFiles(n uint64) error {
+	return errors.Errorf("limiting open files is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,21 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"syscall"
+)
+
+// setMaxOpenFiles lowers the soft limit of open file descriptors of the
+// process to n.
+func setMaxOpenFiles(n uint64) error {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return err
+	}
+	if n < rlimit.Max {
+		rlimit.Cur = n
+	}
+	return syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlimit)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+)
+
+const (
+	revisionAnnotation = "deployment.kubernetes.io/revision"
+
+	skipReasonPaused   = "paused"
+	skipReasonRollback = "rollback"
+)
+
+var deployRolloutDuration = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystemDeploy,
+		Name:      "rollout_duration_milliseconds",
+	},
+	[]string{
+		"deploy_name",
+		"namespace",
+		"cluster",
+		"revision",
+	},
+)
+
+type rolloutState struct {
+	hash     string
+	revision string
+	// created is when the current replica set was created
+	created time.Time
+	started time.Time
+	// rollback is true while the deployment rolls back to an earlier
+	// replica set
+	rollback bool
+	// done is false until all the pods of the replica set are ready
+	done bool
+	// measured is the duration of the last rollout measured, of the
+	// measuredRevision
+	measured         float64
+	measuredRevision string
+}
+
+// rolloutTracker measures how long the rolling updates of deployments take,
+// from the replica set of a new pod template hash being created to all of its
+// pods being ready.
+type rolloutTracker struct {
+	sync.Mutex
+	deploys map[deployKey]*rolloutState
+}
+
+var rollouts = rolloutTracker{
+	deploys: map[deployKey]*rolloutState{},
+}
+
+// track follows the current replica set of the deployment and exports the
+// duration of its last rollout.
+func (t *rolloutTracker) track(c *cluster, d *appsv1.Deployment) {
+	rs, err := currentReplicaSet(d, c.rsLister)
+	if err != nil || rs == nil {
+		return
+	}
+	k := deployKey{cluster: c.name, meta: meta{name: d.Name, namespace: d.Namespace}}
+	hash := rs.Labels[podTemplateHashLabel]
+	t.Lock()
+	defer t.Unlock()
+	s, tracked := t.deploys[k]
+	switch {
+	case !tracked:
+		s = &rolloutState{hash: hash, revision: rs.Annotations[revisionAnnotation], created: rs.CreationTimestamp.Time, started: rs.CreationTimestamp.Time}
+		// a rollout which completed before the deployment is first seen
+		// can't be measured
+		s.done = rolloutComplete(d)
+		t.deploys[k] = s
+	case s.hash != hash:
+		revision := rs.Annotations[revisionAnnotation]
+		// a rollback reuses a replica set created before the current one,
+		// the deployment controller moves it to a new revision, which may
+		// not be observed yet
+		s.rollback = rs.CreationTimestamp.Time.Before(s.created) || lowerRevision(revision, s.revision)
+		s.hash, s.revision, s.created = hash, revision, rs.CreationTimestamp.Time
+		s.started = rs.CreationTimestamp.Time
+		// the creation of a reused replica set is long before the rollback
+		if s.rollback {
+			s.started = clk.Now()
+		}
+		s.done = false
+	}
+	if !s.done {
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		if rs.Status.ReadyReplicas >= replicas && rolloutComplete(d) {
+			s.done, s.rollback = true, false
+			s.measured = float64(clk.Since(s.started).Milliseconds())
+			s.measuredRevision = s.revision
+			if strategyRolloutDuration != nil {
+				strategyRolloutDuration.WithLabelValues(strategyOf(d).labelValues()...).Observe(s.measured)
+			}
+			logrus.Debugf("deployment %s(%s) rolled out revision %s in %vms", d.Name, d.Namespace, s.revision, s.measured)
+		}
+	}
+	if s.measuredRevision != "" {
+		deployRolloutDuration.WithLabelValues(d.Name, d.Namespace, c.name, s.measuredRevision).Set(s.measured)
+	}
+}
+
+// prune forgets the deployments which don't exist anymore.
+func (t *rolloutTracker) prune(existing map[deployKey]struct{}) {
+	t.Lock()
+	defer t.Unlock()
+	for k := range t.deploys {
+		if _, exists := existing[k]; !exists {
+			delete(t.deploys, k)
+		}
+	}
+}
+
+// rollingBack reports whether the deployment is rolling back to an earlier
+// replica set.
+func (t *rolloutTracker) rollingBack(k deployKey) bool {
+	t.Lock()
+	defer t.Unlock()
+	s, tracked := t.deploys[k]
+	return tracked && s.rollback
+}
+
+// lowerRevision reports whether the revision a is lower than b, unknown
+// revisions aren't.
+func lowerRevision(a, b string) bool {
+	x, err1 := strconv.ParseInt(a, 10, 64)
+	y, err2 := strconv.ParseInt(b, 10, 64)
+	return err1 == nil && err2 == nil && x < y
+}
+
+func (t *rolloutTracker) reset() {
+	t.Lock()
+	defer t.Unlock()
+	t.deploys = map[deployKey]*rolloutState{}
+}
+
+// skipReason returns why the deployment shouldn't be measured now, or an
+// empty string if it should. A paused deployment or one rolling back to an
+// earlier revision doesn't go through a real scale event. The rollback is
+// told by the rollouts tracked, so it must be called after rollouts.track.
+func skipReason(k deployKey, d *appsv1.Deployment) string {
+	if d.Spec.Paused {
+		return skipReasonPaused
+	}
+	if !rolloutComplete(d) && rollouts.rollingBack(k) {
+		return skipReasonRollback
+	}
+	return ""
+}
+
+func rolloutComplete(d *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	return d.Status.ObservedGeneration >= d.Generation &&
+		d.Status.UpdatedReplicas == replicas &&
+		d.Status.Replicas == replicas
+}
+
+// currentReplicaSet returns the replica set of the deployment which has the
+// same revision as the deployment.
+func currentReplicaSet(d *appsv1.Deployment, rsLister appslisters.ReplicaSetLister) (*appsv1.ReplicaSet, error) {
+	revision, ok := d.Annotations[revisionAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	rss, err := rsLister.ReplicaSets(d.Namespace).List(makeSelector(*d.Spec.Selector))
+	if err != nil {
+		return nil, err
+	}
+	for _, rs := range rss {
+		if metav1.IsControlledBy(rs, d) && rs.Annotations[revisionAnnotation] == revision {
+			return rs, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestScaleUpAfterRollbackIsMeasured(t *testing.T) {
+	fakeClock(t)
+	rollouts.reset()
+	defer rollouts.reset()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "d1"},
+		Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	c := &cluster{rsLister: appslisters.NewReplicaSetLister(indexer)}
+	k := deployKey{meta: meta{name: "web", namespace: "default"}}
+	replicaSet := func(hash string, created time.Time) *appsv1.ReplicaSet {
+		rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name:              "web-" + hash,
+			Namespace:         "default",
+			Labels:            map[string]string{"app": "web", podTemplateHashLabel: hash},
+			CreationTimestamp: metav1.NewTime(created),
+			OwnerReferences:   controlledBy("Deployment", "web", "d1"),
+		}}
+		if err := indexer.Add(rs); err != nil {
+			t.Fatal(err)
+		}
+		return rs
+	}
+	a, b := replicaSet("a", start), replicaSet("b", start.Add(time.Hour))
+	// rollout moves the deployment to the revision of the replica set with
+	// the replicas, complete or not
+	rollout := func(rs *appsv1.ReplicaSet, revision string, replicas int32, complete bool) string {
+		rs.Annotations = map[string]string{revisionAnnotation: revision}
+		d.Annotations = map[string]string{revisionAnnotation: revision}
+		d.Spec.Replicas = &replicas
+		d.Status.UpdatedReplicas, d.Status.Replicas, rs.Status.ReadyReplicas = replicas, replicas, replicas
+		if !complete {
+			d.Status.Replicas--
+		}
+		rollouts.track(c, d)
+		return skipReason(k, d)
+	}
+	rollout(a, "1", 2, true)
+	if reason := rollout(b, "2", 2, false); reason != "" {
+		t.Errorf("a rollout to a new replica set is skipped as %s", reason)
+	}
+	rollout(b, "2", 2, true)
+	// the rollback moves the earlier replica set to a new revision
+	if reason := rollout(a, "3", 2, false); reason != skipReasonRollback {
+		t.Errorf("got %q for a rollback", reason)
+	}
+	rollout(a, "3", 2, true)
+	if reason := rollout(a, "3", 4, false); reason != "" {
+		t.Errorf("a scale-up after a rollback is skipped as %s", reason)
+	}
+}
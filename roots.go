@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultContainerdConfig = "/etc/containerd/config.toml"
+	// taskRootName is the dir under the state dir of containerd which holds
+	// the bundles of the runtime v2 tasks
+	taskRootName = "io.containerd.runtime.v2.task"
+)
+
+// containerdState returns the state dir set in the config file of containerd,
+// it's empty if the config doesn't set it. Only the top-level state key is
+// needed, so the file isn't parsed as a whole TOML document.
+func containerdState(config string) (string, error) {
+	f, err := os.Open(config)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			// top-level keys come before the first table
+			break
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) != "state" {
+			continue
+		}
+		return tomlString(strings.TrimSpace(kv[1]))
+	}
+	return "", scanner.Err()
+}
+
+// tomlString returns the value of a TOML string followed by an optional
+// comment.
+func tomlString(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, "'"):
+		if i := strings.Index(v[1:], "'"); i >= 0 {
+			return v[1 : i+1], nil
+		}
+	case strings.HasPrefix(v, `"`):
+		for i := 1; i < len(v); i++ {
+			if v[i] == '\\' {
+				i++
+				continue
+			}
+			if v[i] == '"' {
+				return strconv.Unquote(v[:i+1])
+			}
+		}
+	}
+	return "", errors.Errorf("invalid string %s", v)
+}
+
+// taskRoots returns the task roots to scan, the default one, the one under
+// the state dir from the config of containerd if it's set and the extra
+// ones, each of them once.
+func taskRoots(config string, extra []string) []string {
+	roots := []string{defaultContainerdRoot}
+	if config != "" {
+		state, err := containerdState(config)
+		if err != nil && !os.IsNotExist(err) {
+			logrus.WithError(err).Warnf("failed to read the state dir from %s", config)
+		}
+		if state != "" {
+			roots = append(roots, path.Join(state, taskRootName))
+		}
+	}
+	roots = append(roots, extra...)
+	var (
+		unique []string
+		seen   = map[string]struct{}{}
+	)
+	for _, r := range roots {
+		r = path.Clean(r)
+		if _, exists := seen[r]; exists {
+			continue
+		}
+		seen[r] = struct{}{}
+		unique = append(unique, r)
+	}
+	return unique
+}
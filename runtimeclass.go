@@ -0,0 +1,25 @@
+package main
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// runtimeClass returns the runtime class of a pod spec, e.g. kata or gvisor,
+// it's empty for pods run by the default handler of the nodes.
+func runtimeClass(spec corev1.PodSpec) string {
+	if spec.RuntimeClassName == nil {
+		return ""
+	}
+	return *spec.RuntimeClassName
+}
+
+// podsRuntimeClass returns the runtime class of the first of the pods, the
+// pods of a workload share one unless its template is being changed.
+func podsRuntimeClass(pods []*corev1.Pod) string {
+	for _, p := range pods {
+		if p != nil {
+			return runtimeClass(p.Spec)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/YLonely/startup-exporter/pkg/shimhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const prestartComponentSandboxBoot = "sandbox-boot"
+
+var sandboxBootLatency = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystemPod,
+		Name:      "sandbox_boot_latency_milliseconds",
+	},
+	[]string{
+		"type",
+		"namespace",
+		"node",
+	},
+)
+
+// sandboxBoot returns how long the sandbox VM of the container took to boot,
+// if its shim recorded it in the extras.
+func sandboxBoot(r startupRecord) (float64, bool) {
+	start, err := strconv.ParseInt(r.Extras[shimhook.ExtraSandboxBootStart], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	end, err := strconv.ParseInt(r.Extras[shimhook.ExtraSandboxBootEnd], 10, 64)
+	if err != nil || end < start {
+		return 0, false
+	}
+	return float64(end - start), true
+}
+
+// exportSandboxBootLatency sets the average boot latency of the sandbox VMs
+// of the pods of the deployment, the containers of a pod share the VM so the
+// first one recording the boot is taken.
+func exportSandboxBootLatency(c *cluster, d *appsv1.Deployment, pods []*corev1.Pod) {
+	var (
+		total float64
+		n     int
+	)
+	for _, p := range pods {
+		records, _ := podStartupRecords(p)
+		for _, r := range records {
+			if latency, ok := sandboxBoot(r); ok {
+				total += latency
+				n++
+				break
+			}
+		}
+	}
+	if n == 0 {
+		return
+	}
+	deployPrestartLatency.WithLabelValues(d.Name, d.Namespace, c.name, prestartComponentSandboxBoot).Set(total / float64(n))
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	podTemplateHashLabel = "pod-template-hash"
+	// scaleEventTimeout is how long a scale event may wait for its pods
+	scaleEventTimeout = 30 * time.Minute
+
+	// scaleTimeNode measures scale latency with the timestamps of the
+	// containers taken on the nodes
+	scaleTimeNode = "node"
+	// scaleTimeReceive measures scale latency up to the exporter receiving
+	// the last container instead of its node starting it, so it differs
+	// from the node latency by the push delay of the collectors and the skew
+	// of the clock of that node
+	scaleTimeReceive = "receive"
+)
+
+var (
+	deployScaleLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "scale_latency_milliseconds",
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+		},
+	)
+	deployScaleDownDuration = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "scale_down_duration_milliseconds",
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+		},
+	)
+	deployScaleLatencyBySource = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "scale_latency_by_source_milliseconds",
+		},
+		[]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+			"source",
+		},
+	)
+	// deployScaleLatencyByStep is registered with the latency buckets
+	deployScaleLatencyByStep *prometheus.HistogramVec
+)
+
+// measureScaleDown enables measuring how long deployments take to scale down.
+var measureScaleDown bool
+
+// scaleTimeSource is the clock scale latency is measured with, both
+// latencies are exported by source if it's the exporter's, to tell the skew
+// of the nodes.
+var scaleTimeSource = scaleTimeNode
+
+// scaleKey identifies a scale event, a deployment scaled up again before the
+// previous scale event completes gets a new key.
+type scaleKey struct {
+	deployKey
+	hash     string
+	replicas int32
+}
+
+// scaleEvent is a scale-up of a deployment in progress.
+type scaleEvent struct {
+	key    scaleKey
+	opened time.Time
+	// expected is the number of pods the scale event adds
+	expected int
+	// pods holds the UIDs of the pods added by the scale event, a pod
+	// recreated with the same name is a different pod
+	pods map[types.UID]struct{}
+	// experiment is the ID of the experiment which scaled the deployment
+	experiment string
+	tags       map[string]string
+}
+
+// scaleDown is a scale-down of a deployment in progress, it completes when
+// the pods over the replicas are gone.
+type scaleDown struct {
+	opened   time.Time
+	replicas int32
+}
+
+// scaleExpectation is a scale-up requested by an experiment which hasn't
+// been seen yet.
+type scaleExpectation struct {
+	replicas   int32
+	experiment string
+	tags       map[string]string
+}
+
+// deployScale is what the tracker knows about a deployment.
+type deployScale struct {
+	last scaleKey
+	// known holds the UIDs of the pods which belong to a scale event or
+	// existed before the deployment was tracked
+	known  map[types.UID]struct{}
+	events []*scaleEvent
+	// latency is the scale latency of the last completed scale event
+	latency  float64
+	measured bool
+	// bySource is the latency of the last completed scale event measured
+	// with either clock
+	bySource scaleLatency
+	expected []scaleExpectation
+	// history holds the last completed scale events
+	history []scaleSample
+	// down is the scale-down in progress
+	down         *scaleDown
+	downDuration float64
+	downMeasured bool
+	// strategy is the strategy of the deployment, nil for other workloads
+	strategy *deployStrategy
+}
+
+// scaleTracker measures scale events of deployments, each scale-up is
+// measured on its own even if it overlaps with another one.
+type scaleTracker struct {
+	sync.Mutex
+	// kind is the kind of the workloads of the tracker if they aren't
+	// deployments
+	kind    string
+	started time.Time
+	deploys map[deployKey]*deployScale
+}
+
+var scales = newScaleTracker("")
+
+func newScaleTracker(kind string) *scaleTracker {
+	return &scaleTracker{
+		kind:    kind,
+		started: clk.Now(),
+		deploys: map[deployKey]*deployScale{},
+	}
+}
+
+// stepBucket groups the number of pods added by a scale event.
+func stepBucket(n int) string {
+	switch {
+	case n <= 1:
+		return "1"
+	case n <= 5:
+		return "2-5"
+	case n <= 20:
+		return "6-20"
+	default:
+		return "20+"
+	}
+}
+
+// track opens a scale event when the deployment scales up, assigns new pods
+// to the open scale events and completes the ones whose pods have all
+// started.
+func (s *scaleTracker) track(c *cluster, d *appsv1.Deployment, pods []*corev1.Pod) {
+	k := deployKey{cluster: c.name, meta: meta{name: d.Name, namespace: d.Namespace}}
+	key := scaleKey{deployKey: k, replicas: 1}
+	if d.Spec.Replicas != nil {
+		key.replicas = *d.Spec.Replicas
+	}
+	if rs, err := currentReplicaSet(d, c.rsLister); err == nil && rs != nil {
+		key.hash = rs.Labels[podTemplateHashLabel]
+	}
+	strategy := strategyOf(d)
+	s.trackStrategy(c, key, d.CreationTimestamp.Time, pods, 0, &strategy)
+}
+
+// trackKey tracks the scale events of a workload created at the time, the
+// key is its current revision and replicas.
+func (s *scaleTracker) trackKey(c *cluster, key scaleKey, created time.Time, pods []*corev1.Pod) {
+	s.trackRevision(c, key, created, pods, 0)
+}
+
+// trackRevision is trackKey for workloads which replace their pods on a new
+// revision, the scale event of a new revision waits for the outdated pods to
+// be replaced.
+func (s *scaleTracker) trackRevision(c *cluster, key scaleKey, created time.Time, pods []*corev1.Pod, outdated int) {
+	s.trackStrategy(c, key, created, pods, outdated, nil)
+}
+
+// trackStrategy is trackRevision for a deployment with the strategy, which
+// is set before its first scale event can complete.
+func (s *scaleTracker) trackStrategy(c *cluster, key scaleKey, created time.Time, pods []*corev1.Pod, outdated int, strategy *deployStrategy) {
+	k := key.deployKey
+	s.Lock()
+	defer s.Unlock()
+	ds, tracked := s.deploys[k]
+	if !tracked {
+		ds = &deployScale{known: map[types.UID]struct{}{}}
+		s.deploys[k] = ds
+	}
+	if strategy != nil {
+		ds.strategy = strategy
+	}
+	if !tracked {
+		if created.Before(s.started) {
+			// the pods were created before the exporter started, their
+			// scale event can't be measured
+			for _, p := range pods {
+				ds.known[p.UID] = struct{}{}
+			}
+			ds.last = key
+			return
+		}
+		ds.last = scaleKey{deployKey: k, hash: key.hash}
+	}
+	if key != ds.last {
+		added := int(key.replicas - ds.last.replicas)
+		if key.hash != ds.last.hash && outdated > 0 {
+			added = outdated
+		}
+		if added < 0 && key.hash == ds.last.hash {
+			ds.scaledDown(key)
+		}
+		if added > 0 {
+			ds.down = nil
+			e := &scaleEvent{
+				key:      key,
+				opened:   clk.Now(),
+				expected: added,
+				pods:     map[types.UID]struct{}{},
+			}
+			for i, x := range ds.expected {
+				if x.replicas == key.replicas {
+					e.experiment, e.tags = x.experiment, x.tags
+					ds.expected = append(ds.expected[:i], ds.expected[i+1:]...)
+					break
+				}
+			}
+			ds.events = append(ds.events, e)
+			logrus.Debugf("%s %s(%s) scales up by %d pods", s.kindName(), k.name, k.namespace, added)
+		}
+		ds.last = key
+	}
+	ds.assign(c, pods)
+	s.complete(ds, pods)
+	if ds.down != nil && len(pods) <= int(ds.down.replicas) {
+		ds.downDuration, ds.downMeasured = float64(clk.Since(ds.down.opened).Milliseconds()), true
+		ds.down = nil
+		logrus.Debugf("%s %s(%s) scaled down to %d replicas in %vms", s.kindName(), k.name, k.namespace, key.replicas, ds.downDuration)
+	}
+}
+
+// scaledDown drops the open scale events which can't complete with the fewer
+// replicas, so the scale latency only measures scale-ups, and opens a
+// scale-down if they are measured.
+func (ds *deployScale) scaledDown(key scaleKey) {
+	var open []*scaleEvent
+	for _, e := range ds.events {
+		if e.key.replicas > key.replicas {
+			logrus.Debugf("scale event of %s(%s) to %d replicas is cancelled by scaling down to %d", e.key.name, e.key.namespace, e.key.replicas, key.replicas)
+			if e.experiment != "" {
+				experiments.fail(e.experiment, fmt.Sprintf("cancelled by scaling down to %d replicas", key.replicas))
+			}
+			continue
+		}
+		open = append(open, e)
+	}
+	ds.events = open
+	if !measureScaleDown {
+		return
+	}
+	if ds.down == nil {
+		ds.down = &scaleDown{opened: clk.Now()}
+	}
+	ds.down.replicas = key.replicas
+}
+
+// kindName is the kind of the workloads of the tracker in log lines.
+func (s *scaleTracker) kindName() string {
+	if s.kind == "" {
+		return "deployment"
+	}
+	return s.kind
+}
+
+// assign hands the pods not known yet to the open scale events in the order
+// they were created, pods left over are created by something else than a
+// scale-up, e.g. a rolling update.
+func (ds *deployScale) assign(c *cluster, pods []*corev1.Pod) {
+	var added []*corev1.Pod
+	current := map[types.UID]struct{}{}
+	for _, p := range pods {
+		current[p.UID] = struct{}{}
+		if _, exists := ds.known[p.UID]; exists || c.evictions.isReplacement(p) {
+			continue
+		}
+		added = append(added, p)
+	}
+	for uid := range ds.known {
+		if _, exists := current[uid]; !exists {
+			delete(ds.known, uid)
+		}
+	}
+	sort.Slice(added, func(i, j int) bool {
+		return added[i].CreationTimestamp.Before(&added[j].CreationTimestamp)
+	})
+	for _, e := range ds.events {
+		for len(added) > 0 && len(e.pods) < e.expected {
+			e.pods[added[0].UID] = struct{}{}
+			ds.known[added[0].UID] = struct{}{}
+			added = added[1:]
+		}
+	}
+	for _, p := range added {
+		ds.known[p.UID] = struct{}{}
+	}
+}
+
+// complete measures the scale events whose pods have all started.
+func (s *scaleTracker) complete(ds *deployScale, pods []*corev1.Pod) {
+	byUID := map[types.UID]*corev1.Pod{}
+	for _, p := range pods {
+		byUID[p.UID] = p
+	}
+	var open []*scaleEvent
+	for _, e := range ds.events {
+		if clk.Since(e.opened) > scaleEventTimeout {
+			logrus.Warnf("scale event of %s %s(%s) to %d replicas timed out", s.kindName(), e.key.name, e.key.namespace, e.key.replicas)
+			if e.experiment != "" {
+				experiments.fail(e.experiment, fmt.Sprintf("the pods didn't start in %v", scaleEventTimeout))
+			}
+			continue
+		}
+		l, ok := e.latency(byUID)
+		if !ok {
+			open = append(open, e)
+			continue
+		}
+		ds.bySource = l
+		latency := l.node
+		if scaleTimeSource == scaleTimeReceive && l.received {
+			latency = l.receive
+		}
+		ds.latency, ds.measured = smoother.smooth(smoothKey{metric: smoothedScale, kind: s.kind, deployKey: e.key.deployKey}, latency), true
+		ds.history = append(ds.history, scaleSample{pods: e.expected, latency: latency})
+		if len(ds.history) > scaleHistoryLength {
+			ds.history = ds.history[len(ds.history)-scaleHistoryLength:]
+		}
+		if s.kind == "" {
+			if deployScaleLatencyByStep != nil {
+				deployScaleLatencyByStep.WithLabelValues(e.key.name, e.key.namespace, e.key.cluster, stepBucket(e.expected)).Observe(latency)
+			}
+			measurements.logScale(e.key.deployKey, latency)
+		}
+		m := measurement{
+			Kind:       measurementKindScale,
+			Workload:   s.kind,
+			Cluster:    e.key.cluster,
+			Namespace:  e.key.namespace,
+			Deployment: e.key.name,
+			Replicas:   e.key.replicas,
+			Pods:       e.expected,
+			LatencyMs:  latency,
+			Time:       clk.Now(),
+			Tags:       e.tags,
+		}
+		if ds.strategy != nil {
+			if strategyScaleLatency != nil {
+				strategyScaleLatency.WithLabelValues(ds.strategy.labelValues()...).Observe(latency)
+			}
+			m.Strategy, m.MaxSurge, m.MaxUnavailable = ds.strategy.Type, ds.strategy.MaxSurge, ds.strategy.MaxUnavailable
+		}
+		sessions.addMeasurement(m)
+		stream.publish(streamEventMeasurement, m)
+		if e.experiment != "" {
+			experiments.complete(e.experiment, m)
+		}
+		logrus.Debugf("%s %s(%s) scaled up by %d pods in %vms by the nodes and %vms by the exporter", s.kindName(), e.key.name, e.key.namespace, e.expected, l.node, l.receive)
+	}
+	ds.events = open
+}
+
+// scaleLatency is the time from a scale event being opened to the last
+// container of its pods being started by its node, and to the last of them
+// being received by the exporter. Both start on the clock of the exporter,
+// the node latency is clamped at 0 for a node whose clock is behind.
+type scaleLatency struct {
+	node    float64
+	receive float64
+	// received is false if any container has no receive time, e.g. the
+	// ones loaded from a file
+	received bool
+}
+
+// latency returns the latency of the event, it's not ok until all the pods
+// of the event have been created and all their containers received.
+func (e *scaleEvent) latency(pods map[types.UID]*corev1.Pod) (scaleLatency, bool) {
+	if len(e.pods) < e.expected {
+		return scaleLatency{}, false
+	}
+	var (
+		end      int64
+		received time.Time
+	)
+	l := scaleLatency{received: true}
+	for uid := range e.pods {
+		p, exists := pods[uid]
+		if !exists {
+			// the pod is gone before it started, ignore it
+			continue
+		}
+		records, ok := podStartupRecords(p)
+		if !ok {
+			return scaleLatency{}, false
+		}
+		for _, r := range records {
+			if r.End > end {
+				end = r.End
+			}
+			if r.Received.IsZero() {
+				l.received = false
+			} else if r.Received.After(received) {
+				received = r.Received
+			}
+		}
+	}
+	if end == 0 {
+		return scaleLatency{}, false
+	}
+	l.node = math.Max(0, float64(end-e.opened.UnixNano())/float64(time.Millisecond))
+	if l.received {
+		l.receive = math.Max(0, float64(received.Sub(e.opened))/float64(time.Millisecond))
+	}
+	return l, true
+}
+
+// podStartupRecords returns the startup records of the containers of the pod
+// except sidecars, it's not ok until all of them are received.
+func podStartupRecords(p *corev1.Pod) ([]startupRecord, bool) {
+	var records []startupRecord
+	targetLen := 0
+	for _, container := range p.Spec.Containers {
+		if !isSidecar(container.Name, container.Image) {
+			targetLen++
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, status := range p.Status.ContainerStatuses {
+		if isSidecar(status.Name, status.Image) || !strings.HasPrefix(status.ContainerID, containerNamePrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(status.ContainerID, containerNamePrefix)
+		if info, exists := podContainer(name); exists {
+			records = append(records, info)
+		}
+	}
+	return records, len(records) == targetLen && targetLen > 0
+}
+
+// expect tags the scale-up of the deployment to the replicas with the
+// experiment requesting it, it returns false if the deployment isn't tracked
+// yet.
+func (s *scaleTracker) expect(k deployKey, replicas int32, experiment string, tags map[string]string) bool {
+	s.Lock()
+	defer s.Unlock()
+	ds, tracked := s.deploys[k]
+	if !tracked {
+		return false
+	}
+	ds.expected = append(ds.expected, scaleExpectation{replicas: replicas, experiment: experiment, tags: tags})
+	return true
+}
+
+func (s *scaleTracker) unexpect(k deployKey, experiment string) {
+	s.Lock()
+	defer s.Unlock()
+	ds, tracked := s.deploys[k]
+	if !tracked {
+		return
+	}
+	for i, x := range ds.expected {
+		if x.experiment == experiment {
+			ds.expected = append(ds.expected[:i], ds.expected[i+1:]...)
+			return
+		}
+	}
+}
+
+// last returns the scale latency of the last scale event of the deployment.
+func (s *scaleTracker) last(k deployKey) (float64, bool) {
+	s.Lock()
+	defer s.Unlock()
+	if ds, exists := s.deploys[k]; exists && ds.measured {
+		return ds.latency, true
+	}
+	return 0, false
+}
+
+// export sets the scale latency of the last scale event of the deployments
+// and the predicted ones.
+func (s *scaleTracker) export() {
+	s.Lock()
+	defer s.Unlock()
+	for k, ds := range s.deploys {
+		if s.kind != "" {
+			if ds.measured {
+				workloadScaleLatency.WithLabelValues(s.kind, k.name, k.namespace, k.cluster).Set(ds.latency)
+			}
+			continue
+		}
+		if ds.measured {
+			deployScaleLatency.WithLabelValues(k.name, k.namespace, k.cluster).Set(ds.latency)
+			if scaleTimeSource == scaleTimeReceive && ds.bySource.received {
+				deployScaleLatencyBySource.WithLabelValues(k.name, k.namespace, k.cluster, scaleTimeNode).Set(ds.bySource.node)
+				deployScaleLatencyBySource.WithLabelValues(k.name, k.namespace, k.cluster, scaleTimeReceive).Set(ds.bySource.receive)
+			}
+		}
+		if ds.downMeasured {
+			deployScaleDownDuration.WithLabelValues(k.name, k.namespace, k.cluster).Set(ds.downDuration)
+		}
+		exportPredictions(k, ds.history)
+	}
+}
+
+// prune forgets the deployments which don't exist anymore.
+func (s *scaleTracker) prune(existing map[deployKey]struct{}) {
+	s.Lock()
+	defer s.Unlock()
+	for k := range s.deploys {
+		if _, exists := existing[k]; !exists {
+			delete(s.deploys, k)
+		}
+	}
+}
+
+// reset forgets the measured scale events, the open ones are still measured.
+func (s *scaleTracker) reset() {
+	s.Lock()
+	defer s.Unlock()
+	for _, ds := range s.deploys {
+		ds.latency, ds.measured, ds.history = 0, false, nil
+		ds.downDuration, ds.downMeasured = 0, false
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestScaleLatencyBySource(t *testing.T) {
+	resetRecords()
+	defer resetRecords()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	received := map[string]time.Time{
+		"a": start.Add(1500 * time.Millisecond),
+		// the node of b is a second ahead of the exporter
+		"b": start.Add(1200 * time.Millisecond),
+	}
+	pods := map[types.UID]*corev1.Pod{}
+	e := &scaleEvent{expected: 2, opened: start.Add(-500 * time.Millisecond), pods: map[types.UID]struct{}{}}
+	for i, name := range []string{"a", "b"} {
+		mu.Lock()
+		allInfo.put(meta{name: name, namespace: defaultContainerdK8sNamespace}, startupRecord{
+			Name:      name,
+			Namespace: defaultContainerdK8sNamespace,
+			Start:     start.Add(time.Duration(i) * 100 * time.Millisecond).UnixNano(),
+			End:       start.Add(time.Duration(i+1) * time.Second).UnixNano(),
+			Received:  received[name],
+		})
+		mu.Unlock()
+		uid := types.UID(name)
+		pods[uid] = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{UID: uid},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: "app", ContainerID: containerNamePrefix + name}}},
+		}
+		e.pods[uid] = struct{}{}
+	}
+	l, ok := e.latency(pods)
+	if !ok || l.node != 2500 || !l.received || l.receive != 2000 {
+		t.Errorf("got %+v, want 2500ms by the nodes and 2000ms to the last receive, from the event being opened", l)
+	}
+
+	mu.Lock()
+	r, _ := allInfo.get(meta{name: "b", namespace: defaultContainerdK8sNamespace})
+	r.Received = time.Time{}
+	allInfo.put(meta{name: "b", namespace: defaultContainerdK8sNamespace}, r)
+	mu.Unlock()
+	if l, ok := e.latency(pods); !ok || l.received || l.receive != 0 {
+		t.Errorf("got %+v, want no receive latency for a record without a receive time", l)
+	}
+}
+
+func TestScaleTrackerSetsStrategyOfNewDeployment(t *testing.T) {
+	c := fakeClock(t)
+	s := newScaleTracker("")
+	c.Advance(time.Minute)
+	strategy := deployStrategy{Type: "Recreate"}
+	key := scaleKey{deployKey: deployKey{meta: meta{name: "web", namespace: "default"}}, replicas: 1}
+	s.trackStrategy(&cluster{}, key, clk.Now(), nil, 0, &strategy)
+	if ds := s.deploys[key.deployKey]; ds.strategy == nil || *ds.strategy != strategy {
+		t.Errorf("got strategy %v, want it set when the deployment is first tracked", ds.strategy)
+	}
+}
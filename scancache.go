@@ -0,0 +1,79 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	defaultFullScanInterval = 1 * time.Minute
+	// emptyBundleTTL is how long a bundle without startup files is not
+	// read again if its mtime doesn't change
+	emptyBundleTTL = 30 * time.Second
+)
+
+// scanCache remembers the mtimes of the dirs under the task roots, so dirs
+// which haven't changed since the last scan are not read again. A bundle dir
+// doesn't change its mtime when a startup file is written in place, hence
+// only complete and empty bundles are skipped, the empty ones for a while,
+// and the whole cache is dropped once in a while. A new start attempt
+// creates a startup file, which changes the mtime of a complete bundle, it's
+// read again by the next full scan or once its namespace dir changes.
+var scanCache = scanState{
+	namespaces: map[string]*namespaceScan{},
+}
+
+type scanState struct {
+	// namespaces are keyed by their path
+	namespaces       map[string]*namespaceScan
+	fullScanInterval time.Duration
+	lastFullScan     time.Time
+}
+
+type namespaceScan struct {
+	mtime   time.Time
+	bundles map[string]*bundleScan
+}
+
+type bundleScan struct {
+	mtime    time.Time
+	scanned  time.Time
+	info     []containerStartupInfo
+	complete bool
+	// empty bundles have no startup file at all
+	empty bool
+}
+
+// expire drops the cache if a full scan is due.
+func (s *scanState) expire() {
+	if clk.Since(s.lastFullScan) < s.fullScanInterval {
+		return
+	}
+	s.namespaces = map[string]*namespaceScan{}
+	s.lastFullScan = clk.Now()
+}
+
+func (n *namespaceScan) bundle(name string) (*bundleScan, bool) {
+	if n == nil {
+		return nil, false
+	}
+	b, exists := n.bundles[name]
+	return b, exists
+}
+
+// fresh reports whether the bundle with the mtime needn't be read again.
+func (b *bundleScan) fresh(mtime time.Time) bool {
+	if !b.mtime.Equal(mtime) {
+		return false
+	}
+	return b.complete || b.empty && clk.Since(b.scanned) < emptyBundleTTL
+}
+
+// scan returns the cached scan of the bundle if it's fresh, or reads it.
+func (n *namespaceScan) scan(root, namespace, name string, mtime time.Time) *bundleScan {
+	if old, exists := n.bundle(name); exists && old.fresh(mtime) {
+		return old
+	}
+	b := scanBundle(root, namespace, name)
+	b.mtime, b.scanned = mtime, clk.Now()
+	return b
+}
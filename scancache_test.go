@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/YLonely/startup-exporter/pkg/shimhook"
+)
+
+func TestCollectRescansChangedBundles(t *testing.T) {
+	c := fakeClock(t)
+	defer func(n map[string]*namespaceScan) { scanCache.namespaces = n }(scanCache.namespaces)
+	scanCache.namespaces = map[string]*namespaceScan{}
+	root, err := ioutil.TempDir("", "scancache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	running, empty := path.Join(root, "k8s.io", "running"), path.Join(root, "k8s.io", "empty")
+	for _, dir := range []string{running, empty} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(p string) {
+		if err := ioutil.WriteFile(p, []byte("1\n2\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// touch sets the mtime of the bundle as filesystems with a coarse mtime
+	// would leave it
+	touch := func(dir string, mtime time.Time) {
+		if err := os.Chtimes(dir, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(path.Join(running, shimhook.StartupFileName))
+	mtime := time.Now().Add(-time.Hour)
+	touch(running, mtime)
+	touch(empty, mtime)
+	if info := collect(root, "k8s.io"); len(info) != 1 {
+		t.Fatalf("collected %d records, want 1", len(info))
+	}
+
+	// a restart adds a startup file to the complete bundle, which is not
+	// stat'ed again until the next full scan
+	write(path.Join(running, shimhook.StartupFileName+".1"))
+	touch(running, mtime.Add(time.Second))
+	if info := collect(root, "k8s.io"); len(info) != 1 {
+		t.Errorf("collected %d records, want the complete bundle to be cached", len(info))
+	}
+	scanCache.expire()
+	if info := collect(root, "k8s.io"); len(info) != 2 {
+		t.Errorf("collected %d records after a full scan, want 2", len(info))
+	}
+
+	write(path.Join(empty, shimhook.StartupFileName))
+	touch(empty, mtime)
+	if info := collect(root, "k8s.io"); len(info) != 2 {
+		t.Errorf("collected %d records, want the empty bundle to be cached", len(info))
+	}
+	c.Advance(emptyBundleTTL)
+	if info := collect(root, "k8s.io"); len(info) != 3 {
+		t.Errorf("collected %d records, want the empty bundle to be read again after the TTL", len(info))
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	measurementKindScale       = "scale"
+	measurementKindSelfHealing = "self-healing"
+
+	// maxSessionRecords bounds the records a session keeps, later ones are
+	// dropped
+	maxSessionRecords = 100000
+)
+
+var sessionDroppedRecords = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "session_dropped_records_total",
+	},
+)
+
+// measurement is a completed scale event of a deployment, or the replacement
+// of its deleted pods.
+type measurement struct {
+	Kind string `json:"kind"`
+	// Workload is the kind of the workload if it's not a deployment
+	Workload   string    `json:"workload,omitempty"`
+	Cluster    string    `json:"cluster,omitempty"`
+	Namespace  string    `json:"namespace"`
+	Deployment string    `json:"deployment"`
+	Replicas   int32     `json:"replicas"`
+	Pods       int       `json:"pods"`
+	LatencyMs  float64   `json:"latencyMs"`
+	Time       time.Time `json:"time"`
+	// Tags are set by the experiment which caused the measurement
+	Tags map[string]string `json:"tags,omitempty"`
+	// Strategy, MaxSurge and MaxUnavailable are the strategy of the
+	// deployment a scale measurement is of
+	Strategy       string `json:"strategy,omitempty"`
+	MaxSurge       string `json:"maxSurge,omitempty"`
+	MaxUnavailable string `json:"maxUnavailable,omitempty"`
+}
+
+// session scopes the startup records and measurements of an experiment, so
+// experiments running on the same cluster at the same time don't mix.
+type session struct {
+	Name string `json:"name"`
+	// Namespaces limits the records and measurements of the session to pods
+	// and deployments in these namespaces, all namespaces if empty
+	Namespaces     []string        `json:"namespaces,omitempty"`
+	Started        time.Time       `json:"started"`
+	Stopped        *time.Time      `json:"stopped,omitempty"`
+	Records        []startupRecord `json:"records,omitempty"`
+	DroppedRecords int             `json:"droppedRecords,omitempty"`
+	Measurements   []measurement   `json:"measurements"`
+}
+
+type sessionSummary struct {
+	Name    string     `json:"name"`
+	Started time.Time  `json:"started"`
+	Stopped *time.Time `json:"stopped,omitempty"`
+	Records int        `json:"records"`
+	// DroppedRecords are the records over maxSessionRecords
+	DroppedRecords int     `json:"droppedRecords,omitempty"`
+	AvgLatencyMs   float64 `json:"avgLatencyMs"`
+	MaxLatencyMs   float64 `json:"maxLatencyMs"`
+	Measurements   int     `json:"measurements"`
+}
+
+func (s *session) active() bool {
+	return s.Stopped == nil
+}
+
+func (s *session) includes(namespace string) bool {
+	if len(s.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range s.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *session) summary() sessionSummary {
+	sum := sessionSummary{
+		Name:           s.Name,
+		Started:        s.Started,
+		Stopped:        s.Stopped,
+		Records:        len(s.Records),
+		DroppedRecords: s.DroppedRecords,
+		Measurements:   len(s.Measurements),
+	}
+	var total float64
+	for _, r := range s.Records {
+		l := r.milliseconds()
+		total += l
+		if l > sum.MaxLatencyMs {
+			sum.MaxLatencyMs = l
+		}
+	}
+	if len(s.Records) > 0 {
+		sum.AvgLatencyMs = total / float64(len(s.Records))
+	}
+	return sum
+}
+
+type sessionStore struct {
+	sync.Mutex
+	sessions map[string]*session
+}
+
+var sessions = sessionStore{
+	sessions: map[string]*session{},
+}
+
+// addRecord adds a received startup record to the active sessions which
+// include the namespace of its pod, a session with maxSessionRecords drops
+// it.
+func (s *sessionStore) addRecord(r startupRecord) {
+	s.Lock()
+	defer s.Unlock()
+	for _, sess := range s.sessions {
+		if !sess.active() || !sess.includes(r.PodNamespace) {
+			continue
+		}
+		if len(sess.Records) >= maxSessionRecords {
+			sess.DroppedRecords++
+			sessionDroppedRecords.Inc()
+			continue
+		}
+		sess.Records = append(sess.Records, r)
+	}
+}
+
+// addMeasurement adds a completed scale event to the active sessions which
+// include the namespace of the deployment.
+func (s *sessionStore) addMeasurement(m measurement) {
+	s.Lock()
+	defer s.Unlock()
+	for _, sess := range s.sessions {
+		if sess.active() && sess.includes(m.Namespace) {
+			sess.Measurements = append(sess.Measurements, m)
+		}
+	}
+}
+
+// handleSessions serves the sessions API. Sessions are listed with GET and
+// started with POST on /api/v1/sessions, a session is got with GET or deleted
+// with DELETE on /api/v1/sessions/{name} and stopped with POST on
+// /api/v1/sessions/{name}/stop. The records and measurements of a session are
+// paged with GET on /api/v1/sessions/{name}/records and
+// /api/v1/sessions/{name}/measurements.
+func handleSessions(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/sessions"), "/"), "/")
+	name := parts[0]
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		listSessions(w)
+	case name == "" && r.Method == http.MethodPost:
+		startSession(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		getSession(w, name)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		sessions.Lock()
+		_, exists := sessions.sessions[name]
+		delete(sessions.sessions, name)
+		sessions.Unlock()
+		if !exists {
+			writeError(w, http.StatusNotFound, "session not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[1] == "stop" && r.Method == http.MethodPost:
+		stopSession(w, name)
+	case len(parts) == 2 && (parts[1] == "records" || parts[1] == "measurements") && r.Method == http.MethodGet:
+		listSessionItems(w, r, name, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, "unknown route")
+	}
+}
+
+func listSessions(w http.ResponseWriter) {
+	sessions.Lock()
+	defer sessions.Unlock()
+	list := []sessionSummary{}
+	for _, sess := range sessions.sessions {
+		list = append(list, sess.summary())
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func startSession(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name       string   `json:"name"`
+		Namespaces []string `json:"namespaces"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeError(w, http.StatusBadRequest, "a session name must be provided")
+		return
+	}
+	sessions.Lock()
+	defer sessions.Unlock()
+	if _, exists := sessions.sessions[req.Name]; exists {
+		writeError(w, http.StatusConflict, "session already exists")
+		return
+	}
+	sess := &session{
+		Name:         req.Name,
+		Namespaces:   req.Namespaces,
+		Started:      clk.Now(),
+		Measurements: []measurement{},
+	}
+	sessions.sessions[req.Name] = sess
+	writeJSON(w, http.StatusCreated, sess.summary())
+}
+
+func getSession(w http.ResponseWriter, name string) {
+	sessions.Lock()
+	defer sessions.Unlock()
+	sess, exists := sessions.sessions[name]
+	if !exists {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, sess)
+}
+
+func stopSession(w http.ResponseWriter, name string) {
+	sessions.Lock()
+	defer sessions.Unlock()
+	sess, exists := sessions.sessions[name]
+	if !exists {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	if sess.active() {
+		now := clk.Now()
+		sess.Stopped = &now
+	}
+	writeJSON(w, http.StatusOK, sess.summary())
+}
+
+func listSessionItems(w http.ResponseWriter, r *http.Request, name, kind string) {
+	sessions.Lock()
+	sess, exists := sessions.sessions[name]
+	var items []listItem
+	if exists && kind == "records" {
+		// the items are only appended to, so their indexes identify them
+		for i, record := range sess.Records {
+			items = append(items, listItem{value: record, name: fmt.Sprintf("%010d", i), latency: record.milliseconds(), time: record.Received})
+		}
+	} else if exists {
+		for i, m := range sess.Measurements {
+			items = append(items, listItem{value: m, name: fmt.Sprintf("%010d", i), latency: m.LatencyMs, time: m.Time})
+		}
+	}
+	sessions.Unlock()
+	if !exists {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	writeList(w, r, items)
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestSessionRecordsFilteredAndCapped(t *testing.T) {
+	defer func(s map[string]*session) { sessions.sessions = s }(sessions.sessions)
+	all, filtered := &session{Name: "all"}, &session{Name: "filtered", Namespaces: []string{"bench"}}
+	sessions.sessions = map[string]*session{all.Name: all, filtered.Name: filtered}
+
+	sessions.addRecord(startupRecord{Name: "a", PodNamespace: "bench"})
+	sessions.addRecord(startupRecord{Name: "b", PodNamespace: "default"})
+	if len(all.Records) != 2 || len(filtered.Records) != 1 || filtered.Records[0].Name != "a" {
+		t.Errorf("got %d and %d records, want the filtered session to only have the one in its namespace", len(all.Records), len(filtered.Records))
+	}
+
+	all.Records = make([]startupRecord, maxSessionRecords)
+	sessions.addRecord(startupRecord{Name: "c", PodNamespace: "bench"})
+	if len(all.Records) != maxSessionRecords || all.summary().DroppedRecords != 1 {
+		t.Errorf("got %d records and %d dropped over the cap", len(all.Records), all.DroppedRecords)
+	}
+}
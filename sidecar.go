@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+)
+
+const (
+	defaultRegistry  = "docker.io"
+	defaultNamespace = "library"
+)
+
+// sidecars holds the container names and images which are treated as
+// sidecars, e.g. istio-proxy or docker.io/istio/proxyv2.
+var sidecars []string
+
+// isSidecar reports whether a container with the name and image should be
+// excluded from the deployment aggregation. An image matches regardless of
+// its tag or digest and of the default registry being spelled out, as the
+// images of a pod spec and of its container statuses differ in both.
+func isSidecar(name, image string) bool {
+	repo := imageRepository(image)
+	for _, s := range sidecars {
+		if s == name || s == image || imageRepository(s) == repo {
+			return true
+		}
+	}
+	return false
+}
+
+// imageRepository returns the fully qualified repository of an image
+// reference without its tag or digest, e.g. docker.io/library/nginx for
+// nginx:1.19.
+func imageRepository(image string) string {
+	repo := image
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo = repo[:i]
+	}
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	// the first component is a registry only if it looks like a host
+	i := strings.Index(repo, "/")
+	if i < 0 || !strings.ContainsAny(repo[:i], ".:") && repo[:i] != "localhost" {
+		repo = defaultRegistry + "/" + repo
+	}
+	if strings.HasPrefix(repo, "index.docker.io/") {
+		repo = defaultRegistry + strings.TrimPrefix(repo, "index.docker.io")
+	}
+	if strings.HasPrefix(repo, defaultRegistry+"/") && strings.Count(repo, "/") == 1 {
+		repo = defaultRegistry + "/" + defaultNamespace + strings.TrimPrefix(repo, defaultRegistry)
+	}
+	return repo
+}
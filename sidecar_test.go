@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestIsSidecar(t *testing.T) {
+	defer func(s []string) { sidecars = s }(sidecars)
+	sidecars = []string{"docker.io/istio/proxyv2", "nginx", "linkerd-proxy"}
+	for _, c := range []struct {
+		name, image string
+		sidecar     bool
+	}{
+		{"proxy", "istio/proxyv2:1.20", true},
+		{"proxy", "docker.io/istio/proxyv2:1.20", true},
+		{"proxy", "index.docker.io/istio/proxyv2@sha256:abc", true},
+		{"web", "nginx:1.19", true},
+		{"web", "docker.io/library/nginx", true},
+		{"web", "registry.local:5000/nginx:1.19", false},
+		{"linkerd-proxy", "cr.l5d.io/linkerd/proxy:stable", true},
+		{"app", "istio/pilot:1.20", false},
+	} {
+		if got := isSidecar(c.name, c.image); got != c.sidecar {
+			t.Errorf("isSidecar(%q, %q) = %v, want %v", c.name, c.image, got, c.sidecar)
+		}
+	}
+}
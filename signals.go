@@ -2,16 +2,10 @@ package main
 
 import (
 	"os"
-	"syscall"
 
 	"github.com/sirupsen/logrus"
 )
 
-var handledSignals = []os.Signal{
-	syscall.SIGTERM,
-	syscall.SIGINT,
-}
-
 func handleSignals(signals chan os.Signal) chan struct{} {
 	done := make(chan struct{}, 1)
 	go func() {
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var handledSignals = []os.Signal{
+	syscall.SIGTERM,
+	syscall.SIGINT,
+}
@@ -0,0 +1,9 @@
+package main
+
+import (
+	"os"
+)
+
+var handledSignals = []os.Signal{
+	os.Interrupt,
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+const (
+	smoothedAverageStartup = "average_startup"
+	smoothedScale          = "scale"
+)
+
+type smoothKey struct {
+	metric string
+	// kind is the kind of the workload if it's not a deployment
+	kind string
+	deployKey
+}
+
+// gaugeSmoother smooths the values of deployment gauges, so they don't flap
+// when the pods of a deployment churn slightly.
+type gaugeSmoother struct {
+	sync.Mutex
+	// factor is the weight of a new value in the exponential moving average,
+	// 1 disables the smoothing
+	factor float64
+	// minChange is the min change of the value in milliseconds to update
+	// the gauge
+	minChange float64
+	last      map[smoothKey]smoothedValue
+}
+
+// smoothedValue is the moving average of a gauge and the value the gauge is
+// set to, which only follows the average once it moved by minChange.
+type smoothedValue struct {
+	average float64
+	emitted float64
+}
+
+var smoother = gaugeSmoother{
+	factor: 1,
+	last:   map[smoothKey]smoothedValue{},
+}
+
+// smooth returns the value the gauge is set to for the new value.
+func (s *gaugeSmoother) smooth(k smoothKey, v float64) float64 {
+	s.Lock()
+	defer s.Unlock()
+	last, exists := s.last[k]
+	if !exists {
+		s.last[k] = smoothedValue{average: v, emitted: v}
+		return v
+	}
+	last.average = s.factor*v + (1-s.factor)*last.average
+	if math.Abs(last.average-last.emitted) >= s.minChange {
+		last.emitted = last.average
+	}
+	s.last[k] = last
+	return last.emitted
+}
+
+// prune forgets the workloads of the kind which don't exist anymore.
+func (s *gaugeSmoother) prune(kind string, existing map[deployKey]struct{}) {
+	s.Lock()
+	defer s.Unlock()
+	for k := range s.last {
+		if k.kind != kind {
+			continue
+		}
+		if _, exists := existing[k.deployKey]; !exists {
+			delete(s.last, k)
+		}
+	}
+}
+
+func (s *gaugeSmoother) reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.last = map[smoothKey]smoothedValue{}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestSmoothStepChange(t *testing.T) {
+	s := gaugeSmoother{factor: 0.1, minChange: 50, last: map[smoothKey]smoothedValue{}}
+	k := smoothKey{metric: smoothedScale}
+	if v := s.smooth(k, 1000); v != 1000 {
+		t.Fatalf("first value smoothed to %v", v)
+	}
+	// a step of 100ms moves the average by less than minChange at first
+	if v := s.smooth(k, 1100); v != 1000 {
+		t.Errorf("the gauge moved by %v, less than the min change", v-1000)
+	}
+	v := 0.0
+	for i := 0; i < 50; i++ {
+		v = s.smooth(k, 1100)
+	}
+	if v < 1050 {
+		t.Errorf("the gauge is %v after a persistent step to 1100", v)
+	}
+}
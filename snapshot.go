@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+
+	"github.com/YLonely/startup-exporter/pkg/shimhook"
+)
+
+const snapshotUnknown = "unknown"
+
+// imageStarts remembers the first start of every image the collector has
+// seen on the node, a container started after another one of the same image
+// reuses the snapshot of the image.
+type imageStarts struct {
+	// started is when the collector started in milliseconds, nothing is
+	// known about the containers which were gone before it
+	started int64
+	first   map[string]int64
+}
+
+var images = imageStarts{
+	started: clk.Now().UnixNano() / int64(time.Millisecond),
+	first:   map[string]int64{},
+}
+
+// classify sets whether the containers reuse the snapshot of their image,
+// unless their shim tells.
+func (s *imageStarts) classify(info []containerStartupInfo) {
+	for _, i := range info {
+		if i.Image == "" {
+			continue
+		}
+		if first, exists := s.first[i.Image]; !exists || i.Start < first {
+			s.first[i.Image] = i.Start
+		}
+	}
+	for n, i := range info {
+		switch {
+		case i.Extras[shimhook.ExtraSnapshot] != "":
+			info[n].Snapshot = i.Extras[shimhook.ExtraSnapshot]
+		case i.Image == "":
+			info[n].Snapshot = snapshotUnknown
+		case i.Start > s.first[i.Image]:
+			info[n].Snapshot = shimhook.SnapshotReused
+		case i.Start >= s.started:
+			// the first container of the image since the collector started
+			info[n].Snapshot = shimhook.SnapshotNew
+		default:
+			info[n].Snapshot = snapshotUnknown
+		}
+	}
+}
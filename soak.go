@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	defaultSoakNamespace = "startup-exporter-soak"
+	defaultSoakImage     = "k8s.gcr.io/pause:3.2"
+
+	soakLabel = "startup-exporter.io/soak"
+	// soakPollInterval is how often the soak polls deployments and the
+	// exporter
+	soakPollInterval = 2 * time.Second
+	// minSoakGrowthSamples is how many samples after the warm-up the growth
+	// of the exporter is judged from
+	minSoakGrowthSamples = 3
+)
+
+var soakCmd = cli.Command{
+	Name:      "soak",
+	Usage:     "create, scale and delete deployments in a disposable namespace for a while and check the exporter stays bounded",
+	ArgsUsage: "EXPORTER_IP:PORT",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "kubeconfig,c",
+			Usage: "path to a kubeconfig",
+		},
+		cli.StringFlag{
+			Name:  "master",
+			Usage: "the address of the API server",
+		},
+		cli.StringFlag{
+			Name:  "namespace,n",
+			Usage: "namespace created for the soak and deleted after it, it must not exist",
+			Value: defaultSoakNamespace,
+		},
+		cli.StringFlag{
+			Name:  "image",
+			Usage: "image of the deployments",
+			Value: defaultSoakImage,
+		},
+		cli.DurationFlag{
+			Name:  "duration",
+			Usage: "how long the soak runs",
+			Value: 30 * time.Minute,
+		},
+		cli.IntFlag{
+			Name:  "replicas",
+			Usage: "replicas a deployment is scaled up to in a cycle",
+			Value: 5,
+		},
+		cli.DurationFlag{
+			Name:  "cycle-timeout",
+			Usage: "max time a deployment may take to become available",
+			Value: 5 * time.Minute,
+		},
+		cli.Float64Flag{
+			Name:  "max-memory",
+			Usage: "max resident memory of the exporter in MiB",
+			Value: 512,
+		},
+		cli.IntFlag{
+			Name:  "max-series",
+			Usage: "max number of series the exporter exposes",
+			Value: 10000,
+		},
+		cli.IntFlag{
+			Name:  "max-queue",
+			Usage: "max length of any queue of the exporter",
+			Value: 10000,
+		},
+		cli.IntFlag{
+			Name:  "warm-up-cycles",
+			Usage: "cycles before the growth of the exporter is measured, while its caches fill",
+			Value: 3,
+		},
+		cli.Float64Flag{
+			Name:  "max-memory-growth",
+			Usage: "max growth of the resident memory of the exporter in MiB per cycle after the warm-up",
+			Value: 1,
+		},
+		cli.Float64Flag{
+			Name:  "max-series-growth",
+			Usage: "max growth of the number of series the exporter exposes per cycle after the warm-up",
+			Value: 1,
+		},
+		cli.StringFlag{
+			Name:   "token",
+			Usage:  "bearer token to scrape the exporter with, e.g. one with the read role of its --authz-policy",
+			EnvVar: "STARTUP_EXPORTER_TOKEN",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		addr := context.Args().First()
+		if addr == "" {
+			return errors.New("address of exporter must be provided")
+		}
+		addr, err := exporterURL(addr)
+		if err != nil {
+			return err
+		}
+		replicas := context.Int("replicas")
+		if replicas <= 0 {
+			return errors.New("replicas must be positive")
+		}
+		config, err := clientcmd.BuildConfigFromFlags(context.String("master"), context.String("kubeconfig"))
+		if err != nil {
+			return err
+		}
+		kubeClient, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return err
+		}
+		s := &soak{
+			kubeClient: kubeClient,
+			metricsURL: strings.TrimSuffix(addr, "/") + "/metrics",
+			token:      context.String("token"),
+			namespace:  context.String("namespace"),
+			image:      context.String("image"),
+			replicas:   int32(replicas),
+			timeout:    context.Duration("cycle-timeout"),
+			limits: soakLimits{
+				memory: context.Float64("max-memory") * 1024 * 1024,
+				series: context.Int("max-series"),
+				queue:  context.Int("max-queue"),
+				// the growth is per cycle
+				memoryGrowth: context.Float64("max-memory-growth") * 1024 * 1024,
+				seriesGrowth: context.Float64("max-series-growth"),
+			},
+			warmUp: context.Int("warm-up-cycles"),
+		}
+		signalC := make(chan os.Signal, 1)
+		signal.Notify(signalC, handledSignals...)
+		defer signal.Stop(signalC)
+		return s.run(context.Duration("duration"), handleSignals(signalC))
+	},
+}
+
+type soakLimits struct {
+	memory       float64
+	series       int
+	queue        int
+	memoryGrowth float64
+	seriesGrowth float64
+}
+
+// soakSample is what the exporter exposes at a point of the soak.
+type soakSample struct {
+	memory float64
+	series int
+	queues map[string]float64
+}
+
+// soak runs create/scale/delete cycles of deployments while checking the
+// memory, series and queues of an exporter.
+type soak struct {
+	kubeClient kubernetes.Interface
+	metricsURL string
+	token      string
+	namespace  string
+	image      string
+	replicas   int32
+	timeout    time.Duration
+	limits     soakLimits
+	// warmUp is the number of cycles before the growth is measured
+	warmUp int
+}
+
+// run runs cycles for the duration or until done is closed, the namespace is
+// deleted either way.
+func (s *soak) run(duration time.Duration, done <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   s.namespace,
+		Labels: map[string]string{soakLabel: "true"},
+	}}
+	if _, err := s.kubeClient.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to create the namespace %s", s.namespace)
+	}
+	defer func() {
+		// the soak context may be canceled by now
+		if err := s.kubeClient.CoreV1().Namespaces().Delete(context.Background(), s.namespace, metav1.DeleteOptions{}); err != nil {
+			logrus.WithError(err).Errorf("failed to delete the namespace %s", s.namespace)
+		}
+	}()
+	first, err := s.check()
+	if err != nil {
+		return err
+	}
+	var (
+		deadline = clk.Now().Add(duration)
+		cycles   = 0
+		// grown holds the samples after the warm-up
+		grown []soakSample
+	)
+	for clk.Now().Before(deadline) {
+		if err := s.cycle(ctx, fmt.Sprintf("soak-%d", cycles)); err != nil {
+			if ctx.Err() != nil {
+				return errors.Errorf("soak interrupted in cycle %d", cycles)
+			}
+			return errors.Wrapf(err, "cycle %d failed", cycles)
+		}
+		cycles++
+		sample, err := s.check()
+		if err != nil {
+			return errors.Wrapf(err, "exporter unbounded after %d cycles", cycles)
+		}
+		if cycles >= s.warmUp {
+			grown = append(grown, sample)
+		}
+		logrus.WithFields(logrus.Fields{
+			"cycles": cycles,
+			"memory": sample.memory,
+			"series": sample.series,
+			"queues": sample.queues,
+		}).Info("soak cycle done")
+	}
+	if err := s.checkGrowth(grown); err != nil {
+		return errors.Wrapf(err, "exporter unbounded after %d cycles", cycles)
+	}
+	last, err := s.check()
+	if err != nil {
+		return err
+	}
+	logrus.Infof("soaked %d cycles, memory %.0f -> %.0f bytes, series %d -> %d", cycles, first.memory, last.memory, first.series, last.series)
+	return nil
+}
+
+// checkGrowth returns an error if the memory or the series of the exporter
+// grow faster than the limits over the cycles after the warm-up, a slow leak
+// under the absolute limits fails it.
+func (s *soak) checkGrowth(samples []soakSample) error {
+	if len(samples) < minSoakGrowthSamples {
+		logrus.Warnf("only %d cycles after the warm-up, the growth of the exporter isn't checked", len(samples))
+		return nil
+	}
+	memory, series := make([]float64, len(samples)), make([]float64, len(samples))
+	for i, sample := range samples {
+		memory[i], series[i] = sample.memory, float64(sample.series)
+	}
+	if growth := slope(memory); s.limits.memoryGrowth > 0 && growth > s.limits.memoryGrowth {
+		return errors.Errorf("resident memory grows by %.0f bytes per cycle, more than %.0f", growth, s.limits.memoryGrowth)
+	}
+	if growth := slope(series); s.limits.seriesGrowth > 0 && growth > s.limits.seriesGrowth {
+		return errors.Errorf("series grow by %.1f per cycle, more than %.1f", growth, s.limits.seriesGrowth)
+	}
+	return nil
+}
+
+// slope returns the least squares slope of the values over their indexes.
+func slope(values []float64) float64 {
+	n := float64(len(values))
+	var sumX, sumY, sumXY, sumXX float64
+	for i, y := range values {
+		x := float64(i)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+}
+
+// cycle creates a deployment with a replica, scales it up and down and
+// deletes it.
+func (s *soak) cycle(ctx context.Context, name string) error {
+	one := int32(1)
+	labels := map[string]string{soakLabel: name}
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &one,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "soak", Image: s.image}},
+				},
+			},
+		},
+	}
+	deployments := s.kubeClient.AppsV1().Deployments(s.namespace)
+	if _, err := deployments.Create(ctx, d, metav1.CreateOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to create the deployment %s", name)
+	}
+	for _, replicas := range []int32{one, s.replicas, one} {
+		if err := s.scale(ctx, name, replicas); err != nil {
+			return err
+		}
+	}
+	if err := deployments.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete the deployment %s", name)
+	}
+	return nil
+}
+
+// scale scales the deployment to the replicas and waits until they are all
+// available.
+func (s *soak) scale(ctx context.Context, name string, replicas int32) error {
+	deployments := s.kubeClient.AppsV1().Deployments(s.namespace)
+	scale, err := deployments.GetScale(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the scale of the deployment %s", name)
+	}
+	if scale.Spec.Replicas != replicas {
+		scale.Spec.Replicas = replicas
+		if _, err := deployments.UpdateScale(ctx, name, scale, metav1.UpdateOptions{}); err != nil {
+			return errors.Wrapf(err, "failed to scale the deployment %s", name)
+		}
+	}
+	deadline := clk.Now().Add(s.timeout)
+	for {
+		d, err := deployments.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to get the deployment %s", name)
+		}
+		if d.Status.ObservedGeneration >= d.Generation && d.Status.AvailableReplicas == replicas && d.Status.Replicas == replicas {
+			return nil
+		}
+		if clk.Now().After(deadline) {
+			return errors.Errorf("deployment %s has %d of %d replicas available after %v", name, d.Status.AvailableReplicas, replicas, s.timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clk.After(soakPollInterval):
+		}
+	}
+}
+
+// check scrapes the exporter and returns an error if it exceeds any limit.
+func (s *soak) check() (soakSample, error) {
+	sample, err := s.scrape()
+	if err != nil {
+		return sample, err
+	}
+	if s.limits.memory > 0 && sample.memory > s.limits.memory {
+		return sample, errors.Errorf("resident memory of %.0f bytes exceeds %.0f", sample.memory, s.limits.memory)
+	}
+	if s.limits.series > 0 && sample.series > s.limits.series {
+		return sample, errors.Errorf("%d series exceed %d", sample.series, s.limits.series)
+	}
+	for queue, length := range sample.queues {
+		if s.limits.queue > 0 && length > float64(s.limits.queue) {
+			return sample, errors.Errorf("queue %s of length %.0f exceeds %d", queue, length, s.limits.queue)
+		}
+	}
+	return sample, nil
+}
+
+func (s *soak) scrape() (soakSample, error) {
+	sample := soakSample{queues: map[string]float64{}}
+	req, err := http.NewRequest(http.MethodGet, s.metricsURL, nil)
+	if err != nil {
+		return sample, err
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return sample, errors.Wrap(err, "failed to scrape the exporter")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return sample, errors.Errorf("scraping the exporter returned %d", resp.StatusCode)
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return sample, errors.Wrap(err, "failed to parse the metrics of the exporter")
+	}
+	for name, family := range families {
+		sample.series += len(family.Metric)
+		switch name {
+		case "process_resident_memory_bytes":
+			if len(family.Metric) > 0 {
+				sample.memory = family.Metric[0].GetGauge().GetValue()
+			}
+		case metricsNamespace + "_queue_length":
+			for _, m := range family.Metric {
+				sample.queues[labelValue(m, "queue")] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	return sample, nil
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
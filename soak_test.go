@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestSoakFailsOnSteadyGrowth(t *testing.T) {
+	s := &soak{limits: soakLimits{memoryGrowth: 1024, seriesGrowth: 1}}
+	// the memory stays far under any absolute limit but keeps growing
+	var leaking, noisy []soakSample
+	for i := 0; i < 10; i++ {
+		leaking = append(leaking, soakSample{memory: float64(100<<20 + i*4096), series: 500})
+		noisy = append(noisy, soakSample{memory: float64(100<<20 + (i%2)*8192), series: 500 + i%2})
+	}
+	if err := s.checkGrowth(leaking); err == nil {
+		t.Error("a steady leak passes")
+	}
+	if err := s.checkGrowth(noisy); err != nil {
+		t.Errorf("noise without growth fails: %v", err)
+	}
+	if err := s.checkGrowth(leaking[:minSoakGrowthSamples-1]); err != nil {
+		t.Errorf("too few samples are judged: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// metricVec is a GaugeVec, a HistogramVec or a SummaryVec.
+type metricVec interface {
+	prometheus.Collector
+	Delete(prometheus.Labels) bool
+}
+
+// deployVecs returns the metrics labeled by deploy_name, namespace and
+// cluster, besides the ones of their own.
+func deployVecs() []metricVec {
+	vecs := []metricVec{
+		deployPodsAvgStartupLatency,
+		deploySidecarsAvgStartupLatency,
+		deployContainersAvgStartupLatency,
+		deployTypesAvgStartupLatency,
+		deployStuckContainers,
+		deployDegradedNodePods,
+		deployExcludedPods,
+		deploySkipped,
+		deployPrestartLatency,
+		deployAdmissionToStartLatency,
+		deployStartupProbeLatency,
+		deployScaleLatency,
+		deployScaleDownDuration,
+		deployScaleLatencyBySource,
+		deployPredictedScaleLatency,
+		deployLabels,
+		deployStrategyInfo,
+		deploySelfHealingLatency,
+		deployRolloutDuration,
+		deployRevisionLatencyDelta,
+		deployRevisionLatencyRatio,
+	}
+	if deployContainerStartupLatency != nil {
+		vecs = append(vecs, deployContainerStartupLatency, deployScaleLatencyByStep)
+	}
+	if deployContainerStartupQuantiles != nil {
+		vecs = append(vecs, deployContainerStartupQuantiles)
+	}
+	return vecs
+}
+
+// deleteSeries deletes the series of the metric whose labels include the
+// matching ones, whatever their other labels are.
+func deleteSeries(vec metricVec, matching prometheus.Labels) int {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		vec.Collect(ch)
+		close(ch)
+	}()
+	var matched []prometheus.Labels
+	for m := range ch {
+		var metric dto.Metric
+		if err := m.Write(&metric); err != nil {
+			continue
+		}
+		labels := prometheus.Labels{}
+		for _, l := range metric.Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+		match := true
+		for name, value := range matching {
+			if labels[name] != value {
+				match = false
+				break
+			}
+		}
+		if match {
+			matched = append(matched, labels)
+		}
+	}
+	// a series can't be deleted while the metric is being collected
+	for _, labels := range matched {
+		vec.Delete(labels)
+	}
+	return len(matched)
+}
+
+// watchDeletions deletes the series of deployments and pods as soon as they
+// are deleted, rather than leaving them to the next update.
+func watchDeletions(clusterName string, factory informers.SharedInformerFactory) {
+	factory.Apps().V1().Deployments().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			d, ok := obj.(*appsv1.Deployment)
+			if !ok {
+				return
+			}
+			matching := prometheus.Labels{"deploy_name": d.Name, "namespace": d.Namespace, "cluster": clusterName}
+			n := 0
+			for _, vec := range deployVecs() {
+				n += deleteSeries(vec, matching)
+			}
+			logrus.Debugf("deleted %d series of the deployment %s(%s)", n, d.Name, d.Namespace)
+		},
+	})
+	factory.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			p, ok := obj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+			deleteSeries(podStartupLatency, prometheus.Labels{"pod": p.Name, "namespace": p.Namespace, "cluster": clusterName})
+			verifier.podDeleted(p)
+		},
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsSubsystemContainerd = "containerd"
+
+var (
+	// standalone is true if the exporter runs without Kubernetes and
+	// aggregates containers by their containerd namespace and extras
+	standalone bool
+
+	standaloneAvgStartupLatency *prometheus.GaugeVec
+	standaloneContainers        *prometheus.GaugeVec
+)
+
+// registerStandalone registers the metrics of the standalone mode, labeled by
+// the containerd namespace and the extras with the keys.
+func registerStandalone(keys []string) error {
+	labelNames := []string{"namespace"}
+	for _, k := range keys {
+		labelNames = append(labelNames, extraLabelName(k))
+	}
+	standaloneAvgStartupLatency = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemContainerd,
+			Name:      "average_startup_latency_milliseconds",
+		},
+		labelNames,
+	)
+	standaloneContainers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemContainerd,
+			Name:      "containers",
+		},
+		labelNames,
+	)
+	if err := prometheus.Register(standaloneAvgStartupLatency); err != nil {
+		return err
+	}
+	return prometheus.Register(standaloneContainers)
+}
+
+// updateStandalone aggregates the received containers, by namespace and by
+// compose project, until done. There are
+// no pods to tell which containers are gone, so the records held are bounded
+// by the namespace quotas only.
+func updateStandalone(done <-chan struct{}) {
+	ticker := clk.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		exportStandalone()
+		exportProjects()
+		exportQueueLengths()
+		select {
+		case <-done:
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+func exportStandalone() {
+	type group struct {
+		total float64
+		count int
+	}
+	groups := map[string]*group{}
+	values := map[string][]string{}
+	mu.Lock()
+	allInfo.each(func(_ meta, r startupRecord) {
+		v := []string{r.Namespace}
+		for _, k := range extraLabels {
+			v = append(v, r.Extras[k])
+		}
+		key := strings.Join(v, "\x00")
+		g, exists := groups[key]
+		if !exists {
+			g = &group{}
+			groups[key] = g
+			values[key] = v
+		}
+		g.total += r.milliseconds()
+		g.count++
+	})
+	mu.Unlock()
+	standaloneAvgStartupLatency.Reset()
+	standaloneContainers.Reset()
+	for key, g := range groups {
+		standaloneAvgStartupLatency.WithLabelValues(values[key]...).Set(g.total / float64(g.count))
+		standaloneContainers.WithLabelValues(values[key]...).Set(float64(g.count))
+	}
+}
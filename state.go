@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+const defaultStateInterval = 30 * time.Second
+
+var (
+	stateRecordsBucket     = []byte("records")
+	stateDeploymentsBucket = []byte("deployments")
+)
+
+// exporterState is what the exporter knows apart from its metrics, the
+// startup records and the published measurements of deployments.
+type exporterState struct {
+	Records     []startupRecord    `json:"records"`
+	Deployments []deploymentStatus `json:"deployments"`
+}
+
+func currentState() exporterState {
+	st := exporterState{Records: []startupRecord{}, Deployments: []deploymentStatus{}}
+	mu.Lock()
+	allInfo.each(func(_ meta, r startupRecord) {
+		st.Records = append(st.Records, r)
+	})
+	mu.Unlock()
+	deployStatuses.Lock()
+	for _, status := range deployStatuses.deploys {
+		st.Deployments = append(st.Deployments, status)
+	}
+	deployStatuses.Unlock()
+	return st
+}
+
+// restore puts the records into the exporter and sets the published
+// measurements of the state. The records are restored as they were rather
+// than ingested, so they aren't sent to the mirror, the stream, the
+// sessions and the event store again.
+func (st exporterState) restore() {
+	mu.Lock()
+	for _, r := range st.Records {
+		m := meta{name: r.Name, namespace: r.Namespace}
+		old, exists := allInfo.get(m)
+		seenAttempts[m] = seenAttempts[m].add(r.Attempt)
+		if exists && old.Attempt >= r.Attempt {
+			continue
+		}
+		if !exists {
+			quotas.hold(m, quotaNamespace(r))
+		}
+		verifier.add(m)
+		for _, evicted := range allInfo.put(m, r) {
+			forget(evicted)
+		}
+		lastSeen[m] = clk.Now()
+		state.put(r)
+	}
+	mu.Unlock()
+	deployStatuses.Lock()
+	for _, status := range st.Deployments {
+		deployStatuses.deploys[deployKey{cluster: status.Cluster, meta: meta{name: status.Name, namespace: status.Namespace}}] = status
+	}
+	deployStatuses.Unlock()
+}
+
+// stateStore persists the startup records and the published measurements of
+// deployments to a bbolt file, so a restarted exporter still measures the
+// deployments whose containers started before it restarted. The records put
+// and removed since the last save are written every interval and on
+// shutdown, the measurements which changed along with them.
+type stateStore struct {
+	// the mutex guards the changes and the file, as records are put with
+	// mu held it's never held while writing
+	sync.Mutex
+	// saving serializes the saves
+	saving   sync.Mutex
+	db       *bolt.DB
+	interval time.Duration
+	// changed holds the records put since the last save by namespace/name,
+	// nil for the removed ones
+	changed map[string]*startupRecord
+	// cleared is true if all the records were removed since the last save
+	cleared bool
+	// deploys holds the measurements of deployments as saved, it's
+	// guarded by saving
+	deploys map[string][]byte
+}
+
+var state = stateStore{
+	interval: defaultStateInterval,
+	changed:  map[string]*startupRecord{},
+	deploys:  map[string][]byte{},
+}
+
+func stateRecordKey(m meta) string {
+	return m.namespace + "/" + m.name
+}
+
+// put records a record to be saved, it's called with mu held.
+func (s *stateStore) put(r startupRecord) {
+	s.Lock()
+	defer s.Unlock()
+	if s.db != nil {
+		s.changed[stateRecordKey(meta{name: r.Name, namespace: r.Namespace})] = &r
+	}
+}
+
+// remove records a record to be deleted, it's called with mu held.
+func (s *stateStore) remove(m meta) {
+	s.Lock()
+	defer s.Unlock()
+	if s.db != nil {
+		s.changed[stateRecordKey(m)] = nil
+	}
+}
+
+// clear records that all the records are to be deleted.
+func (s *stateStore) clear() {
+	s.Lock()
+	defer s.Unlock()
+	if s.db != nil {
+		s.changed = map[string]*startupRecord{}
+		s.cleared = true
+	}
+}
+
+// open opens the state file, creating it if it doesn't exist, and loads the
+// state saved in it.
+func (s *stateStore) open(path string) (int, int, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return 0, 0, err
+	}
+	var st exporterState
+	deploys := map[string][]byte{}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(stateRecordsBucket)
+		if err != nil {
+			return err
+		}
+		if err := b.ForEach(func(k, v []byte) error {
+			var r startupRecord
+			if err := json.Unmarshal(v, &r); err != nil {
+				return errors.Wrapf(err, "invalid record %s", k)
+			}
+			st.Records = append(st.Records, r)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if b, err = tx.CreateBucketIfNotExists(stateDeploymentsBucket); err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var status deploymentStatus
+			if err := json.Unmarshal(v, &status); err != nil {
+				return errors.Wrapf(err, "invalid deployment %s", k)
+			}
+			st.Deployments = append(st.Deployments, status)
+			deploys[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return 0, 0, err
+	}
+	// the records are restored before the file is set, so they aren't
+	// written back
+	st.restore()
+	s.saving.Lock()
+	s.deploys = deploys
+	s.saving.Unlock()
+	s.Lock()
+	s.db = db
+	s.Unlock()
+	return len(st.Records), len(st.Deployments), nil
+}
+
+// run saves the state every interval until done.
+func (s *stateStore) run(done <-chan struct{}) {
+	ticker := clk.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C():
+			if err := s.save(); err != nil {
+				logrus.WithError(err).Error("failed to save the state")
+			}
+		}
+	}
+}
+
+// save writes the records changed since the last save and the measurements
+// which changed since.
+func (s *stateStore) save() error {
+	s.saving.Lock()
+	defer s.saving.Unlock()
+	s.Lock()
+	db := s.db
+	changed, cleared := s.changed, s.cleared
+	s.changed, s.cleared = map[string]*startupRecord{}, false
+	s.Unlock()
+	if db == nil {
+		return nil
+	}
+	records := map[string][]byte{}
+	for k, r := range changed {
+		if r == nil {
+			records[k] = nil
+			continue
+		}
+		v, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		records[k] = v
+	}
+	deploys := map[string][]byte{}
+	deployStatuses.Lock()
+	for _, status := range deployStatuses.deploys {
+		v, err := json.Marshal(status)
+		if err != nil {
+			deployStatuses.Unlock()
+			return err
+		}
+		deploys[status.Cluster+"/"+status.Namespace+"/"+status.Name] = v
+	}
+	deployStatuses.Unlock()
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(stateRecordsBucket)
+		if cleared {
+			if err := tx.DeleteBucket(stateRecordsBucket); err != nil {
+				return err
+			}
+			var err error
+			if b, err = tx.CreateBucket(stateRecordsBucket); err != nil {
+				return err
+			}
+		}
+		if err := writeChanges(b, records); err != nil {
+			return err
+		}
+		diff := map[string][]byte{}
+		for k, v := range deploys {
+			if !bytes.Equal(s.deploys[k], v) {
+				diff[k] = v
+			}
+		}
+		for k := range s.deploys {
+			if _, exists := deploys[k]; !exists {
+				diff[k] = nil
+			}
+		}
+		return writeChanges(tx.Bucket(stateDeploymentsBucket), diff)
+	})
+	if err != nil {
+		// the changes are saved with the next ones, unless all the
+		// records were removed meanwhile
+		s.Lock()
+		if !s.cleared {
+			for k, r := range s.changed {
+				changed[k] = r
+			}
+			s.changed, s.cleared = changed, cleared
+		}
+		s.Unlock()
+		return err
+	}
+	s.deploys = deploys
+	return nil
+}
+
+// writeChanges puts the values into the bucket, deleting the keys whose
+// values are nil.
+func writeChanges(b *bolt.Bucket, changes map[string][]byte) error {
+	for k, v := range changes {
+		var err error
+		if v == nil {
+			err = b.Delete([]byte(k))
+		} else {
+			err = b.Put([]byte(k), v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close saves the state and closes the state file.
+func (s *stateStore) close() {
+	if err := s.save(); err != nil {
+		logrus.WithError(err).Error("failed to save the state")
+	}
+	s.saving.Lock()
+	defer s.saving.Unlock()
+	s.Lock()
+	defer s.Unlock()
+	if s.db != nil {
+		s.db.Close()
+		s.db = nil
+	}
+}
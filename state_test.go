@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func resetRecords() {
+	mu.Lock()
+	defer mu.Unlock()
+	allInfo.reset()
+	lastSeen = map[meta]time.Time{}
+	seenAttempts = map[meta]attemptSet{}
+	quotas.reset()
+	verifier.pending, verifier.orphans = map[meta]struct{}{}, map[meta]string{}
+	verifier.deletedPods, verifier.deletedContainers = map[[2]string]time.Time{}, map[string]time.Time{}
+}
+
+func TestStateSavesChanges(t *testing.T) {
+	defer resetRecords()
+	path := filepath.Join(t.TempDir(), "state.db")
+	if _, _, err := state.open(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		ingest(startupRecord{Name: name, Namespace: "k8s.io", Type: typeDefault, Start: 1, End: 2})
+	}
+	if err := state.save(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	allInfo.remove(meta{name: "b", namespace: "k8s.io"})
+	forget(meta{name: "b", namespace: "k8s.io"})
+	mu.Unlock()
+	ingest(startupRecord{Name: "c", Namespace: "k8s.io", Type: typeDefault, Attempt: 1, Start: 1, End: 3})
+	state.close()
+
+	resetRecords()
+	records, _, err := state.open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.close()
+	if records != 2 {
+		t.Errorf("loaded %d records, want a and c", records)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, exists := allInfo.get(meta{name: "b", namespace: "k8s.io"}); exists {
+		t.Error("restored a removed record")
+	}
+	if r, _ := allInfo.get(meta{name: "c", namespace: "k8s.io"}); r.Attempt != 1 {
+		t.Errorf("restored attempt %d of c, want the latest", r.Attempt)
+	}
+	if quotas.retained["k8s.io"] != 2 {
+		t.Errorf("retained %d records of the namespace, want 2", quotas.retained["k8s.io"])
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const kindStatefulSet = "StatefulSet"
+
+// statefulSetScales measures the scale events of stateful sets. Pods of a
+// stateful set are created one after another once the previous one is ready
+// with the default OrderedReady policy, so a scale event stays open until
+// its last pod is created and started, the readiness of the earlier pods is
+// part of its latency.
+var statefulSetScales = newScaleTracker(kindStatefulSet)
+
+// updateStatefulSets measures the stateful sets of the clusters.
+func updateStatefulSets(clusters []*cluster) {
+	var (
+		sets     = map[*cluster][]*appsv1.StatefulSet{}
+		existing = map[deployKey]struct{}{}
+		listed   = true
+	)
+	for _, c := range clusters {
+		ss, err := c.statefulSetLister.List(labels.Everything())
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to list stateful sets in the cluster %s", c.name)
+			listed = false
+			continue
+		}
+		for _, s := range ss {
+			existing[deployKey{cluster: c.name, meta: meta{name: s.Name, namespace: s.Namespace}}] = struct{}{}
+			sets[c] = append(sets[c], s)
+		}
+	}
+	if listed {
+		statefulSetScales.prune(existing)
+		smoother.prune(kindStatefulSet, existing)
+	}
+	for _, c := range clusters {
+		for _, s := range sets[c] {
+			c.updateStatefulSet(s)
+		}
+	}
+	statefulSetScales.export()
+}
+
+func (c *cluster) updateStatefulSet(s *appsv1.StatefulSet) {
+	if s.Spec.Selector == nil {
+		logrus.Errorf("stateful set %s from %s has an empty selector", s.Name, s.Namespace)
+		return
+	}
+	pods, err := c.podLister.Pods(s.Namespace).List(makeSelector(*s.Spec.Selector))
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to list pods belongs to %s", s.Name)
+		return
+	}
+	pods = controlledPods(s, pods)
+	key := scaleKey{
+		deployKey: deployKey{cluster: c.name, meta: meta{name: s.Name, namespace: s.Namespace}},
+		hash:      s.Status.UpdateRevision,
+		replicas:  1,
+	}
+	if s.Spec.Replicas != nil {
+		key.replicas = *s.Spec.Replicas
+	}
+	statefulSetScales.trackKey(c, key, s.CreationTimestamp.Time, pods)
+	updateWorkload(c, kindStatefulSet, s, pods)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/YLonely/startup-exporter/pkg/client"
+	"github.com/YLonely/startup-exporter/pkg/startup"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	defaultMaxRecords = 1000000
+
+	evictReasonEntries = "entries"
+	evictReasonBytes   = "bytes"
+
+	// recordOverhead approximates the memory a record takes apart from its
+	// strings
+	recordOverhead = 256
+)
+
+var evictedRecords = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "evicted_records_total",
+	},
+	[]string{
+		"reason",
+	},
+)
+
+type storeEntry struct {
+	m      meta
+	record startupRecord
+	size   int
+}
+
+// recordStore holds the startup records of containers, the least recently
+// used ones are evicted once it exceeds the max entries or bytes so the
+// memory of the exporter stays bounded on large clusters. It's guarded by mu.
+type recordStore struct {
+	// maxEntries and maxBytes are the limits of the store, 0 means no limit
+	maxEntries int
+	maxBytes   int
+	bytes      int
+	entries    map[meta]*list.Element
+	// order has the most recently used entry at the front
+	order *list.List
+}
+
+func newRecordStore() *recordStore {
+	return &recordStore{
+		entries: map[meta]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// recordSize approximates the memory taken by the record.
+func recordSize(m meta, r startupRecord) int {
+	size := recordOverhead + len(m.name) + len(m.namespace) + len(r.Name) + len(r.Namespace) + len(r.Type) +
+		len(r.Node) + len(r.Pod) + len(r.PodNamespace) + len(r.Image) + len(r.Snapshot)
+	for k, v := range r.Extras {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// get returns the record of the container and marks it as recently used.
+func (s *recordStore) get(m meta) (startupRecord, bool) {
+	e, exists := s.entries[m]
+	if !exists {
+		return startupRecord{}, false
+	}
+	s.order.MoveToFront(e)
+	return e.Value.(*storeEntry).record, true
+}
+
+// put stores the record of the container and returns the containers evicted
+// to make room for it.
+func (s *recordStore) put(m meta, r startupRecord) []meta {
+	size := recordSize(m, r)
+	if e, exists := s.entries[m]; exists {
+		entry := e.Value.(*storeEntry)
+		s.bytes += size - entry.size
+		entry.record, entry.size = r, size
+		s.order.MoveToFront(e)
+	} else {
+		s.entries[m] = s.order.PushFront(&storeEntry{m: m, record: r, size: size})
+		s.bytes += size
+	}
+	var evicted []meta
+	for s.order.Len() > 1 {
+		reason := ""
+		switch {
+		case s.maxEntries > 0 && s.order.Len() > s.maxEntries:
+			reason = evictReasonEntries
+		case s.maxBytes > 0 && s.bytes > s.maxBytes:
+			reason = evictReasonBytes
+		default:
+			return evicted
+		}
+		entry := s.order.Back().Value.(*storeEntry)
+		s.remove(entry.m)
+		evictedRecords.WithLabelValues(reason).Inc()
+		evicted = append(evicted, entry.m)
+	}
+	return evicted
+}
+
+func (s *recordStore) remove(m meta) {
+	e, exists := s.entries[m]
+	if !exists {
+		return
+	}
+	s.bytes -= e.Value.(*storeEntry).size
+	s.order.Remove(e)
+	delete(s.entries, m)
+}
+
+func (s *recordStore) len() int {
+	return s.order.Len()
+}
+
+// each calls f with every record from the least recently used one without
+// marking them as used, f may remove the record it's called with.
+func (s *recordStore) each(f func(meta, startupRecord)) {
+	for e := s.order.Back(); e != nil; {
+		prev := e.Prev()
+		entry := e.Value.(*storeEntry)
+		f(entry.m, entry.record)
+		e = prev
+	}
+}
+
+func (s *recordStore) reset() {
+	s.bytes = 0
+	s.entries = map[meta]*list.Element{}
+	s.order.Init()
+}
+
+// liveRecords is the records of the exporter as a startup.Store, for code
+// embedding the exporter. Records put in it are ingested like the ones sent
+// by collectors.
+type liveRecords struct{}
+
+var _ startup.Store = liveRecords{}
+
+func (liveRecords) Put(ctx context.Context, info ...client.StartupInfo) error {
+	records := make([]startupRecord, 0, len(info))
+	for _, i := range info {
+		r, err := normalize(wireStartupInfo{
+			Name:         i.Name,
+			Namespace:    i.Namespace,
+			Start:        json.RawMessage(strconv.FormatInt(i.Start, 10)),
+			End:          json.RawMessage(strconv.FormatInt(i.End, 10)),
+			Type:         i.Type,
+			Attempt:      i.Attempt,
+			Unit:         i.Unit,
+			Extras:       i.Extras,
+			Pod:          i.Pod,
+			PodNamespace: i.PodNamespace,
+			Image:        i.Image,
+			Snapshot:     i.Snapshot,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "invalid container %s(%s)", i.Name, i.Namespace)
+		}
+		records = append(records, r)
+	}
+	for _, r := range records {
+		ingest(r)
+	}
+	return nil
+}
+
+func (liveRecords) Get(ctx context.Context, namespace, name string) (client.StartupInfo, bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	r, exists := allInfo.get(meta{name: name, namespace: namespace})
+	return r.public(), exists, nil
+}
+
+func (liveRecords) List(ctx context.Context) ([]client.StartupInfo, error) {
+	info := []client.StartupInfo{}
+	mu.Lock()
+	allInfo.each(func(_ meta, r startupRecord) {
+		info = append(info, r.public())
+	})
+	mu.Unlock()
+	return info, nil
+}
+
+func (liveRecords) Delete(ctx context.Context, namespace, name string) error {
+	m := meta{name: name, namespace: namespace}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, exists := allInfo.get(m); exists {
+		allInfo.remove(m)
+		forget(m)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/YLonely/startup-exporter/pkg/client"
+)
+
+func TestLiveRecords(t *testing.T) {
+	defer resetRecords()
+	ctx := context.Background()
+	var s liveRecords
+	if err := s.Put(ctx, client.StartupInfo{Name: "a", Namespace: "k8s.io", Start: 1, End: 2, Unit: unitSecond}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, client.StartupInfo{Name: "b", Namespace: "k8s.io", Start: 2, End: 1}); err == nil {
+		t.Error("put an invalid container")
+	}
+	info, exists, err := s.Get(ctx, "k8s.io", "a")
+	if err != nil || !exists {
+		t.Fatalf("got %v, %v", exists, err)
+	}
+	if info.Unit != unitNanosecond || info.End-info.Start != 1e9 || info.Type != typeDefault {
+		t.Errorf("got %+v", info)
+	}
+	if err := s.Delete(ctx, "k8s.io", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := s.List(ctx); len(all) != 0 {
+		t.Errorf("listed %+v after deleting", all)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// defaultRollingUpdateParam is what the API server defaults maxSurge and
+// maxUnavailable to
+const defaultRollingUpdateParam = "25%"
+
+var strategyLabels = []string{
+	"strategy",
+	"max_surge",
+	"max_unavailable",
+}
+
+var (
+	deployStrategyInfo = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemDeploy,
+			Name:      "strategy",
+		},
+		append([]string{
+			"deploy_name",
+			"namespace",
+			"cluster",
+		}, strategyLabels...),
+	)
+	// strategyScaleLatency and strategyRolloutDuration are registered with
+	// the latency buckets
+	strategyScaleLatency    *prometheus.HistogramVec
+	strategyRolloutDuration *prometheus.HistogramVec
+)
+
+// deployStrategy is how a deployment replaces its pods, the parameters are
+// empty for Recreate.
+type deployStrategy struct {
+	Type           string
+	MaxSurge       string
+	MaxUnavailable string
+}
+
+// strategyOf returns the strategy of the deployment with the defaults of the
+// API server filled in.
+func strategyOf(d *appsv1.Deployment) deployStrategy {
+	s := deployStrategy{Type: string(d.Spec.Strategy.Type)}
+	if s.Type == "" {
+		s.Type = string(appsv1.RollingUpdateDeploymentStrategyType)
+	}
+	if s.Type != string(appsv1.RollingUpdateDeploymentStrategyType) {
+		return s
+	}
+	s.MaxSurge, s.MaxUnavailable = defaultRollingUpdateParam, defaultRollingUpdateParam
+	if ru := d.Spec.Strategy.RollingUpdate; ru != nil {
+		if ru.MaxSurge != nil {
+			s.MaxSurge = ru.MaxSurge.String()
+		}
+		if ru.MaxUnavailable != nil {
+			s.MaxUnavailable = ru.MaxUnavailable.String()
+		}
+	}
+	return s
+}
+
+func (s deployStrategy) labelValues() []string {
+	return []string{s.Type, s.MaxSurge, s.MaxUnavailable}
+}
+
+// exportDeployStrategy sets the info series of the strategy of the
+// deployment, which the per deployment latencies can be joined with.
+func exportDeployStrategy(c *cluster, d *appsv1.Deployment) {
+	deployStrategyInfo.WithLabelValues(append([]string{d.Name, d.Namespace, c.name}, strategyOf(d).labelValues()...)...).Set(1)
+}
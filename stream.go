@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	streamEventRecord      = "record"
+	streamEventMeasurement = "measurement"
+	// streamEventAggregate is published when the average startup latency
+	// or the samples of a deployment change
+	streamEventAggregate = "aggregate"
+
+	// streamBufferSize is how many events a slow subscriber may fall behind
+	// before events are dropped for it
+	streamBufferSize = 256
+)
+
+type streamEvent struct {
+	name string
+	data []byte
+}
+
+// broadcaster fans out events to the subscribers of the stream endpoint.
+type broadcaster struct {
+	sync.Mutex
+	subscribers map[chan streamEvent]struct{}
+}
+
+var stream = broadcaster{
+	subscribers: map[chan streamEvent]struct{}{},
+}
+
+func (b *broadcaster) subscribe() chan streamEvent {
+	ch := make(chan streamEvent, streamBufferSize)
+	b.Lock()
+	defer b.Unlock()
+	b.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (b *broadcaster) unsubscribe(ch chan streamEvent) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.subscribers, ch)
+}
+
+// publish sends an event to all the subscribers without blocking.
+func (b *broadcaster) publish(name string, v interface{}) {
+	b.Lock()
+	defer b.Unlock()
+	if len(b.subscribers) == 0 {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to encode the %s event", name)
+		return
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- streamEvent{name: name, data: data}:
+		default:
+		}
+	}
+}
+
+// handleStream streams the accepted startup records and the completed
+// measurements as server-sent events.
+func handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	ch := stream.subscribe()
+	defer stream.unsubscribe(ch)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-ch:
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.name, e.data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
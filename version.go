@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+const versionHeader = "X-Startup-Exporter-Version"
+
+// version and commit are set at build time, e.g.
+// go build -ldflags "-X main.version=v0.2.0 -X main.commit=$(git rev-parse HEAD)"
+// The binary needs no cgo, a static one for another arch is built with
+// CGO_ENABLED=0 GOARCH=arm64 go build ...
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
+var (
+	buildInfo = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "build_info",
+		},
+		[]string{
+			"version",
+			"commit",
+			"goversion",
+		},
+	)
+	incompatibleCollectorPushes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "incompatible_collector_pushes_total",
+		},
+		[]string{
+			"collector_version",
+		},
+	)
+	warnedVersions sync.Map
+)
+
+func init() {
+	buildInfo.WithLabelValues(version, commit, runtime.Version()).Set(1)
+}
+
+// majorVersion returns the major part of a semantic version, or an empty
+// string for development builds.
+func majorVersion(v string) string {
+	if !strings.HasPrefix(v, "v") {
+		return ""
+	}
+	return strings.SplitN(v, ".", 2)[0]
+}
+
+// compatibleVersion reports whether a collector of version v can talk to this
+// exporter, versions are compatible if they share the major version.
+func compatibleVersion(v string) bool {
+	m, own := majorVersion(v), majorVersion(version)
+	return m == "" || own == "" || m == own
+}
+
+// checkCollectorVersion warns once per version about collectors which run an
+// incompatible version.
+func checkCollectorVersion(r *http.Request) {
+	v := r.Header.Get(versionHeader)
+	if v == "" || compatibleVersion(v) {
+		return
+	}
+	incompatibleCollectorPushes.WithLabelValues(v).Inc()
+	if _, warned := warnedVersions.LoadOrStore(v, struct{}{}); !warned {
+		logrus.Warnf("collector %s runs version %s which is incompatible with exporter version %s", r.RemoteAddr, v, version)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// shimBinaryPathFile is the file containerd records the binary of the
+	// shim of a task in, in the bundle dir
+	shimBinaryPathFile = "shim-binary-path"
+	// extraShim is the extra telling which wasm shim runs a container
+	extraShim = "shim"
+)
+
+// wasmShims are the names of the containerd-wasm-shims and runwasi shims,
+// from containerd-shim-<name>-v1
+var wasmShims = []string{"spin", "slight", "wws", "lunatic", "wasmtime", "wasmedge", "wasmer"}
+
+// wasmShim returns the name of the wasm shim running the task of the bundle,
+// it's empty if the task isn't run by a known wasm shim.
+func wasmShim(bundle string) string {
+	bs, err := ioutil.ReadFile(path.Join(bundle, shimBinaryPathFile))
+	if err != nil {
+		return ""
+	}
+	binary := filepath.Base(strings.TrimSpace(string(bs)))
+	for _, shim := range wasmShims {
+		if strings.HasPrefix(binary, "containerd-shim-"+shim+"-") {
+			return shim
+		}
+	}
+	return ""
+}
+
+// wasmExtras records the wasm shim of a container in its extras, a shim
+// setting it itself takes precedence.
+func wasmExtras(shim string, extras map[string]string) map[string]string {
+	if shim == "" {
+		return extras
+	}
+	if _, set := extras[extraShim]; set {
+		return extras
+	}
+	if extras == nil {
+		extras = map[string]string{}
+	}
+	extras[extraShim] = shim
+	return extras
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// the deployment metrics are kept as they are, other kinds of workloads share
+// metrics labeled by their kind
+var (
+	workloadAvgStartupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemWorkload,
+			Name:      "average_startup_latency_milliseconds",
+		},
+		[]string{
+			"kind",
+			"name",
+			"namespace",
+			"cluster",
+			"runtime_class",
+		},
+	)
+	workloadScaleLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystemWorkload,
+			Name:      "scale_latency_milliseconds",
+		},
+		[]string{
+			"kind",
+			"name",
+			"namespace",
+			"cluster",
+		},
+	)
+)
+
+// controlledPods returns the pods controlled by the workload.
+func controlledPods(w metav1.Object, pods []*corev1.Pod) []*corev1.Pod {
+	var controlled []*corev1.Pod
+	for _, p := range pods {
+		if p != nil && metav1.IsControlledBy(p, w) {
+			controlled = append(controlled, p)
+		}
+	}
+	return controlled
+}
+
+// updateWorkload publishes the average startup latency of the containers of
+// the pods of a workload other than a deployment, sidecars are left out.
+func updateWorkload(c *cluster, kind string, w metav1.Object, pods []*corev1.Pod) {
+	if stuck := stuckContainers(pods); len(stuck) > 0 {
+		logrus.Warnf("%s %s(%s) has stuck containers %v", kind, w.GetName(), w.GetNamespace(), stuck)
+		return
+	}
+	if !shouldUpdate(meta{name: w.GetName(), namespace: w.GetNamespace()}, pods) {
+		return
+	}
+	var (
+		total            float64
+		received, target int
+	)
+	for _, p := range pods {
+		if c.evictions.isReplacement(p) {
+			continue
+		}
+		for _, container := range p.Spec.Containers {
+			if !isSidecar(container.Name, container.Image) {
+				target++
+			}
+		}
+		records, _ := podStartupRecords(p)
+		for _, r := range records {
+			total += r.milliseconds()
+			received++
+		}
+	}
+	if received == 0 || received < minSamples(w, target) {
+		return
+	}
+	avg := total / float64(received)
+	workloadAvgStartupLatency.WithLabelValues(kind, w.GetName(), w.GetNamespace(), c.name, podsRuntimeClass(pods)).Set(avg)
+	logrus.Debugf("update average startup latency of %s %s(%s) to %v", kind, w.GetName(), w.GetNamespace(), avg)
+}